@@ -0,0 +1,75 @@
+package archive
+
+// Package file archive/ansi.go contains the detection of the ANSI escape sequences used by NFO and ANSI art text.
+
+import "bytes"
+
+const esc = 0x1b // escape control character
+
+// HasANSI returns true if b contains an ANSI control sequence, such as the ESC[ CSI sequences
+// used for the color codes and cursor movements of scene NFO files and ANSI art.
+// It can be used to choose an ANSI capable renderer for an extracted text file.
+//
+// The bytes are checked as they are stored, so it should be used before any codepage decoding,
+// as the escape and the ASCII parameters are identical in CP437 and most other codepages.
+func HasANSI(b []byte) bool {
+	for i := bytes.IndexByte(b, esc); i >= 0; {
+		if csi(b[i:]) > 0 {
+			return true
+		}
+		next := bytes.IndexByte(b[i+1:], esc)
+		if next < 0 {
+			return false
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// StripANSI returns a copy of b with all the ANSI control sequences removed,
+// leaving the plain text. An incomplete sequence at the end of b is also removed,
+// while escape characters that do not begin a sequence are kept.
+// Like HasANSI, it is independent of the codepage of the text.
+func StripANSI(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, esc)
+		if i < 0 {
+			return append(out, b...)
+		}
+		out = append(out, b[:i]...)
+		b = b[i:]
+		n := csi(b)
+		switch {
+		case n > 0:
+			b = b[n:]
+		case n < 0:
+			return out
+		default:
+			out = append(out, esc)
+			b = b[1:]
+		}
+	}
+	return out
+}
+
+// csi returns the length of the control sequence introducer at the start of b,
+// which is the ESC[ bytes, the parameter and intermediate bytes, and a final byte.
+// Zero is returned when b does not begin with a sequence, and -1 when the sequence is incomplete.
+func csi(b []byte) int {
+	if len(b) < 2 || b[0] != esc || b[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(b); i++ {
+		switch c := b[i]; {
+		case c >= 0x20 && c <= 0x3f:
+			// parameter bytes 0-9:;<=>? and the intermediate bytes space to /
+			continue
+		case c >= 0x40 && c <= 0x7e:
+			return i + 1
+		default:
+			return 0
+		}
+	}
+	return -1
+}
@@ -0,0 +1,364 @@
+package archive
+
+// Package file archive/arc.go contains the native ARC and PAK header parsing and decompression functions.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/archive/pkzip"
+)
+
+const (
+	arcMark     = 0x1a // marker byte that begins every ARC header
+	arcEnd      = 0    // method of the end of archive header
+	arcOldStore = 1    // method of an uncompressed file using the original short header
+	arcStore    = 2    // method of an uncompressed file
+	arcPack     = 3    // method of a file using run-length encoding
+	arcSqueeze  = 4    // method of a file using Huffman squeezing and run-length encoding
+	arcFiles    = 11   // last method of a compressed file, the later methods are PAK information items
+	arcNameLen  = 13   // length of the null terminated filename field
+	arcShort    = 25   // length of the header fields of method 1 that follow the method byte
+	arcRLE      = 0x90 // run-length encoding marker byte
+	arcSqEOF    = 256  // end of file value of a squeezed file
+)
+
+// ErrMethod is returned when a file within an ARC archive uses a compression method
+// that cannot be decompressed natively.
+var ErrMethod = errors.New("compression method is not supported")
+
+// arcHeader is the header of a file within an ARC or PAK archive.
+type arcHeader struct {
+	Name     string    // Name is the MS-DOS filename.
+	Method   byte      // Method is the compression method.
+	Offset   int64     // Offset is the position of the compressed data within the archive.
+	Packed   int64     // Packed is the size of the compressed data.
+	Size     int64     // Size is the original size of the file.
+	CRC      uint16    // CRC is the CRC-16 checksum of the original file.
+	Modified time.Time // Modified is the MS-DOS modification time of the file.
+}
+
+// arcEntries reads the headers of the src ARC or PAK archive and returns the files
+// with the offsets, methods and sizes of their stored data.
+// The information items of PAK archives, such as comments, are skipped.
+func arcEntries(src string) ([]arcHeader, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("arc entries %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	headers := []arcHeader{}
+	offset := int64(0)
+	for {
+		var mark [2]byte
+		if _, err := io.ReadFull(r, mark[:]); err != nil {
+			return nil, fmt.Errorf("arc entries %w: %w", ErrRead, err)
+		}
+		if mark[0] != arcMark {
+			return nil, fmt.Errorf("arc entries %w: %s", ErrNotArchive, src)
+		}
+		method := mark[1]
+		if method == arcEnd {
+			return headers, nil
+		}
+		size := arcShort
+		if method != arcOldStore {
+			size += 4
+		}
+		h := make([]byte, size)
+		if _, err := io.ReadFull(r, h); err != nil {
+			return nil, fmt.Errorf("arc entries %w: %w", ErrRead, err)
+		}
+		offset += int64(len(mark) + size)
+		name, _, _ := bytes.Cut(h[:arcNameLen], []byte{0})
+		e := arcHeader{
+			Name:   string(name),
+			Method: method,
+			Offset: offset,
+			Packed: int64(binary.LittleEndian.Uint32(h[13:])),
+			CRC:    binary.LittleEndian.Uint16(h[21:]),
+			Modified: pkzip.DosTime(
+				binary.LittleEndian.Uint16(h[17:]),
+				binary.LittleEndian.Uint16(h[19:])),
+		}
+		e.Size = e.Packed
+		if method != arcOldStore {
+			e.Size = int64(binary.LittleEndian.Uint32(h[25:]))
+		}
+		if _, err := r.Discard(int(e.Packed)); err != nil {
+			return nil, fmt.Errorf("arc entries %w: %w", ErrRead, err)
+		}
+		offset += e.Packed
+		if method <= arcFiles {
+			headers = append(headers, e)
+		}
+	}
+}
+
+// ARCNote returns the note or comment text stored in the src ARC archive, which is read
+// from the verbose list command of the [arc program]. An empty string is returned when
+// the archive has no note.
+//
+// The verbose list is a table of the files followed by a totals row. Any text before the
+// table, lines within the table that are not file rows, and any text after the totals row
+// are returned as the note, with the lines joined by newlines.
+//
+// [arc program]: https://linux.die.net/man/1/arc
+func (c *Content) ARCNote(src string) (string, error) {
+	prog, err := exec.LookPath(command.Arc)
+	if err != nil {
+		return "", fmt.Errorf("archive arc note %w", err)
+	}
+	const verbose = "v"
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, verbose, src)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		if b.String() != "" {
+			return "", fmt.Errorf("archive arc note %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return "", fmt.Errorf("archive arc note %w", err)
+	}
+	return arcNote(string(out)), nil
+}
+
+// arcNote returns the lines of the arc program verbose list output that are not part
+// of the file table, which are the lines that are not the column headings,
+// the separator rows, the file rows or the totals row.
+//
+//	Name          Length    Stowage    SF   Size now  Date       Time    CRC
+//	============  ========  ========  ====  ========  =========  ======  ====
+//	TEST.TXT            14  Stored      0%        14  14 Feb 25   1:21p  7a2c
+//	        ====  ========  ====  ========
+//	Total      1        14    0%        14
+func arcNote(out string) string {
+	const rowCols = 8 // minimum columns of a file row, as the date column contains spaces
+	notes := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "Name" && slices.Contains(fields, "Length"):
+			continue
+		case strings.Trim(fields[0], "=") == "":
+			continue
+		case fields[0] == "Total" && len(fields) > 1 && arcNumber(fields[1]):
+			continue
+		case len(fields) >= rowCols && arcNumber(fields[1]):
+			continue
+		}
+		notes = append(notes, line)
+	}
+	return strings.Join(notes, "\n")
+}
+
+// arcNumber returns true if s is a decimal number, such as the length column of a file row.
+func arcNumber(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// ARCFile extracts the named file from the source ARC or PAK archive to the destination directory
+// and returns the path of the extracted file. The name is matched regardless of case.
+//
+// Unlike the ARC method, which copies the archive to the destination and runs the [arc program],
+// the stored file is read directly from its offset within the archive, so it is much cheaper
+// for large archives. The stored, packed and squeezed methods are decompressed natively,
+// while the crunched, squashed and PAK methods are delegated to the arc program.
+//
+// [arc program]: https://linux.die.net/man/1/arc
+func (x Extractor) ARCFile(name string) (string, error) {
+	if err := destDir(x.Destination); err != nil {
+		return "", err
+	}
+	headers, err := arcEntries(x.Source)
+	if err != nil {
+		return "", fmt.Errorf("arc file %w", err)
+	}
+	for _, h := range headers {
+		if !strings.EqualFold(h.Name, name) {
+			continue
+		}
+		path, err := x.arcNative(h)
+		if errors.Is(err, ErrMethod) {
+			return x.extractNamed(h.Name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("arc file %w", err)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("arc file %w: %s", ErrMissing, name)
+}
+
+// arcNative decompresses the file of the h header to the destination directory
+// and returns the path of the extracted file, or ErrMethod if the method is not supported.
+func (x Extractor) arcNative(h arcHeader) (string, error) {
+	if h.Method > arcSqueeze {
+		return "", fmt.Errorf("%w: method %d", ErrMethod, h.Method)
+	}
+	f, err := os.Open(x.Source)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(io.NewSectionReader(f, h.Offset, h.Packed))
+	if h.Method == arcSqueeze {
+		r, err = arcUnsqueeze(r)
+		if err != nil {
+			return "", err
+		}
+	}
+	if h.Method >= arcPack {
+		r = &arcUnpack{r: r.(io.ByteReader)}
+	}
+	path := filepath.Join(x.Destination, filepath.Base(filepath.FromSlash(h.Name)))
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	crc := &arcCRC{}
+	_, err = io.Copy(io.MultiWriter(dst, crc), io.LimitReader(r, h.Size))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && crc.sum != h.CRC {
+		err = fmt.Errorf("%w: checksum mismatch of %s", ErrRead, h.Name)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	if !h.Modified.IsZero() {
+		_ = os.Chtimes(path, h.Modified, h.Modified)
+	}
+	return path, nil
+}
+
+// arcUnpack is a reader that expands the run-length encoding of the packed ARC method,
+// where the marker byte is followed by a repeat count of the previous byte,
+// or a zero count for a literal marker byte.
+type arcUnpack struct {
+	r      io.ByteReader
+	last   byte
+	repeat int
+}
+
+func (u *arcUnpack) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if u.repeat > 0 {
+			p[n] = u.last
+			u.repeat--
+			n++
+			continue
+		}
+		b, err := u.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b != arcRLE {
+			u.last = b
+			p[n] = b
+			n++
+			continue
+		}
+		count, err := u.r.ReadByte()
+		if err != nil {
+			return n, fmt.Errorf("%w: %w", ErrRead, io.ErrUnexpectedEOF)
+		}
+		if count == 0 {
+			u.last = arcRLE
+			p[n] = arcRLE
+			n++
+			continue
+		}
+		u.repeat = int(count) - 1
+	}
+	return n, nil
+}
+
+// arcUnsqueeze returns a reader of the Huffman decoded data of the squeezed ARC method,
+// which begins with the node count and decoding tree, followed by the bit stream.
+// The returned data is still run-length encoded.
+func arcUnsqueeze(r io.Reader) (*bytes.Reader, error) {
+	var count uint16
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	const maxNodes = arcSqEOF
+	if count > maxNodes {
+		return nil, fmt.Errorf("%w: squeeze tree of %d nodes", ErrRead, count)
+	}
+	tree := make([][2]int16, count)
+	if err := binary.Read(r, binary.LittleEndian, tree); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	var out bytes.Buffer
+	if count == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	br := r.(io.ByteReader)
+	node := int16(0)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRead, io.ErrUnexpectedEOF)
+		}
+		for bit := range 8 {
+			node = tree[node][b>>bit&1]
+			if node >= 0 {
+				if int(node) >= len(tree) {
+					return nil, fmt.Errorf("%w: squeeze node %d", ErrRead, node)
+				}
+				continue
+			}
+			value := -(int(node) + 1)
+			if value == arcSqEOF {
+				return bytes.NewReader(out.Bytes()), nil
+			}
+			out.WriteByte(byte(value))
+			node = 0
+		}
+	}
+}
+
+// arcCRC is a writer that computes the CRC-16 checksum used by ARC archives,
+// which uses the reversed 0xA001 polynomial with a zero initial value.
+type arcCRC struct {
+	sum uint16
+}
+
+func (c *arcCRC) Write(p []byte) (int, error) {
+	const poly = 0xa001
+	for _, b := range p {
+		c.sum ^= uint16(b)
+		for range 8 {
+			if c.sum&1 != 0 {
+				c.sum = c.sum>>1 ^ poly
+				continue
+			}
+			c.sum >>= 1
+		}
+	}
+	return len(p), nil
+}
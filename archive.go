@@ -1,6 +1,6 @@
 // Package archive provides compressed and stored archive file extraction and content listing.
 //
-// The file archive formats supported are 7Zip, ARC, ARJ, LHA, LZH, RAR, TAR, and ZIP,
+// The file archive formats supported are 7Zip, ARC, ARJ, LHA, LZH, PAK, RAR, TAR, ZIP, and Zoo,
 // including the deflate, implode, and shrink compression methods.
 //
 // The package uses following Linux terminal programs for legacy file support.
@@ -13,6 +13,8 @@
 //  5. [tar] - GNU tar
 //  6. [unrar] - 6.24 freeware by Alexander Roshal, not the common [unrar-free] which is feature incomplete
 //  7. [zipinfo] - ZipInfo v3 by the Info-ZIP workgroup
+//  8. [xdms] - xdms for Amiga DMS disk images, which are optional and only unpacked to ADF images
+//  9. [zoo] - zoo v2.10 archiver for the Zoo archives of Fidonet-era distributions
 //
 // [7zz]: https://www.7-zip.org/
 // [arc]: https://linux.die.net/man/1/arc
@@ -23,6 +25,8 @@
 // [unrar]: https://www.rarlab.com/rar_add.htm
 // [unrar-free]: https://gitlab.com/bgermann/unrar-free
 // [zipinfo]: https://infozip.sourceforge.net/
+// [xdms]: https://zakalwe.fi/~shd/foss/xdms/
+// [zoo]: https://launchpad.net/ubuntu/+source/zoo
 package archive
 
 import (
@@ -30,13 +34,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Defacto2/archive/command"
@@ -53,6 +58,7 @@ const (
 )
 
 const (
+	arcx = ".arc" // ARC by System Enhancement Associates
 	arjx = ".arj" // Archived by Robert Jung
 	lhax = ".lha" // LHarc by Haruyasu Yoshizaki (Yoshi)
 	lhzx = ".lzh" // LHArc by Haruyasu Yoshizaki (Yoshi)
@@ -60,8 +66,19 @@ const (
 	zipx = ".zip" // Phil Katz's ZIP for MS-DOS systems
 )
 
+// MaxEntries is the maximum number of entries in an archive that Extract will extract,
+// to guard against archives with millions of tiny files that exhaust the inodes of the file system.
+// A value of zero or less disables the check.
+var MaxEntries = 100000
+
+// MaxStderr is the maximum length in bytes of the standard error output of an archiver program
+// that is included in a returned error, as some programs are very verbose when they fail.
+// Longer output is truncated. A value of zero or less disables the truncation.
+var MaxStderr = 2048
+
 var (
 	ErrDest           = errors.New("destination is empty")
+	ErrDestReadOnly   = errors.New("destination is not writable")
 	ErrExt            = errors.New("extension is not a supported archive format")
 	ErrNotArchive     = errors.New("file is not an archive")
 	ErrNotImplemented = errors.New("archive format is not implemented")
@@ -71,9 +88,21 @@ var (
 	ErrPath           = errors.New("path is a file")
 	ErrPanic          = errors.New("extract panic")
 	ErrMissing        = errors.New("path does not exist")
+	ErrEncrypted      = errors.New("archive is encrypted")
+	ErrTooMany        = errors.New("archive has too many entries")
+	ErrManifest       = errors.New("manifest path is empty")
+	ErrModified       = errors.New("archive listing has no modification times")
+	ErrSequence       = errors.New("split files are not numbered in sequence")
+	ErrTraversal      = errors.New("path is outside of the destination")
+	ErrCollision      = errors.New("extracted path collides with another file")
+	ErrRename         = errors.New("renamed path is outside of the destination")
+	ErrPage           = errors.New("page offset or limit is negative")
+	ErrSpecialFile    = errors.New("archive contains a device or named pipe entry")
+	ErrWrongPassword  = errors.New("archive password is incorrect")
 )
 
-// MagicExt uses the Linux [file] program to determine the src archive file type.
+// MagicExt determines the src archive file type using MagicReader,
+// and falls back to the Linux [file] program for the file types that it does not identify.
 // The returned string will be a file separator and extension.
 // For example a file with the magic string "gzip compressed data" will return ".tar.gz".
 //
@@ -81,11 +110,109 @@ var (
 //
 // [file]: https://www.darwinsys.com/file/
 func MagicExt(src string) (string, error) {
+	return magicExt(context.Background(), src)
+}
+
+// magicExt returns the file separator and extension of the src archive file type, the same as MagicExt,
+// but the file program is stopped when the ctx is canceled.
+func magicExt(ctx context.Context, src string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("archive magic ext %w", err)
+	}
+	defer f.Close()
+	ext, err := MagicReader(f)
+	if !errors.Is(err, ErrExt) {
+		return ext, err
+	}
+	// the file program and the mappings of RegisterMagic identify some other formats
+	out, err := magicFile(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	return magicMatch(out)
+}
+
+// MagicExtVerbose is the same as MagicExt but also returns the complete output of the [file] program,
+// which is returned even when the magic string is not matched to an archive and ErrExt is returned.
+// It is intended to help diagnose archives that are not detected,
+// as the ErrExt error of MagicExt only includes the first part of the magic string.
+//
+// [file]: https://www.darwinsys.com/file/
+func MagicExtVerbose(src string) (string, string, error) {
+	out, err := magicFile(context.Background(), src)
+	if err != nil {
+		return "", "", err
+	}
+	ext, err := magicMatch(out)
+	return ext, strings.TrimSpace(out), err
+}
+
+// MagicReader determines the archive file type from the leading bytes of r using the
+// [magicnumber] package, so it classifies an archive held in memory or read from a network
+// stream without the file program or a file on disk. The returned string is the same
+// file separator and extension returned by MagicExt, for example ".zip" or ".tar.gz".
+//
+// Only the first 4 KiB of r are read. ErrRead is returned when r cannot be read or is empty,
+// and ErrExt is returned for an unknown file type or a format that MagicExt does not match,
+// such as xz or Microsoft Cabinet. The mappings added by RegisterMagic are not used,
+// as they match the output of the file program that MagicExt falls back to.
+//
+// [magicnumber]: https://github.com/Defacto2/magicnumber
+func MagicReader(r io.Reader) (string, error) {
+	const size = 4096
+	p, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return "", fmt.Errorf("archive magic reader %w: %w", ErrRead, err)
+	}
+	if len(p) == 0 {
+		return "", fmt.Errorf("archive magic reader %w: empty", ErrRead)
+	}
+	if bytes.HasPrefix(p, dmsSign) {
+		return dmsx, nil
+	}
+	sign, err := magicnumber.Archive(bytes.NewReader(p))
+	if err != nil {
+		return "", fmt.Errorf("archive magic reader %w: %w", ErrRead, err)
+	}
+	switch sign {
+	case magicnumber.X7zCompressArchive:
+		return ".7z", nil
+	case magicnumber.ArchiveRobertJung:
+		return arjx, nil
+	case magicnumber.Bzip2CompressArchive:
+		return ".tar.bz2", nil
+	case magicnumber.GzipCompressArchive:
+		return ".tar.gz", nil
+	case magicnumber.YoshiLHA:
+		return lhax, nil
+	case magicnumber.RoshalARchive, magicnumber.RoshalARchivev5:
+		return rarx, nil
+	case magicnumber.TapeARchive:
+		return tarx, nil
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		return zipx, nil
+	case magicnumber.ZooArchive:
+		return zoox, nil
+	}
+	return "", fmt.Errorf("archive magic reader %w: %s", ErrExt, sign)
+}
+
+// magicFile returns the brief output of the [file] program for the src file,
+// which is stopped when the parent context is canceled.
+//
+// [file]: https://www.darwinsys.com/file/
+func magicFile(parent context.Context, src string) (string, error) {
 	prog, err := exec.LookPath("file")
 	if err != nil {
 		return "", fmt.Errorf("archive magic file lookup %w", err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := withTimeout(parent, TimeoutExtract)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, prog, "--brief", src)
 	out, err := cmd.Output()
@@ -95,23 +222,75 @@ func MagicExt(src string) (string, error) {
 	if len(out) == 0 {
 		return "", fmt.Errorf("archive magic file type: %w", ErrRead)
 	}
-	magics := map[string]string{
-		"7-zip archive data":    ".7z",
-		"arj archive data":      arjx,
-		"bzip2 compressed data": ".tar.bz2",
-		"gzip compressed data":  ".tar.gz",
-		"rar archive data":      ".rar",
-		"posix tar archive":     ".tar",
-		"zip archive data":      zipx,
+	return string(out), nil
+}
+
+// magics are the substrings of the file program output mapped to the file separator and extension.
+var magics = []struct{ magic, ext string }{
+	{"7-zip archive data", ".7z"},
+	{"arj archive data", arjx},
+	{"bzip2 compressed data", ".tar.bz2"},
+	{"dms archive data", dmsx},
+	{"gzip compressed data", ".tar.gz"},
+	{"pak archive data", pakx},
+	{"rar archive data", rarx},
+	{"posix tar archive", tarx},
+	{"zip archive data", zipx},
+	{"zoo archive data", zoox},
+}
+
+var (
+	customMu     sync.RWMutex
+	customMagics []struct{ magic, ext string } // customMagics are the mappings added by RegisterMagic.
+)
+
+// RegisterMagic adds a mapping of a substring of the [file] program output to a file separator
+// and extension, for example "zip archive" to ".zip", that is used by MagicExt for the file types
+// that MagicReader does not identify.
+// The substring is matched regardless of case and the registered mappings are checked
+// before the built-in mappings, in the order they were registered.
+// Registering an existing substring replaces its extension.
+//
+// It allows callers to adapt to the different magic strings output by the versions of the file program
+// used by some Linux distributions. It is safe for concurrent use.
+//
+// [file]: https://www.darwinsys.com/file/
+func RegisterMagic(fileSubstring, ext string) {
+	magic := strings.ToLower(strings.TrimSpace(fileSubstring))
+	if magic == "" {
+		return
+	}
+	customMu.Lock()
+	defer customMu.Unlock()
+	for i, m := range customMagics {
+		if m.magic == magic {
+			customMagics[i].ext = ext
+			return
+		}
+	}
+	customMagics = append(customMagics, struct{ magic, ext string }{magic, ext})
+}
+
+// magicMatch returns the file separator and extension for the output of the file program,
+// using the first registered or built-in mapping with a substring found in the output.
+func magicMatch(out string) (string, error) {
+	lout := strings.ToLower(out)
+	customMu.RLock()
+	for _, m := range customMagics {
+		if strings.Contains(lout, m.magic) {
+			customMu.RUnlock()
+			return m.ext, nil
+		}
 	}
-	s := strings.Split(strings.ToLower(string(out)), ",")
+	customMu.RUnlock()
+	s := strings.Split(lout, ",")
 	magic := strings.TrimSpace(s[0])
 	if internal.MagicLHA(magic) {
 		return lhax, nil
 	}
-	for magic, ext := range magics {
-		if strings.TrimSpace(s[0]) == magic {
-			return ext, nil
+	for _, m := range magics {
+		if strings.Contains(magic, m.magic) {
+			return m.ext, nil
 		}
 	}
 	return "", fmt.Errorf("archive magic file %w: %q", ErrExt, magic)
@@ -131,8 +310,66 @@ func MagicExt(src string) (string, error) {
 //	    }
 //	}
 type Content struct {
-	Ext   string   // Ext returns file extension of the archive.
-	Files []string // Files returns list of files within the archive.
+	Ext     string   // Ext returns file extension of the archive.
+	Files   []string // Files returns list of files within the archive.
+	Entries []Entry  // Entries returns the file metadata when reported by the archiver program.
+	Partial bool     // Partial is true when the archive is damaged and the files may be incomplete.
+	Tool    string   // Tool is the name of the program or the Go package that read the archive.
+
+	// Fallback has Read retry a failed listing using the [7z program], which reads many archive formats
+	// and is sometimes less picky than the format specific program. The Tool is set to the program that succeeded.
+	//
+	// [7z program]: https://www.7-zip.org/
+	Fallback bool
+
+	ctx context.Context // ctx is the optional parent context of the archiver programs used by ListContext.
+	raw bool            // raw keeps the directories and duplicate names, as Clean is skipped, for the checks of Extract.
+}
+
+// context returns a context for the archiver program that is canceled after the timeout,
+// or when the parent context given to ListContext is done.
+func (c *Content) context(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return withTimeout(c.ctx, timeout)
+}
+
+// ARC returns the content of the src ARC archive,
+// credited to System Enhancement Associates, using the [arc program].
+//
+// [arc program]: https://linux.die.net/man/1/arc
+func (c *Content) ARC(src string) error {
+	prog, err := exec.LookPath(command.Arc)
+	if err != nil {
+		return fmt.Errorf("archive arc reader %w", err)
+	}
+	const list = "l"
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, list, src)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("archive arc output %w", err)
+	}
+	if len(out) == 0 {
+		return ErrRead
+	}
+	files := []string{}
+	entries := []Entry{}
+	for _, s := range strings.Split(string(out), "\n") {
+		e, ok := arcEntry(s)
+		if !ok {
+			continue
+		}
+		files = append(files, e.Name)
+		entries = append(entries, e)
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = arcx
+	c.Tool = command.Arc
+	return nil
 }
 
 // ARJ returns the content of the src ARJ archive,
@@ -154,7 +391,7 @@ func (c *Content) ARJ(src string) error {
 	}
 	const verboselist = "v"
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutLookup)
+	ctx, cancel := c.context(TimeoutLookup)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, prog, verboselist, srcWithExt)
 	cmd.Stderr = &b
@@ -167,33 +404,47 @@ func (c *Content) ARJ(src string) error {
 	}
 	outs := strings.Split(string(out), "\n")
 	files := []string{}
+	entries := []Entry{}
 	const start = len("001) ")
-	for _, s := range outs {
+	for i, s := range outs {
 		if !internal.ARJItem(s) {
 			continue
 		}
-		files = append(files, s[start:])
+		name := s[start:]
+		files = append(files, name)
+		if strings.TrimSpace(name) == "" || i+1 >= len(outs) {
+			continue
+		}
+		entries = append(entries, arjEntry(name, outs[i+1]))
 	}
-	c.Files = slices.DeleteFunc(files, func(s string) bool {
-		return strings.TrimSpace(s) == ""
-	})
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
 	c.Ext = arjx
+	c.Tool = command.Arj
 	return nil
 }
 
 // LHA returns the content of the src LHA or LZH archive,
 // credited to Haruyasu Yoshizaki (Yoshi), using the [lha program].
 //
+// When the lha program is not installed, the [7z program] is used as a fallback.
+//
 // [lha program]: https://fragglet.github.io/lhasa/
+// [7z program]: https://www.7-zip.org/
 func (c *Content) LHA(src string) error {
 	prog, err := exec.LookPath(command.Lha)
 	if err != nil {
-		return fmt.Errorf("archive lha reader %w", err)
+		if err7 := c.Zip7(src); err7 != nil {
+			return fmt.Errorf("archive lha reader %w: %w", err, err7)
+		}
+		c.Ext = lhax
+		return nil
 	}
 
 	const list = "-l"
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutLookup)
+	ctx, cancel := c.context(TimeoutLookup)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, prog, list, src)
 	cmd.Stderr = &b
@@ -211,26 +462,35 @@ func (c *Content) LHA(src string) error {
 		sizeS = len("[generic]              ")
 		sizeL = len("-------")
 		start = len("[generic]                   12 100.0% Apr 10 17:03 ")
+		date  = len("Apr 10 17:03 ")
 		dir   = 0
 	)
 
 	files := []string{}
+	entries := []Entry{}
+	now := time.Now().UTC()
 	for _, s := range outs {
 		if len(s) < start {
 			continue
 		}
 		size := strings.TrimSpace(s[sizeS : sizeS+sizeL])
-		if i, err := strconv.Atoi(size); err != nil {
-			continue
-		} else if i == dir {
+		i, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || i == dir {
 			continue
 		}
 		files = append(files, s[start:])
+		entries = append(entries, Entry{
+			Name:       s[start:],
+			Size:       i,
+			Modified:   lhaDate(s[start-date:start], now),
+			Attributes: strings.Fields(s)[0],
+		})
 	}
-	c.Files = slices.DeleteFunc(files, func(s string) bool {
-		return strings.TrimSpace(s) == ""
-	})
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
 	c.Ext = lhax
+	c.Tool = command.Lha
 	return nil
 }
 
@@ -243,12 +503,15 @@ func (c *Content) Rar(src string) error {
 	if err != nil {
 		return fmt.Errorf("archive unrar reader %w", err)
 	}
+	if err := rarSupport(c.ctx, prog, src); err != nil {
+		return fmt.Errorf("archive unrar reader %w", err)
+	}
 	const (
 		listBrief  = "lb"
 		noComments = "-c-"
 	)
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutLookup)
+	ctx, cancel := c.context(TimeoutLookup)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, prog, listBrief, "-ep", noComments, src)
 	cmd.Stderr = &b
@@ -260,19 +523,65 @@ func (c *Content) Rar(src string) error {
 		return ErrRead
 	}
 	c.Files = strings.Split(string(out), "\n")
-	c.Files = slices.DeleteFunc(c.Files, func(s string) bool {
-		return strings.TrimSpace(s) == ""
-	})
+	c.Clean()
 	c.Ext = rarx
+	c.Tool = command.Unrar
+	return nil
+}
+
+// Zip7 returns the content of the src 7z archive, credited to Igor Pavlov,
+// using the [7z program]. The 7z program also reads many other archive formats,
+// such as LHA, so it is used as a fallback for other readers.
+//
+// Archives with encrypted headers, where even the names of the files are encrypted,
+// return ErrEncrypted as they cannot be listed without a password.
+//
+// [7z program]: https://www.7-zip.org/
+func (c *Content) Zip7(src string) error {
+	prog, err := exec.LookPath(command.Zip7)
+	if err != nil {
+		return fmt.Errorf("archive 7z reader %w", err)
+	}
+	const (
+		list      = "l"    // l list contents of archive
+		technical = "-slt" // -slt show technical information
+	)
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, list, technical, src)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if zip7Encrypted(string(out) + b.String()) {
+		return fmt.Errorf("archive 7z output %w: %s", ErrEncrypted, src)
+	}
+	if err != nil {
+		return fmt.Errorf("archive 7z output %w: %s", err, src)
+	}
+	if len(out) == 0 {
+		return ErrRead
+	}
+	files := []string{}
+	entries := []Entry{}
+	for _, e := range zip7Entries(string(out)) {
+		files = append(files, e.Name)
+		entries = append(entries, e)
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = ".7z"
+	c.Tool = command.Zip7
 	return nil
 }
 
 // Read returns the content of the src file archive using the system archiver programs.
 // The filename is used to determine the archive format.
 //
-// Supported formats are ARJ, LHA, LZH, RAR, and ZIP.
+// Supported formats are 7Z, ARJ, LHA, LZH, RAR, TAR, and ZIP.
+// When Fallback is true, a failed listing is retried using the 7z program.
 func (c *Content) Read(src string) error {
-	ext, err := MagicExt(src)
+	ext, err := magicExt(c.ctx, src)
 	if err != nil {
 		return fmt.Errorf("read %w", err)
 	}
@@ -280,19 +589,140 @@ func (c *Content) Read(src string) error {
 	// 	// retry using correct filename extension
 	// 	return fmt.Errorf("system reader: %w", ErrWrongExt)
 	// }
+	err = c.read(src, ext)
+	if err == nil || !c.Fallback || ext == ".7z" || errors.Is(err, ErrNotImplemented) {
+		return err
+	}
+	if err7 := c.Zip7(src); err7 != nil {
+		return fmt.Errorf("%w: fallback %w", err, err7)
+	}
+	c.Ext = ext
+	return nil
+}
+
+// read returns the content of the src file archive using the lister of the ext file extension.
+func (c *Content) read(src, ext string) error {
 	switch strings.ToLower(ext) {
 	case arjx:
 		return c.ARJ(src)
 	case lhax, lhzx:
 		return c.LHA(src)
+	case pakx:
+		return c.Pak(src)
 	case rarx:
 		return c.Rar(src)
+	case ".7z":
+		return c.Zip7(src)
+	case ".tar.gz":
+		if err := c.Tar(src); err != nil {
+			return c.Gzip(src)
+		}
+		return nil
+	case tarx, ".tar.bz2":
+		return c.Tar(src)
 	case zipx:
 		return c.Zip(src)
+	case zoox:
+		return c.Zoo(src)
+	case dmsx:
+		return fmt.Errorf("read %w, Amiga DMS disk image", ErrNotImplemented)
 	}
 	return fmt.Errorf("read %w", ErrRead)
 }
 
+// readSign returns the content of the src file archive using the reader that matches
+// the archive file type signature, which avoids the use of the file program.
+func (c *Content) readSign(src string, sign magicnumber.Signature) error {
+	switch sign {
+	case magicnumber.ARChiveSEA:
+		if PAK(src) {
+			return c.Pak(src)
+		}
+		return c.ARC(src)
+	case magicnumber.ArchiveRobertJung:
+		return c.ARJ(src)
+	case magicnumber.YoshiLHA:
+		return c.LHA(src)
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		return c.Rar(src)
+	case magicnumber.GzipCompressArchive:
+		if err := c.Tar(src); err != nil {
+			return c.Gzip(src)
+		}
+		return nil
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.TapeARchive:
+		return c.Tar(src)
+	case magicnumber.X7zCompressArchive:
+		return c.Zip7(src)
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		return c.Zip(src)
+	case magicnumber.ZooArchive:
+		return c.Zoo(src)
+	case magicnumber.Unknown:
+		if DMS(src) {
+			return fmt.Errorf("%w, Amiga DMS disk image", ErrNotImplemented)
+		}
+		return fmt.Errorf("%w, %s", ErrNotArchive, sign)
+	}
+	return fmt.Errorf("%w, %s", ErrNotImplemented, sign)
+}
+
+// signature returns the archive file type signature of the src file.
+func signature(src string) (magicnumber.Signature, error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return magicnumber.Unknown, fmt.Errorf("open %w", err)
+	}
+	defer r.Close()
+	sign, err := magicnumber.Archive(r)
+	if err != nil {
+		return magicnumber.Unknown, fmt.Errorf("magic %w", err)
+	}
+	if sign == magicnumber.Unknown && pkzip.Spanned(src) {
+		// the magic number does not match zip archives with a spanning marker
+		return magicnumber.PKWAREZip, nil
+	}
+	return sign, nil
+}
+
+// unspan returns the path of a temporary copy of the src zip archive without the "PK00" spanning marker,
+// which otherwise causes the zipinfo and unzip programs to exit with a warning.
+// The src path is returned when there is no marker. The returned function removes the copy.
+func unspan(src string) (string, func(), error) {
+	if !pkzip.Spanned(src) {
+		return src, func() {}, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	tmp, err := os.CreateTemp(helper.TmpDir(), "archive-unspan-*.zip")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { os.Remove(tmp.Name()) }
+	const marker = 4
+	_, err = io.Copy(tmp, io.NewSectionReader(f, marker, 1<<62))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return tmp.Name(), remove, nil
+}
+
 // Zip returns the content of the src ZIP archive, credited to Phil Katz,
 // using the [zipinfo program].
 //
@@ -302,30 +732,64 @@ func (c *Content) Zip(src string) error {
 	if err != nil {
 		return fmt.Errorf("archive zipinfo reader %w", err)
 	}
-	const list = "-1"
+	src, remove, err := unspan(src)
+	if err != nil {
+		return fmt.Errorf("archive zipinfo reader %w", err)
+	}
+	defer remove()
+	const list = "-l"
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutLookup)
+	ctx, cancel := c.context(TimeoutLookup)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, prog, list, src)
 	cmd.Stderr = &b
 	out, err := cmd.Output()
+	partial := false
 	if err != nil {
 		// handle broken zips that still contain some valid files
-		if b.String() != "" && len(out) > 0 {
-			// return files, zipx, nil
-			return nil
+		if b.String() == "" || len(out) == 0 {
+			// otherwise the zipinfo threw an error, so attempt to recover the files from the headers
+			if c.zipHeaders(src) == nil {
+				return nil
+			}
+			return fmt.Errorf("archive zipinfo %w: %s", err, src)
 		}
-		// otherwise the zipinfo threw an error
-		return fmt.Errorf("archive zipinfo %w: %s", err, src)
+		partial = true
 	}
 	if len(out) == 0 {
 		return ErrRead
 	}
-	c.Files = strings.Split(string(out), "\n")
-	c.Files = slices.DeleteFunc(c.Files, func(s string) bool {
-		return strings.TrimSpace(s) == ""
-	})
+	files := []string{}
+	entries := []Entry{}
+	links := false
+	for _, s := range strings.Split(string(out), "\n") {
+		e, ok := zipinfoEntry(s)
+		if !ok {
+			continue
+		}
+		const symlink = "l"
+		links = links || strings.HasPrefix(s, symlink)
+		files = append(files, e.Name)
+		entries = append(entries, e)
+	}
+	// the central directory is parsed once and shared by the corrections of the zipinfo listing
+	central, cerr := pkzip.CentralDirectory(src)
+	if cerr == nil {
+		zipUTF8Names(central, files, entries)
+		zipCRCs(central, entries)
+		if strings.Contains(string(out), "^") {
+			zipControls(central, files, entries)
+		}
+	}
+	if links {
+		zipLinks(src, entries)
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
 	c.Ext = zipx
+	c.Tool = command.ZipInfo
+	c.Partial = partial || cerr != nil || zipDiscrepancy(src, central)
 	return nil
 }
 
@@ -354,6 +818,139 @@ func ExtractAll(src, dst string) error {
 type Extractor struct {
 	Source      string // The source archive file.
 	Destination string // The extraction destination directory.
+
+	// TimeoutFunc optionally returns the maximum time allowed for the extraction
+	// using the size in bytes of the source archive file, for example [TimeoutScale].
+	// When nil, the TimeoutExtract or TimeoutDefunct durations are used.
+	TimeoutFunc func(srcSize int64) time.Duration
+
+	// PreserveModes restores the Unix file permissions stored in zip and tar archives
+	// to the extracted files, rather than using the default permissions of the process.
+	// The setuid, setgid and sticky bits are never restored.
+	PreserveModes bool
+
+	// PreserveTimes restores the modification times stored in zip and tar archives
+	// to the files extracted by the unzip and bsdtar programs, which otherwise use the time
+	// of the extraction. The other archiver programs always restore the stored times.
+	PreserveTimes bool
+
+	// StripControl removes any control characters from the names of the files extracted
+	// by the unzip program, for example "BAD\rNAME.TXT" is extracted as "BADNAME.TXT".
+	// Otherwise the control characters are kept, which matches the names stored in the archive.
+	// Use the Entry.Control method to find these names before the extraction.
+	StripControl bool
+
+	// Retries is the number of times the extraction is retried after a transient I/O error,
+	// such as those returned by a flaky network mounted source, using an increasing delay between attempts
+	// that is capped at TimeoutExtract.
+	// A failed archiver program is retried when its error output reports an I/O error, a resource
+	// that is temporarily unavailable, a stale file handle or a timed out connection.
+	// Other errors, such as an encrypted, corrupt or unsupported archive, are never retried.
+	Retries int
+
+	// CaseInsensitive matches the targets to the names of the files within the archive
+	// regardless of case, for example a "readme.txt" target extracts the "README.TXT" file.
+	// This is consistent across all formats, as the targets are resolved using the archive listing
+	// before the archiver program is run, where a target with an exact match is always kept.
+	// Otherwise the targets must match the case of the names within the archive.
+	CaseInsensitive bool
+
+	// SkipAppleDouble does not extract the macOS AppleDouble files,
+	// which are the "__MACOSX" directory and the "._" prefixed files found in Mac-origin archives.
+	// The files are filtered from the archive listing, so the archive must be listable,
+	// and any existing AppleDouble files in the destination are kept.
+	// Use Content.SkipAppleDouble to also remove these files from an archive listing.
+	SkipAppleDouble bool
+
+	// ListOrder sorts the paths returned by ExtractList in the order the files are stored
+	// within the archive, which can be meaningful, such as the sequence of disk image files.
+	// Otherwise the paths are in the lexical order of the destination directory,
+	// which avoids reading the archive listing.
+	ListOrder bool
+
+	// AutoCharset renames the extracted files and directories with names that are not valid UTF-8,
+	// using the likely codepage of the archive, which is codepage 437 for most MS-DOS archives
+	// and Shift-JIS for Japanese LHA archives. The codepage does not need to be known by the caller,
+	// but as the detection is a heuristic, some names could be decoded incorrectly.
+	// Any existing files in the destination with names that are not valid UTF-8 are also renamed.
+	AutoCharset bool
+
+	// AllowLinks keeps the symbolic links extracted from Unix-origin archives,
+	// but only when their targets resolve inside the destination directory.
+	// Links with absolute targets or targets that escape the destination are removed,
+	// and ErrTraversal is returned after all the other files are extracted.
+	// It takes precedence over RemoveLinks.
+	//
+	// When neither AllowLinks or RemoveLinks is set, the links are kept as they are written
+	// by the archiver program, so one of the options should be used with untrusted archives.
+	// The links that existed in the destination before the extraction are never changed.
+	AllowLinks bool
+
+	// RemoveLinks removes all the symbolic links created by the extraction from Unix-origin archives.
+	RemoveLinks bool
+
+	// StripComponents removes the first number of directory levels from the paths of the extracted files,
+	// which is useful for archives that wrap everything within a redundant top-level directory.
+	// Files with fewer directory levels than the number are not extracted, which matches the
+	// --strip-components option of tar. The files are extracted to a temporary directory within
+	// the destination and then moved, and ErrCollision is returned without moving any files
+	// when two stripped paths, or a stripped path and an existing file, share the same name.
+	// The moved symbolic links are checked again, and the links with targets that no longer
+	// resolve inside the destination are removed and ErrTraversal is returned.
+	StripComponents int
+
+	// KeepPaths extracts the files of LHA and LZH archives with their directory paths,
+	// which recreates the directories stored in level 2 archives. Otherwise these archives
+	// are extracted without paths, as many MS-DOS archives store paths that are meaningless
+	// on other systems. Any symbolic link entries are handled by the AllowLinks and RemoveLinks policies.
+	KeepPaths bool
+
+	// Rename optionally returns the new name of each extracted file, for example to lowercase
+	// or transliterate the names. It is called with the path of the file within the archive
+	// using forward slashes, after any StripComponents levels are removed, and returning
+	// an empty string skips the file. Like StripComponents, the files are extracted to a
+	// temporary directory and then moved, where ErrCollision is returned when two new names
+	// or a new name and an existing file are the same, and ErrRename is returned for a
+	// new name that is absolute or escapes the destination. As with StripComponents, the moved
+	// symbolic links with targets that escape the destination are removed and ErrTraversal is returned.
+	Rename func(original string) string
+
+	// Password is the passphrase used to extract encrypted ZIP, RAR and 7z archives,
+	// which is given to the unzip, unrar and 7z programs. ErrWrongPassword is returned
+	// when the program reports an incorrect password, rather than a corrupt archive.
+	// When empty, encrypted ZIP archives return an error without an extraction attempt.
+	// Note the password is visible to other users of the system in the program arguments.
+	Password string
+
+	// UnsafePaths skips the validation of the paths within the archive before the extraction.
+	// By default the archive is listed first and ErrTraversal is returned without extracting
+	// any files when a member uses an absolute path or its ".." segments escape the destination,
+	// as the tar, 7z and other archiver programs that keep the stored paths could otherwise
+	// write outside of the destination. Archives that cannot be listed are left for the
+	// archiver program to handle.
+	UnsafePaths bool
+
+	// MaxTotalSize is the maximum total uncompressed size in bytes of the files within the archive,
+	// and MaxRatio is the maximum ratio of the total uncompressed size to the compressed size,
+	// which protect against decompression bombs where a small archive expands to fill the disk.
+	// The sizes are read from the archive listing before the extraction and ErrTooMany is returned
+	// without extracting any files when either limit is exceeded. A zero value is unlimited.
+	// The sizes of every member are summed, including any duplicates, and ErrRead is returned
+	// when the archive cannot be listed or the listing does not report the sizes, such as
+	// the Microsoft Cabinet, xz and zstd formats that are listed by bsdtar and DMS disk images.
+	MaxTotalSize int64
+	MaxRatio     float64
+
+	// ContinueOnError salvages the files of a partially corrupt archive. When the extraction fails,
+	// the files within the archive listing, or the targets, are extracted one at a time, and Extract
+	// returns an errors.Join of the errors of the files that failed, while the other files are kept.
+	// Use ExtractSalvage to also return the names of the extracted files.
+	ContinueOnError bool
+
+	deadline time.Time       // deadline is the absolute time that the extraction must finish by.
+	ctx      context.Context // ctx is the optional parent context of the archiver programs used by ExtractContext.
+	verbose  *capture        // verbose is the captured output of the archiver programs used by ExtractVerbose.
+	checked  bool            // checked is true when the listing of the source archive was checked before the extraction.
 }
 
 // Extract the targets from the source file archive
@@ -363,21 +960,89 @@ type Extractor struct {
 // The required Filename string is used to determine the archive format.
 //
 // Some archive formats that could be impelmented if needed in the future,
-// "freearc", "zoo".
+// "freearc".
 func (x Extractor) Extract(targets ...string) error {
-	r, err := os.Open(x.Source)
+	if x.StripComponents > 0 || x.Rename != nil {
+		return x.extractMoved(targets...)
+	}
+	// the checks of the archive and destination are made once, as the extraction can be retried
+	if err := destWritable(x.Destination); err != nil {
+		return fmt.Errorf("extractor extract %w", err)
+	}
+	sign, err := signature(x.Source)
 	if err != nil {
-		return fmt.Errorf("extractor extract open %w", err)
+		return fmt.Errorf("extractor extract %w", err)
+	}
+	if err := x.inspect(sign); err != nil {
+		return fmt.Errorf("extractor extract %w", err)
+	}
+	existing := x.existingLinks()
+	if x.CaseInsensitive {
+		targets = x.matchTargets(targets...)
+	}
+	if x.SkipAppleDouble {
+		var ok bool
+		targets, ok, err = x.appleTargets(targets...)
+		if err != nil {
+			return fmt.Errorf("extractor extract %w", err)
+		}
+		if !ok {
+			return nil
+		}
+	}
+	err = x.extract(sign, targets...)
+	for attempt := range max(x.Retries, 0) {
+		if err == nil || !transient(err) {
+			break
+		}
+		delay := retryWait(attempt)
+		if !x.deadline.IsZero() && time.Now().Add(delay).After(x.deadline) {
+			break
+		}
+		if x.ctx != nil && x.ctx.Err() != nil {
+			break
+		}
+		time.Sleep(delay)
+		err = x.extract(sign, targets...)
 	}
-	defer r.Close()
-	sign, err := magicnumber.Archive(r)
 	if err != nil {
-		return fmt.Errorf("extractor extract magic %w", err)
+		if !x.ContinueOnError || x.ctx != nil && x.ctx.Err() != nil {
+			return err
+		}
+		_, err = x.extractEach(sign, err, targets...)
+	}
+	if ferr := x.finish(existing); ferr != nil {
+		if err == nil {
+			return ferr
+		}
+		return errors.Join(err, ferr)
 	}
+	return err
+}
+
+// finish applies the options that are used after the extraction to the destination directory,
+// which are the AllowLinks and RemoveLinks policies and AutoCharset.
+// The existing links are the symbolic links of the destination before the extraction.
+func (x Extractor) finish(existing map[string]string) error {
+	if err := x.links(existing); err != nil {
+		return err
+	}
+	if x.AutoCharset {
+		return x.autoCharset()
+	}
+	return nil
+}
+
+// extract is a single attempt at the extraction of the targets from the source file archive
+// of the sign file type signature.
+func (x Extractor) extract(sign magicnumber.Signature, targets ...string) error {
 	switch sign {
 	case
 		magicnumber.GzipCompressArchive:
 		if err := x.Bsdtar(targets...); err != nil {
+			if errors.Is(err, ErrSpecialFile) {
+				return err
+			}
 			return x.Gzip()
 		}
 		return nil
@@ -395,12 +1060,17 @@ func (x Extractor) Extract(targets ...string) error {
 		magicnumber.PKWAREZipReduce,
 		magicnumber.PKWAREZipImplode:
 		return x.extractZip(targets...)
+	case magicnumber.PKSFX:
+		return x.extractSFX(sign, targets...)
 	case
 		magicnumber.PKLITE,
-		magicnumber.PKSFX,
 		magicnumber.PKWAREMultiVolume:
 		return fmt.Errorf("%w, %s", ErrNotImplemented, sign)
 	case magicnumber.ARChiveSEA:
+		if PAK(x.Source) {
+			// the crushed and distilled methods that identify a PAK archive cannot be decompressed
+			return fmt.Errorf("%w, %s", ErrNotImplemented, "PAK crushed or distilled methods")
+		}
 		return x.ARC(targets...)
 	case magicnumber.ArchiveRobertJung:
 		return x.ARJ(targets...)
@@ -411,7 +1081,20 @@ func (x Extractor) Extract(targets ...string) error {
 		return x.Rar(targets...)
 	case magicnumber.X7zCompressArchive:
 		return x.Zip7(targets...)
+	case magicnumber.ZooArchive:
+		return x.Zoo(targets...)
 	case magicnumber.Unknown:
+		// the magic number does not match zip files using the WinZip AES method
+		if enc, _ := pkzip.EncryptionType(x.Source); enc == pkzip.AES {
+			return x.extractZip(targets...)
+		}
+		// the magic number does not match Amiga DMS disk images
+		if DMS(x.Source) {
+			return x.DMS()
+		}
+		if ext, _ := SFXFormat(x.Source); ext != "" {
+			return x.extractSFX(sign, targets...)
+		}
 		return fmt.Errorf("%w, %s", ErrNotArchive, sign)
 	default:
 		return fmt.Errorf("%w, %s", ErrNotImplemented, sign)
@@ -422,16 +1105,65 @@ func (x Extractor) Extract(targets ...string) error {
 // based on its compression method and the original operating system used to create it.
 // As some valid filenames set by MS-DOS codepages are not valid UTF-8 filenames.
 //
-// If the ZIP file uses a passphrase an error is returned.
+// If the ZIP file uses a passphrase and the Password is empty an error is returned.
+// WinZip AES encrypted files are not supported by the unzip program
+// and so return ErrEncrypted without attempting an extraction,
+// unless the Password is set, when the 7z program is used.
 func (x Extractor) extractZip(targets ...string) error {
-	if _, err := pkzip.Methods(x.Source); errors.Is(err, pkzip.ErrPassParse) {
+	if enc, _ := pkzip.EncryptionType(x.Source); enc == pkzip.AES {
+		if x.Password != "" {
+			// the 7z program supports the WinZip AES method
+			return x.Zip7(targets...)
+		}
+		return fmt.Errorf("archive zip extract %w: %s", ErrEncrypted, enc)
+	}
+	if _, err := pkzip.Methods(x.Source); errors.Is(err, pkzip.ErrPassParse) && x.Password == "" {
 		return fmt.Errorf("archive zip extract %w", err)
 	}
-	if err1 := x.Zip(targets...); err1 != nil {
-		if err2 := x.ZipHW(targets...); err2 != nil {
-			if err3 := x.Bsdtar(targets...); err3 != nil {
-				return fmt.Errorf("archive zip extract %w: %w: %w", err1, err2, err3)
-			}
+	// the unzip program ignores the UTF-8 flag of archives created on MS-DOS
+	native := zipUTF8(x.Source) && zipFAT(x.Source) && x.Password == ""
+	if native {
+		native, _ = pkzip.Zip(x.Source)
+	}
+	if native {
+		if err := x.extractZipUTF8(targets...); err != nil {
+			return err
+		}
+	} else if err1 := x.Zip(targets...); err1 != nil {
+		if errors.Is(err1, ErrWrongPassword) {
+			return fmt.Errorf("archive zip extract %w", err1)
+		}
+		if err := x.zipFallback(err1, targets...); err != nil {
+			return err
+		}
+	}
+	if x.PreserveModes {
+		if err := x.zipModes(); err != nil {
+			return fmt.Errorf("archive zip extract %w", err)
+		}
+	}
+	return nil
+}
+
+// zipFallback extracts the targets from the source zip archive using the other programs
+// after the unzip program failed with the err1 error.
+//
+// The hwzip and bsdtar programs read the local file headers, which do not store the sizes of
+// the files written with a data descriptor, so the extraction of the targets of these archives
+// uses the 7z program that reads the central directory, and a warning is written to the
+// standard error returned by ExtractVerbose.
+func (x Extractor) zipFallback(err1 error, targets ...string) error {
+	if streamed, _ := pkzip.Streamed(x.Source); streamed && len(targets) > 0 {
+		x.warn("archive: %s uses data descriptors, using %s to extract the targets",
+			filepath.Base(x.Source), command.Zip7)
+		if err2 := x.Zip7(targets...); err2 != nil {
+			return fmt.Errorf("archive zip extract %w: %w", err1, err2)
+		}
+		return nil
+	}
+	if err2 := x.ZipHW(targets...); err2 != nil {
+		if err3 := x.Bsdtar(targets...); err3 != nil {
+			return fmt.Errorf("archive zip extract %w: %w: %w", err1, err2, err3)
 		}
 	}
 	return nil
@@ -456,7 +1188,7 @@ func (x Extractor) Gzip() error {
 	}
 
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := x.context(TimeoutExtract)
 	defer cancel()
 	const (
 		decompress = "--decompress" // -d decompress
@@ -465,10 +1197,10 @@ func (x Extractor) Gzip() error {
 	)
 	args := []string{decompress, restore, overwrite, tmpFile}
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
 		if b.String() != "" {
-			return fmt.Errorf("archive gzip %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive gzip %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive gzip %w: %s", err, prog)
 	}
@@ -484,10 +1216,17 @@ func (x Extractor) Gzip() error {
 // gzip, bzip2, compress, xz, lzip, lzma, tar, iso9660, zip, ar, xar,
 // lha/lzh, rar, rar v5, Microsoft Cabinet, 7-zip.
 //
+// Tar archives that contain character device, block device or FIFO named pipe entries
+// are refused with ErrSpecialFile before bsdtar is run, as a privileged process
+// would otherwise create the device nodes.
+//
 // [bsdtar program]: https://man.freebsd.org/cgi/man.cgi?query=bsdtar&sektion=1&format=html
 // [libarchive library]: http://www.libarchive.org/
 func (x Extractor) Bsdtar(targets ...string) error {
 	src, dst := x.Source, x.Destination
+	if err := tarSpecial(src); err != nil {
+		return fmt.Errorf("archive tar extract %w", err)
+	}
 	prog, err := exec.LookPath("bsdtar")
 	if err != nil {
 		return fmt.Errorf("archive tar extract %w", err)
@@ -496,7 +1235,7 @@ func (x Extractor) Bsdtar(targets ...string) error {
 		return ErrDest
 	}
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := x.context(TimeoutExtract)
 	defer cancel()
 	// note: BSD tar uses different flags to GNU tar
 	const (
@@ -512,17 +1251,28 @@ func (x Extractor) Bsdtar(targets ...string) error {
 		noXattrs  = "--no-xattrs"           // --no-xattrs
 	)
 	args := []string{extract, source, src}
-	args = append(args, noAcls, noFlags, noSafeW, noModTime, noOwner, noPerms, noXattrs)
+	args = append(args, noAcls, noFlags, noSafeW, noOwner, noXattrs)
+	if !x.PreserveTimes {
+		args = append(args, noModTime)
+	}
+	if !x.PreserveModes {
+		args = append(args, noPerms)
+	}
 	args = append(args, targetDir, dst)
 	args = append(args, targets...)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
 		if b.String() != "" {
-			return fmt.Errorf("archive tar %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive tar %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive tar %w: %s", err, prog)
 	}
+	if x.PreserveModes {
+		if err := x.tarModes(); err != nil {
+			return fmt.Errorf("archive tar extract %w", err)
+		}
+	}
 	return nil
 }
 
@@ -531,45 +1281,45 @@ func (x Extractor) Bsdtar(targets ...string) error {
 // If the targets are empty then all files are extracted.
 //
 // ARC is a DOS era archive format that is not widely supported.
-// It also does not support extracting to a target directory.
-// To work around this, this copies the source archive
-// to the destination directory, uses that as the working directory
-// and extracts the files. The copied source archive is then removed.
+// It also does not support extracting to a target directory,
+// as Howard Chu's arc program has no output directory option and always
+// extracts to the working directory.
+// To work around this, this links the source archive into
+// the destination directory using a unique name, uses that as the working directory
+// and extracts the files. The linked source archive is then removed.
 //
 // [arc program]: https://arj.sourceforge.net/
 func (x Extractor) ARC(targets ...string) error {
 	src, dst := x.Source, x.Destination
-	if st, err := os.Stat(dst); err != nil {
-		return fmt.Errorf("%w: %s", err, dst)
-	} else if !st.IsDir() {
-		return fmt.Errorf("%w: %s", ErrPath, dst)
+	if err := destDir(dst); err != nil {
+		return err
 	}
 	prog, err := exec.LookPath(command.Arc)
 	if err != nil {
 		return fmt.Errorf("archive arc extract %w", err)
 	}
 
-	srcInDst := filepath.Join(dst, filepath.Base(src))
-	if _, err := helper.Duplicate(src, srcInDst); err != nil {
+	srcInDst, err := workingCopy(src, dst, filepath.Ext(src))
+	if err != nil {
 		return fmt.Errorf("archive arc duplicate %w", err)
 	}
 	defer os.Remove(srcInDst)
 
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDefunct)
+	ctx, cancel := x.context(TimeoutDefunct)
 	defer cancel()
 	const (
 		extract = "x" // x extract files
 	)
-	args := []string{extract, filepath.Base(src)}
+	args := []string{extract, filepath.Base(srcInDst)}
 	args = append(args, targets...)
 	cmd := exec.CommandContext(ctx, prog, args...)
 	cmd.Dir = dst
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
 		if b.String() != "" {
 			return fmt.Errorf("archive arc %w: %s: %q",
-				ErrProg, prog, strings.TrimSpace(b.String()))
+				ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive arc %w: %s", err, prog)
 	}
@@ -583,10 +1333,8 @@ func (x Extractor) ARC(targets ...string) error {
 // [arj program]: https://arj.sourceforge.net/
 func (x Extractor) ARJ(targets ...string) error {
 	src, dst := x.Source, x.Destination
-	if st, err := os.Stat(dst); err != nil {
-		return fmt.Errorf("%w: %s", err, dst)
-	} else if !st.IsDir() {
-		return fmt.Errorf("%w: %s", ErrPath, dst)
+	if err := destDir(dst); err != nil {
+		return err
 	}
 	// note: only use arj, as unarj offers limited functionality
 	prog, err := exec.LookPath(command.Arj)
@@ -602,7 +1350,7 @@ func (x Extractor) ARJ(targets ...string) error {
 		}
 	}
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDefunct)
+	ctx, cancel := x.context(TimeoutDefunct)
 	defer cancel()
 	// note: these flags are for arj32 v3.10
 	const (
@@ -614,12 +1362,12 @@ func (x Extractor) ARJ(targets ...string) error {
 	args = append(args, targets...)
 	args = append(args, targetDir+dst)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	defer os.Remove(srcWithExt)
 	if err = cmd.Run(); err != nil {
 		if b.String() != "" {
 			return fmt.Errorf("archive arj %w: %s: %q",
-				ErrProg, prog, strings.TrimSpace(b.String()))
+				ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive arj %w: %s", err, prog)
 	}
@@ -631,14 +1379,23 @@ func (x Extractor) ARJ(targets ...string) error {
 // If the targets are empty then all files are extracted.
 //
 // On Linux either the jlha-utils or lhasa work.
+// When neither is installed, the 7z program is used as a fallback.
+// The files are extracted without their directory paths unless KeepPaths is set.
 func (x Extractor) LHA(targets ...string) error {
 	src, dst := x.Source, x.Destination
 	prog, err := exec.LookPath(command.Lha)
 	if err != nil {
-		return fmt.Errorf("archive lha extract %w", err)
+		extract := "e" // e extract files without paths, matching the lha ignore paths option
+		if x.KeepPaths {
+			extract = "x" // x extract files with full paths
+		}
+		if err7 := x.zip7(extract, targets...); err7 != nil {
+			return fmt.Errorf("archive lha extract %w: %w", err, err7)
+		}
+		return nil
 	}
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDefunct)
+	ctx, cancel := x.context(TimeoutDefunct)
 	defer cancel()
 	// example command: lha -eq2w=destdir/ archive *
 	const (
@@ -648,19 +1405,28 @@ func (x Extractor) LHA(targets ...string) error {
 		quiet       = "q1"
 		quieter     = "q2"
 	)
-	param := fmt.Sprintf("-%s%s%sw=%s", extract, overwrite, ignorepaths, dst)
+	flags := extract + overwrite + ignorepaths
+	if x.KeepPaths {
+		flags = extract + overwrite
+	}
+	param := fmt.Sprintf("-%sw=%s", flags, dst)
 	args := []string{param, src}
 	args = append(args, targets...)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
-	out, err := cmd.Output()
-	if err != nil {
+	x.output(cmd, &b)
+	// the output is checked, so it is also kept when captured by ExtractVerbose
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if x.verbose != nil {
+		cmd.Stdout = io.MultiWriter(&out, &x.verbose.stdout)
+	}
+	if err := cmd.Run(); err != nil {
 		if b.String() != "" {
-			return fmt.Errorf("archive lha %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive lha %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive lha %w: %s", err, prog)
 	}
-	if len(out) == 0 {
+	if out.Len() == 0 {
 		return ErrRead
 	}
 	return nil
@@ -681,11 +1447,14 @@ func (x Extractor) Rar(targets ...string) error {
 	if err != nil {
 		return fmt.Errorf("archive unrar extract %w", err)
 	}
+	if err := rarSupport(x.ctx, prog, src); err != nil {
+		return fmt.Errorf("archive unrar extract %w", err)
+	}
 	if dst == "" {
 		return ErrDest
 	}
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := x.context(TimeoutExtract)
 	defer cancel()
 	const (
 		eXtract    = "x"   // x extract files with full path
@@ -694,15 +1463,23 @@ func (x Extractor) Rar(targets ...string) error {
 		rename     = "-or" // -or rename files automatically
 		yes        = "-y"  // -y assume yes to all queries
 		outputPath = "-op" // -op output path
+		password   = "-p"  // -p set the password
 	)
-	args := []string{eXtract, noPaths, noComments, rename, yes, src}
+	args := []string{eXtract, noPaths, noComments, rename, yes}
+	if x.Password != "" {
+		args = append(args, password+x.Password)
+	}
+	args = append(args, src)
 	args = append(args, targets...)
 	args = append(args, outputPath+dst)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
+		if wrongPassword(&b) {
+			return fmt.Errorf("archive unrar %w: %s", ErrWrongPassword, src)
+		}
 		if b.String() != "" {
-			return fmt.Errorf("archive unrar %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive unrar %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive unrar %w: %s", err, prog)
 	}
@@ -723,8 +1500,13 @@ func (x Extractor) Zip(targets ...string) error {
 	if dst == "" {
 		return ErrDest
 	}
+	src, remove, err := unspan(src)
+	if err != nil {
+		return fmt.Errorf("archive zip extract %w", err)
+	}
+	defer remove()
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := x.context(TimeoutExtract)
 	defer cancel()
 	// [-options]
 	const (
@@ -737,20 +1519,37 @@ func (x Extractor) Zip(targets ...string) error {
 		quieter         = "-qq" // quieter
 		targetDir       = "-d"  // target directory to extract files to
 		allowCtrlChars  = "-^"  // allow control characters in filenames
+		password        = "-P"  // use the password to decrypt the files
 	)
 	// unzip [-options] file[.zip] [file(s)...] [-x files(s)] [-d exdir]
 	// file[.zip]		path to the zip archive
 	// [file(s)...]		optional list of archived files to process, sep by spaces.
 	// [-x files(s)]	optional files to be excluded.
 	// [-d exdir]		optional target directory to extract files in.
-	args := []string{quieter, notimestamps, allowCtrlChars, overwrite, src}
+	args := []string{quieter}
+	if !x.PreserveTimes {
+		args = append(args, notimestamps)
+	}
+	if !x.StripControl {
+		args = append(args, allowCtrlChars)
+	}
+	if x.Password != "" {
+		args = append(args, password, x.Password)
+	}
+	args = append(args, overwrite, src)
 	args = append(args, targets...)
 	args = append(args, targetDir, dst)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
+		// unzip exits with 82 when no files were extracted due to bad passwords
+		const badPassword = 82
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && exit.ExitCode() == badPassword || wrongPassword(&b) {
+			return fmt.Errorf("archive zip %w: %s", ErrWrongPassword, src)
+		}
 		if b.String() != "" {
-			return fmt.Errorf("archive zip %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive zip %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive zip %w: %s", err, prog)
 	}
@@ -767,6 +1566,13 @@ func (x Extractor) Zip(targets ...string) error {
 //
 // [7z program]: https://www.7-zip.org/
 func (x Extractor) Zip7(targets ...string) error {
+	const extract = "x" // x extract files with full paths
+	return x.zip7(extract, targets...)
+}
+
+// zip7 extracts the targets from the source archive using the 7z program extract command,
+// which is either "x" to extract files with full paths or "e" to extract files without paths.
+func (x Extractor) zip7(extract string, targets ...string) error {
 	src, dst := x.Source, x.Destination
 	prog, err := exec.LookPath(command.Zip7)
 	if err != nil {
@@ -776,22 +1582,29 @@ func (x Extractor) Zip7(targets ...string) error {
 		return ErrDest
 	}
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExtract)
+	ctx, cancel := x.context(TimeoutExtract)
 	defer cancel()
 	const (
-		extract   = "x"    // x extract files without paths
 		overwrite = "-aoa" // -aoa overwrite all
 		quiet     = "-bb0" // -bb0 quiet
 		targetDir = "-o"   // -o output directory
 		yes       = "-y"   // -y assume yes to all queries
+		password  = "-p"   // -p set the password
 	)
-	args := []string{extract, overwrite, quiet, yes, targetDir + dst, src}
+	args := []string{extract, overwrite, quiet, yes, targetDir + dst}
+	if x.Password != "" {
+		args = append(args, password+x.Password)
+	}
+	args = append(args, src)
 	args = append(args, targets...)
 	cmd := exec.CommandContext(ctx, prog, args...)
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
+		if wrongPassword(&b) {
+			return fmt.Errorf("archive 7z %w: %s", ErrWrongPassword, src)
+		}
 		if b.String() != "" {
-			return fmt.Errorf("archive 7z %w: %s: %s", ErrProg, prog, strings.TrimSpace(b.String()))
+			return fmt.Errorf("archive 7z %w: %s: %s", ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive 7z %w: %s", err, prog)
 	}
@@ -805,46 +1618,111 @@ func (x Extractor) Zip7(targets ...string) error {
 // hwzip is used to handle DOS era, zip archive compression methods
 // that are not widely supported.
 // It also does not support extracting to a target directory.
-// To work around this, this copies the source archive
-// to the destination directory, uses that as the working directory
-// and extracts the files. The copied source archive is then removed.
+// To work around this, this links the source archive into
+// the destination directory using a unique name, uses that as the working directory
+// and extracts the files. The linked source archive is then removed.
 //
 // [arc program]: https://arj.sourceforge.net/
 func (x Extractor) ZipHW(targets ...string) error {
 	src, dst := x.Source, x.Destination
-	if st, err := os.Stat(dst); err != nil {
-		return fmt.Errorf("%w: %s", err, dst)
-	} else if !st.IsDir() {
-		return fmt.Errorf("%w: %s", ErrPath, dst)
+	if err := destDir(dst); err != nil {
+		return err
 	}
 	prog, err := exec.LookPath(command.HWZip)
 	if err != nil {
 		return fmt.Errorf("archive hwzip extract %w", err)
 	}
 
-	srcInDst := filepath.Join(dst, filepath.Base(src))
-	if _, err := helper.Duplicate(src, srcInDst); err != nil {
+	srcInDst, err := workingCopy(src, dst, filepath.Ext(src))
+	if err != nil {
 		return fmt.Errorf("archive hwzip duplicate %w", err)
 	}
 	defer os.Remove(srcInDst)
 
 	var b bytes.Buffer
-	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDefunct)
+	ctx, cancel := x.context(TimeoutDefunct)
 	defer cancel()
 	const (
 		extract = "extract" // x extract files
 	)
-	args := []string{extract, filepath.Base(src)}
+	args := []string{extract, filepath.Base(srcInDst)}
 	args = append(args, targets...)
 	cmd := exec.CommandContext(ctx, prog, args...)
 	cmd.Dir = dst
-	cmd.Stderr = &b
+	x.output(cmd, &b)
 	if err = cmd.Run(); err != nil {
 		if b.String() != "" {
 			return fmt.Errorf("archive arc %w: %s: %q",
-				ErrProg, prog, strings.TrimSpace(b.String()))
+				ErrProg, prog, stderr(&b))
 		}
 		return fmt.Errorf("archive arc %w: %s", err, prog)
 	}
 	return nil
 }
+
+// workingCopy hard links the src archive into the dst directory using a unique hidden name
+// with the ext extension, and returns the path of the link, for archiver programs that only
+// extract to the working directory. A hard link avoids copying the archive data, but the file is
+// copied when the file system of the destination does not support links. The unique name means
+// neither an archive member or an existing file of the destination can share the name of the copy.
+func workingCopy(src, dst, ext string) (string, error) {
+	f, err := os.CreateTemp(dst, ".archive-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	if err := os.Remove(name); err != nil {
+		return "", err
+	}
+	if err := os.Link(src, name); err == nil {
+		return name, nil
+	}
+	if err := copyNew(src, name); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// copyNew copies the src file to the dst file, which must not already exist.
+func copyNew(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// stderr returns the trimmed standard error output of an archiver program in b,
+// which is truncated to MaxStderr bytes for use in an error message.
+func stderr(b *bytes.Buffer) string {
+	s := strings.TrimSpace(b.String())
+	if MaxStderr <= 0 || len(s) <= MaxStderr {
+		return s
+	}
+	s = strings.ToValidUTF8(s[:MaxStderr], "")
+	return s + "…(truncated)"
+}
+
+// wrongPassword returns true if the standard error output of an archiver program in b
+// reports an incorrect password, such as "Wrong password" by 7z or
+// "The specified password is incorrect" by unrar.
+func wrongPassword(b *bytes.Buffer) bool {
+	s := strings.ToLower(b.String())
+	return strings.Contains(s, "wrong password") ||
+		strings.Contains(s, "incorrect password") ||
+		strings.Contains(s, "password is incorrect")
+}
@@ -1,13 +1,35 @@
 package archive_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/Defacto2/archive"
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/archive/pkzip"
 	"github.com/Defacto2/archive/rezip"
+	"github.com/Defacto2/magicnumber"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -91,3 +113,2940 @@ func TestUsage(t *testing.T) {
 	require.Error(t, err)
 	_ = os.Remove(dstComp)
 }
+
+func TestContentByRatio(t *testing.T) {
+	t.Parallel()
+
+	var c archive.Content
+	err := c.Zip("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Len(t, c.Files, 15)
+	require.Len(t, c.Entries, 15)
+
+	entries := c.ByRatio()
+	require.Len(t, entries, 15)
+	assert.Equal(t, "TEST.BMP", entries[0].Name)
+	assert.Equal(t, int64(750054), entries[0].Size)
+	assert.Equal(t, int64(2296), entries[0].CompressedSize)
+	for i := 1; i < len(entries); i++ {
+		assert.LessOrEqual(t, entries[i-1].Ratio(), entries[i].Ratio())
+	}
+	assert.Zero(t, archive.Entry{}.Ratio())
+
+	compressed, uncompressed := c.Sizes()
+	assert.Equal(t, int64(3245842), uncompressed)
+	assert.Less(t, compressed, uncompressed)
+	compressed, uncompressed = (&archive.Content{}).Sizes()
+	assert.Zero(t, compressed)
+	assert.Zero(t, uncompressed)
+}
+
+// arjHeader returns a minimal ARJ basic header with the flags, file type and name.
+func arjHeader(flags, fileType byte, name string) []byte {
+	const first = 30
+	h := make([]byte, first)
+	h[0] = first
+	h[4] = flags
+	h[6] = fileType
+	h = append(h, name...)
+	h = append(h, 0, 0) // name and comment terminators
+	b := []byte{0x60, 0xea, byte(len(h)), byte(len(h) >> 8)}
+	b = append(b, h...)
+	return append(b, 0, 0, 0, 0, 0, 0) // header crc and no extended headers
+}
+
+func TestARJVolumeInfo(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	const mainType, labelType, multiVolume = 2, 4, 0x04
+	end := []byte{0x60, 0xea, 0, 0}
+
+	name := filepath.Join(dir, "DISK.ARJ")
+	b := arjHeader(multiVolume, mainType, "DISK.ARJ")
+	b = append(b, arjHeader(0, labelType, "DEFACTO2")...)
+	b = append(b, end...)
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+	label, multi, err := archive.ARJVolumeInfo(name)
+	require.NoError(t, err)
+	assert.Equal(t, "DEFACTO2", label)
+	assert.True(t, multi)
+
+	name = filepath.Join(dir, "SINGLE.ARJ")
+	b = append(arjHeader(0, mainType, "SINGLE.ARJ"), end...)
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+	label, multi, err = archive.ARJVolumeInfo(name)
+	require.NoError(t, err)
+	assert.Empty(t, label)
+	assert.False(t, multi)
+
+	_, _, err = archive.ARJVolumeInfo("testdata/PKZ80A1.ZIP")
+	require.ErrorIs(t, err, archive.ErrNotArchive)
+}
+
+func TestReadmeDirectories(t *testing.T) {
+	t.Parallel()
+
+	name := archive.Readme("APP.ZIP", "", " ", "APP.NFO/", "README.TXT\\", "readme/", "FILE_ID.DIZ")
+	assert.Equal(t, "FILE_ID.DIZ", name)
+	name = archive.Readme("APP.ZIP", "", "docs/", "APP.TXT/")
+	assert.Empty(t, name)
+	name = archive.Executable("APP.ZIP", "APP.EXE/", "", "RUN.COM")
+	assert.Equal(t, "RUN.COM", name)
+}
+
+func TestContentClean(t *testing.T) {
+	t.Parallel()
+
+	c := archive.Content{
+		Files: []string{"README.TXT", "", "docs/", "DOCS\\", "readme.txt", " ", "docs/APP.EXE"},
+		Entries: []archive.Entry{
+			{Name: "README.TXT"}, {Name: "docs/"}, {Name: "ReadMe.Txt"}, {Name: "docs/APP.EXE"},
+		},
+	}
+	c.Clean()
+	assert.Equal(t, []string{"README.TXT", "docs/APP.EXE"}, c.Files)
+	require.Len(t, c.Entries, 2)
+	assert.Equal(t, "docs/APP.EXE", c.Entries[1].Name)
+}
+
+func TestNameMap(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	// a file in the destination that is not in the archive
+	require.NoError(t, os.WriteFile(filepath.Join(x.Destination, "EXISTING.TXT"), nil, 0o644))
+	require.NoError(t, x.Extract())
+	names := x.NameMap()
+	assert.Len(t, names, 15)
+	assert.Equal(t, "TEST.ANS", names["test.ans"])
+	assert.NotContains(t, names, "existing.txt")
+
+	x.Source = "testdata/TEST.EXE"
+	names = x.NameMap()
+	assert.Len(t, names, 16, "a source that cannot be listed includes every file")
+
+	x.Destination = ""
+	assert.Nil(t, x.NameMap())
+}
+
+func TestTimeoutScale(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, archive.TimeoutDefunct, archive.TimeoutScale(0))
+	assert.Equal(t, archive.TimeoutDefunct, archive.TimeoutScale(-1))
+	const mb = 1024 * 1024
+	assert.Equal(t, archive.TimeoutDefunct+10*time.Second, archive.TimeoutScale(20*mb))
+	assert.Equal(t, archive.TimeoutMax, archive.TimeoutScale(10000*mb))
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+		TimeoutFunc: archive.TimeoutScale,
+	}
+	require.NoError(t, x.Extract())
+}
+
+func TestMergeList(t *testing.T) {
+	t.Parallel()
+
+	files, err := archive.MergeList("testdata/PKZ204EX.ZIP", "testdata/PKZ110EI.ZIP", "testdata/missing.zip")
+	require.Error(t, err)
+	assert.Len(t, files, 15)
+	assert.Equal(t, "TEST.ANS", files[0])
+
+	merged, err := archive.MergeSources("testdata/PKZ204EX.ZIP", "testdata/PKZ110EI.ZIP")
+	require.NoError(t, err)
+	require.Len(t, merged, 15)
+	assert.Len(t, merged[0].Sources, 2)
+}
+
+func TestExtractAES(t *testing.T) {
+	t.Parallel()
+
+	// the file is stored using the WinZip AES method 99 and extra field 0x9901
+	x := archive.Extractor{Source: "testdata/AES.ZIP", Destination: t.TempDir()}
+	err := x.Extract()
+	require.ErrorIs(t, err, archive.ErrEncrypted)
+}
+
+func TestHeaderBytes(t *testing.T) {
+	t.Parallel()
+
+	p, err := archive.HeaderBytes("testdata/PKZ204EX.ZIP", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{'P', 'K', 0x3, 0x4}, p)
+
+	p, err = archive.HeaderBytes("testdata/PKZ204EX.ZIP", 0)
+	require.NoError(t, err)
+	assert.Empty(t, p)
+
+	_, err = archive.HeaderBytes("testdata/missing.zip", 4)
+	require.Error(t, err)
+
+	s, err := archive.DescribeHeader("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Contains(t, s, "magic number:")
+	assert.Contains(t, s, "zip version needed: 2.0")
+	assert.Contains(t, s, "header: 50 4b 03 04")
+}
+
+func TestLinkTarget(t *testing.T) {
+	t.Parallel()
+
+	var c archive.Content
+	err := c.Tar("testdata/SYMLINK.TAR")
+	require.NoError(t, err)
+	assert.Equal(t, "archive/tar", c.Tool)
+	assert.Equal(t, []string{"DOCS/README.TXT", "README.TXT"}, c.Files)
+	require.Len(t, c.Entries, 2)
+	assert.Empty(t, c.Entries[0].LinkTarget)
+	assert.Equal(t, int64(23), c.Entries[0].Size)
+	assert.Equal(t, "DOCS/README.TXT", c.Entries[1].LinkTarget)
+
+	name := filepath.Join(t.TempDir(), "SYMLINK.ZIP")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	fh := &zip.FileHeader{Name: "README.TXT"}
+	fh.SetMode(os.ModeSymlink | 0o777)
+	fw, err := w.CreateHeader(fh)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("DOCS/README.TXT"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	c = archive.Content{}
+	err = c.Zip(name)
+	require.NoError(t, err)
+	require.Len(t, c.Entries, 1)
+	assert.Equal(t, "DOCS/README.TXT", c.Entries[0].LinkTarget)
+}
+
+// writeZip creates the named zip file containing the files with their names as the content.
+func writeZip(t *testing.T, name string, files ...string) {
+	t.Helper()
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, file := range files {
+		fw, err := w.Create(file)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(file))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestExtractSourceStale(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "extractsourcestale.zip")
+	writeZip(t, name, "A.TXT", "B.TXT")
+	dst, err := archive.ExtractSource(name, "stale")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+	defer os.Remove(dst + ".stamp")
+	assert.FileExists(t, filepath.Join(dst, "A.TXT"))
+
+	// the modification time is changed as the file could be rewritten within the same tick
+	writeZip(t, name, "C.TXT", "D.TXT")
+	mod := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(name, mod, mod))
+	dst, err = archive.ExtractSource(name, "stale")
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dst, "A.TXT"))
+	assert.FileExists(t, filepath.Join(dst, "C.TXT"))
+}
+
+func TestContentPartial(t *testing.T) {
+	t.Parallel()
+
+	var c archive.Content
+	err := c.Zip("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.False(t, c.Partial)
+	assert.Equal(t, "zipinfo", c.Tool)
+
+	// truncate the central directory to damage the archive
+	b, err := os.ReadFile("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	const central = 800
+	name := filepath.Join(t.TempDir(), "DAMAGED.ZIP")
+	require.NoError(t, os.WriteFile(name, b[:len(b)-central], 0o600))
+
+	c = archive.Content{}
+	err = c.Zip(name)
+	require.NoError(t, err)
+	assert.True(t, c.Partial)
+	assert.Len(t, c.Files, 15)
+}
+
+func TestRarVersion(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rar4 := filepath.Join(dir, "RAR4.RAR")
+	require.NoError(t, os.WriteFile(rar4, []byte("Rar!\x1a\x07\x00\xcf\x90\x73"), 0o600))
+	rar5 := filepath.Join(dir, "RAR5.RAR")
+	require.NoError(t, os.WriteFile(rar5, []byte("Rar!\x1a\x07\x01\x00\x33\x92"), 0o600))
+
+	v, err := archive.RarVersion(rar4)
+	require.NoError(t, err)
+	assert.Equal(t, 4, v)
+	v, err = archive.RarVersion(rar5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, v)
+	_, err = archive.RarVersion("testdata/PKZ204EX.ZIP")
+	require.ErrorIs(t, err, archive.ErrNotArchive)
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	_, err := archive.Open("testdata/missing.zip")
+	require.Error(t, err)
+	_, err = archive.Open("testdata/TEST.EXE")
+	require.ErrorIs(t, err, archive.ErrNotArchive)
+
+	a, err := archive.Open("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	defer a.Close()
+	assert.Equal(t, ".zip", a.Ext())
+	assert.Len(t, a.Names(), 15)
+
+	e, found := a.Entry("test.ans")
+	require.True(t, found)
+	assert.Equal(t, "TEST.ANS", e.Name)
+	assert.Equal(t, int64(68), e.Size)
+	_, found = a.Entry("missing.txt")
+	assert.False(t, found)
+
+	b, err := a.ReadFile("TEST.ASC")
+	require.NoError(t, err)
+	assert.Len(t, b, 13)
+
+	dst := t.TempDir()
+	require.NoError(t, a.ExtractTo(dst, "TEST.DIZ"))
+	assert.FileExists(t, filepath.Join(dst, "TEST.DIZ"))
+	require.NoError(t, a.Close())
+
+	a, err = archive.Open("testdata/SYMLINK.TAR")
+	require.NoError(t, err)
+	defer a.Close()
+	b, err = a.ReadFile("docs/readme.txt")
+	require.NoError(t, err)
+	assert.Len(t, b, 23)
+	_, err = a.ReadFile("README.TXT")
+	require.ErrorIs(t, err, archive.ErrMissing, "a symbolic link is not followed")
+}
+
+func TestPreserveModes(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:        "testdata/UNIXMODE.ZIP",
+		Destination:   t.TempDir(),
+		PreserveModes: true,
+	}
+	require.NoError(t, x.Extract())
+	st, err := os.Stat(filepath.Join(x.Destination, "RUN.SH"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), st.Mode().Perm())
+	st, err = os.Stat(filepath.Join(x.Destination, "README.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), st.Mode().Perm())
+
+	// the setuid, setgid and sticky bits of a tar archive are not restored
+	src := filepath.Join(t.TempDir(), "SETUID.TAR")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := tar.NewWriter(f)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "SHARED/", Typeflag: tar.TypeDir, Mode: 0o1777}))
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "SHARED/RUN.SH", Size: 4, Mode: 0o6755}))
+	_, err = w.Write([]byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	x = archive.Extractor{Source: src, Destination: t.TempDir(), PreserveModes: true}
+	require.NoError(t, x.Extract())
+	st, err = os.Stat(filepath.Join(x.Destination, "SHARED", "RUN.SH"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), st.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
+	st, err = os.Stat(filepath.Join(x.Destination, "SHARED"))
+	require.NoError(t, err)
+	assert.Zero(t, st.Mode()&fs.ModeSticky)
+}
+
+func TestExtractWithManifest(t *testing.T) {
+	t.Parallel()
+
+	dst := t.TempDir()
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: dst,
+	}
+	require.ErrorIs(t, x.ExtractWithManifest(""), archive.ErrManifest)
+	path := filepath.Join(dst, "manifest.json")
+	require.NoError(t, x.ExtractWithManifest(path, "TEST.DIZ"))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var m archive.Manifest
+	require.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "PKZ204EX.ZIP", m.Source)
+	require.Len(t, m.Files, 1)
+	assert.Equal(t, "TEST.DIZ", m.Files[0].Path)
+	assert.Equal(t, int64(13), m.Files[0].Size)
+	assert.Len(t, m.Files[0].SHA256, 64)
+}
+
+func TestCountEntries(t *testing.T) {
+	t.Parallel()
+
+	n, err := archive.CountEntries("testdata/PKZ204EX.ZIP", "PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, 15, n)
+
+	n, err = archive.CountEntries("testdata/SYMLINK.TAR", "SYMLINK.TAR")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	_, err = archive.CountEntries("testdata/TEST.EXE", "TEST.EXE")
+	require.Error(t, err)
+
+	// a gzip compressed text file is not a tarball
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = "README.TXT"
+	_, err = zw.Write([]byte("not a tarball, just some text\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	src := filepath.Join(t.TempDir(), "README.TXT.GZ")
+	require.NoError(t, os.WriteFile(src, buf.Bytes(), 0o644))
+	n, err = archive.CountEntries(src, "README.TXT.GZ")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestDestReadOnly(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() == 0 {
+		t.Skip("the root user can write to read-only directories")
+	}
+	dst := t.TempDir()
+	require.NoError(t, os.Chmod(dst, 0o555))
+	defer os.Chmod(dst, 0o755)
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: dst,
+	}
+	require.ErrorIs(t, x.Extract(), archive.ErrDestReadOnly)
+	x.Destination = filepath.Join(dst, "missing")
+	require.ErrorIs(t, x.Extract(), archive.ErrDestReadOnly)
+}
+
+func TestMaxEntries(t *testing.T) {
+	limit := archive.MaxEntries
+	defer func() { archive.MaxEntries = limit }()
+
+	archive.MaxEntries = 10
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	require.ErrorIs(t, x.Extract(), archive.ErrTooMany)
+	entries, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = x.ExtractSalvage()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+	fsys := os.DirFS("testdata")
+	require.ErrorIs(t, archive.ExtractFromFS(fsys, "PKZ204EX.ZIP", x.Destination), archive.ErrTooMany)
+	entries, err = os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// an archive that cannot be listed is left for the archiver programs
+	x.Source = filepath.Join(t.TempDir(), "damaged.zip")
+	writeZip(t, x.Source, "FILE_ID.DIZ")
+	p, err := os.ReadFile(x.Source)
+	require.NoError(t, err)
+	// the end of central directory record claims a second entry that does not exist
+	const endLen = 22
+	p[len(p)-endLen+8], p[len(p)-endLen+10] = 2, 2
+	require.NoError(t, os.WriteFile(x.Source, p, 0o644))
+	_, err = pkzip.CentralDirectory(x.Source)
+	require.Error(t, err)
+	x.Destination = t.TempDir()
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "FILE_ID.DIZ"))
+
+	archive.MaxEntries = 0
+	x.Source = "testdata/PKZ204EX.ZIP"
+	require.NoError(t, x.Extract())
+}
+
+func TestExtractDeadline(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	err := x.ExtractDeadline(time.Now().Add(-time.Second))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, x.ExtractDeadline(time.Now().Add(time.Minute), "TEST.DIZ"))
+	assert.FileExists(t, filepath.Join(x.Destination, "TEST.DIZ"))
+}
+
+func TestEntryControl(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "control.zip")
+	writeZip(t, name, "README.TXT", "BAD\rNAME.TXT")
+	var c archive.Content
+	require.NoError(t, c.Zip(name))
+	require.Len(t, c.Entries, 2)
+	assert.False(t, c.Entries[0].Control())
+	assert.True(t, c.Entries[1].Control())
+	assert.Equal(t, "BAD\rNAME.TXT", c.Files[1])
+
+	x := archive.Extractor{
+		Source:       name,
+		Destination:  t.TempDir(),
+		StripControl: true,
+	}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "BADNAME.TXT"))
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	srcA, srcB := filepath.Join(dir, "diffa.zip"), filepath.Join(dir, "diffb.zip")
+	writeZip(t, srcA, "A.TXT", "B.TXT")
+	writeZip(t, srcB, "b.txt", "C.TXT")
+	onlyA, onlyB, both, err := archive.Diff(srcA, srcB)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A.TXT"}, onlyA)
+	assert.Equal(t, []string{"C.TXT"}, onlyB)
+	assert.Equal(t, []string{"B.TXT"}, both)
+
+	_, _, _, err = archive.Diff(srcA, "testdata/missing.zip")
+	require.Error(t, err)
+}
+
+func TestSameContents(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	srcA, srcB := filepath.Join(dir, "samea.zip"), filepath.Join(dir, "sameb.zip")
+	srcC, srcD := filepath.Join(dir, "samec.zip"), filepath.Join(dir, "samed.zip")
+	writeZip(t, srcA, "A.TXT", "B.TXT")
+	writeZip(t, srcB, "B.TXT", "A.TXT")
+	writeZip(t, srcC, "b.txt", "a.txt")
+	writeZip(t, srcD, "A.TXT")
+	for _, src := range []string{srcB, srcC} {
+		same, err := archive.SameContents(srcA, src)
+		require.NoError(t, err)
+		assert.True(t, same, src)
+	}
+	same, err := archive.SameContents(srcA, srcD)
+	require.NoError(t, err)
+	assert.False(t, same)
+
+	same, err = archive.SameContentsStrict(srcA, srcB)
+	require.NoError(t, err)
+	assert.True(t, same)
+	// the files of srcC have the same names and sizes but different content
+	same, err = archive.SameContentsStrict(srcA, srcC)
+	require.NoError(t, err)
+	assert.False(t, same)
+
+	_, err = archive.SameContents(srcA, "testdata/missing.zip")
+	require.Error(t, err)
+}
+
+func TestOpenFile(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	r, err := x.OpenFile("TEST.DIZ")
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, b, 13)
+	require.NoError(t, r.Close())
+
+	r, err = x.OpenFile("MISSING.TXT")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Error(t, r.Close())
+
+	x.Source = "testdata/SYMLINK.TAR"
+	r, err = x.OpenFile("DOCS/README.TXT")
+	require.NoError(t, err)
+	b, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, b, 23)
+	require.NoError(t, r.Close())
+
+	// close before the output is read
+	r, err = x.OpenFile("DOCS/README.TXT")
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+}
+
+func TestExtractToWriter(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	var buf bytes.Buffer
+	require.NoError(t, x.ExtractToWriter(&buf, "TEST.DIZ"))
+	assert.Equal(t, 13, buf.Len())
+
+	err := x.ExtractToWriter(io.Discard, "test.diz")
+	require.ErrorIs(t, err, archive.ErrMissing)
+	x.CaseInsensitive = true
+	buf.Reset()
+	require.NoError(t, x.ExtractToWriter(&buf, "test.diz"))
+	assert.Equal(t, 13, buf.Len())
+
+	err = x.ExtractToWriter(io.Discard, "MISSING.TXT")
+	require.ErrorIs(t, err, archive.ErrMissing)
+	require.NotErrorIs(t, err, archive.ErrProg)
+
+	x = archive.Extractor{Source: "testdata/SYMLINK.TAR"}
+	buf.Reset()
+	require.NoError(t, x.ExtractToWriter(&buf, "DOCS/README.TXT"))
+	assert.Equal(t, 23, buf.Len())
+}
+
+func TestDMS(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "DISK.DMS")
+	require.NoError(t, os.WriteFile(name, append([]byte("DMS!"), make([]byte, 52)...), 0o600))
+	assert.True(t, archive.DMS(name))
+	assert.False(t, archive.DMS("testdata/PKZ204EX.ZIP"))
+
+	_, err := archive.Open(name)
+	require.ErrorIs(t, err, archive.ErrNotImplemented)
+	if _, err := exec.LookPath(command.Xdms); err != nil {
+		x := archive.Extractor{Source: name, Destination: t.TempDir()}
+		require.ErrorIs(t, x.Extract(), archive.ErrNotImplemented)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/TEST.EXE",
+		Destination: t.TempDir(),
+		Retries:     3,
+	}
+	start := time.Now()
+	require.ErrorIs(t, x.Extract(), archive.ErrNotArchive)
+	assert.Less(t, time.Since(start), 200*time.Millisecond, "a non-transient error should not be retried")
+}
+
+func TestRetriesProgram(t *testing.T) {
+	// the fake bsdtar program on the PATH prevents the use of a parallel test
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar program is not installed")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "failed")
+	// the fake bsdtar fails with an I/O error on the first run and then runs the real program
+	script := "#!/bin/sh\n" +
+		"if [ ! -f " + marker + " ]; then\n" +
+		"touch " + marker + "\n" +
+		"echo 'bsdtar: Error reading archive: Input/output error' >&2\n" +
+		"exit 1\n" +
+		"fi\n" +
+		"exec " + bsdtar + " \"$@\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bsdtar"), []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	x := archive.Extractor{Source: "testdata/SYMLINK.TAR", Destination: t.TempDir()}
+	require.ErrorIs(t, x.Extract(), archive.ErrProg)
+	assert.NoFileExists(t, filepath.Join(x.Destination, "DOCS", "README.TXT"))
+
+	require.NoError(t, os.Remove(marker))
+	x.Retries = 1
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "DOCS", "README.TXT"))
+}
+
+func TestAppleDouble(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, archive.AppleDouble("__MACOSX/._README.TXT"))
+	assert.True(t, archive.AppleDouble("docs/._README.TXT"))
+	assert.False(t, archive.AppleDouble("docs/README.TXT"))
+	assert.False(t, archive.AppleDouble(""))
+
+	name := filepath.Join(t.TempDir(), "mac.zip")
+	writeZip(t, name, "README.TXT", "._README.TXT", "__MACOSX/._README.TXT")
+	var c archive.Content
+	require.NoError(t, c.Zip(name))
+	c.SkipAppleDouble()
+	assert.Equal(t, []string{"README.TXT"}, c.Files)
+
+	x := archive.Extractor{
+		Source:          name,
+		Destination:     t.TempDir(),
+		SkipAppleDouble: true,
+	}
+	require.NoError(t, x.Extract())
+	entries, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "README.TXT", entries[0].Name())
+
+	// existing AppleDouble files of the destination are kept
+	x.Destination = t.TempDir()
+	existing := filepath.Join(x.Destination, "._EXISTING")
+	require.NoError(t, os.WriteFile(existing, []byte("keep"), 0o644))
+	require.NoError(t, x.Extract("._README.TXT", "README.TXT"))
+	assert.FileExists(t, existing)
+	assert.FileExists(t, filepath.Join(x.Destination, "README.TXT"))
+	assert.NoFileExists(t, filepath.Join(x.Destination, "._README.TXT"))
+	assert.NoDirExists(t, filepath.Join(x.Destination, "__MACOSX"))
+}
+
+func TestTarLongName(t *testing.T) {
+	t.Parallel()
+
+	long := "LONGNAME/" + strings.Repeat("A", 60) + "/" + strings.Repeat("A", 60) + "/" +
+		strings.Repeat("B", 65) + ".TXT"
+	require.Len(t, long, 200)
+
+	// gnu tar stores long names in a ././@LongLink entry
+	var c archive.Content
+	require.NoError(t, c.Tar("testdata/LONGNAME.TAR"))
+	assert.Equal(t, []string{long}, c.Files)
+	assert.True(t, c.Entries[0].Modified.Equal(time.Unix(0, 0)))
+
+	// pax stores long names in an extended header
+	name := filepath.Join(t.TempDir(), "pax.tar")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := tar.NewWriter(f)
+	require.NoError(t, w.WriteHeader(&tar.Header{
+		Name: long, Size: 4, Mode: 0o644, Format: tar.FormatPAX,
+	}))
+	_, err = w.Write([]byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	c = archive.Content{}
+	require.NoError(t, c.Tar(name))
+	assert.Equal(t, []string{long}, c.Files)
+	n, err := archive.CountEntries(name, "pax.tar")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestExecutable(t *testing.T) {
+	t.Parallel()
+
+	name := archive.Executable("APP.ZIP", "SETUP.EXE", "APP.BAT", "RUN.COM", "README.TXT")
+	assert.Equal(t, "APP.BAT", name)
+	name = archive.Executable("APP.ZIP", "SETUP.EXE", "RUN.COM", "INSTALL.EXE")
+	assert.Equal(t, "INSTALL.EXE", name)
+	assert.Empty(t, archive.Executable("APP.ZIP", "README.TXT"))
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	path, err := x.ExtractExecutable()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(x.Destination, "TEST.EXE"), path)
+	assert.FileExists(t, path)
+
+	name = filepath.Join(t.TempDir(), "text.zip")
+	writeZip(t, name, "README.TXT")
+	x.Source = name
+	_, err = x.ExtractExecutable()
+	require.ErrorIs(t, err, archive.ErrRead)
+}
+
+func TestRecompress(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out.tar.gz")
+	require.NoError(t, archive.Recompress("testdata/PKZ204EX.ZIP", dest, "tar.gz"))
+	n, err := archive.CountEntries(dest, "out.tar.gz")
+	require.NoError(t, err)
+	assert.Positive(t, n)
+	require.Error(t, archive.Recompress("testdata/PKZ204EX.ZIP", dest, "tar.zst"))
+
+	dest = filepath.Join(dir, "out.zip")
+	require.NoError(t, archive.Recompress("testdata/PKZ204EX.ZIP", dest, "zip"))
+	n, err = archive.CountEntries(dest, "out.zip")
+	require.NoError(t, err)
+	assert.Equal(t, 15, n)
+
+	err = archive.Recompress("testdata/PKZ204EX.ZIP", filepath.Join(dir, "out.arj"), "arj")
+	require.ErrorIs(t, err, archive.ErrNotImplemented)
+}
+
+func TestSFXFormat(t *testing.T) {
+	t.Parallel()
+
+	ext, err := archive.SFXFormat("testdata/TEST.EXE")
+	require.NoError(t, err)
+	assert.Empty(t, ext)
+	ext, err = archive.SFXFormat("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Empty(t, ext)
+
+	// a self-extracting zip is a program stub followed by the zip archive
+	stub := append([]byte("MZ"), make([]byte, 510)...)
+	name := filepath.Join(t.TempDir(), "SFX.EXE")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write(stub)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	w.SetOffset(int64(len(stub)))
+	fw, err := w.Create("README.TXT")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("self-extracting"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	ext, err = archive.SFXFormat(name)
+	require.NoError(t, err)
+	assert.Equal(t, ".zip", ext)
+	x := archive.Extractor{Source: name, Destination: t.TempDir()}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "README.TXT"))
+}
+
+func TestExtractMap(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{Source: "testdata/SYMLINK.TAR"}
+	files, err := x.ExtractMap()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Len(t, files["DOCS/README.TXT"], 23)
+
+	x.Source = "testdata/PKZ204EX.ZIP"
+	files, err = x.ExtractMap()
+	require.NoError(t, err)
+	assert.Len(t, files, 15)
+	assert.Len(t, files["TEST.DIZ"], 13)
+
+	// the shrunk method is not supported by the standard library
+	x.Source = "testdata/PKZ80A1.ZIP"
+	files, err = x.ExtractMap()
+	require.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	// the size limits of the extractor are checked against the listing before the files are read
+	x.MaxTotalSize = 10
+	_, err = x.ExtractMap()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+	x.Source = "testdata/SYMLINK.TAR"
+	_, err = x.ExtractMap()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+}
+
+func TestMaxMapSize(t *testing.T) {
+	limit := archive.MaxMapSize
+	defer func() { archive.MaxMapSize = limit }()
+
+	archive.MaxMapSize = 100
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	_, err := x.ExtractMap()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+
+	archive.MaxMapSize = 10
+	x.Source = filepath.Join(t.TempDir(), "split.zip")
+	writeZip(t, x.Source, "NFO.001", "NFO.002")
+	_, err = x.ExtractJoined("NFO.*")
+	require.ErrorIs(t, err, archive.ErrTooMany)
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	require.Error(t, x.Extract("test.diz"))
+	x.CaseInsensitive = true
+	require.NoError(t, x.Extract("test.diz"))
+	assert.FileExists(t, filepath.Join(x.Destination, "TEST.DIZ"))
+}
+
+func TestEstimateExtractTime(t *testing.T) {
+	t.Parallel()
+
+	st, err := os.Stat("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	d, err := archive.EstimateExtractTime("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	rate := archive.Throughput[magicnumber.PKWAREZip]
+	assert.Equal(t, time.Duration(float64(st.Size())/float64(rate)*float64(time.Second)), d)
+
+	_, err = archive.EstimateExtractTime("testdata/missing.zip")
+	require.Error(t, err)
+}
+
+func TestOpenNested(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "INNER.ZIP")
+	writeZip(t, inner, "README.TXT")
+	b, err := os.ReadFile(inner)
+	require.NoError(t, err)
+	outer := filepath.Join(dir, "OUTER.ZIP")
+	f, err := os.Create(outer)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	fw, err := w.Create("DATA/INNER.ZIP")
+	require.NoError(t, err)
+	_, err = fw.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	x := archive.Extractor{Source: outer}
+	a, err := x.OpenNested("DATA/INNER.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"README.TXT"}, a.Names())
+	content, err := a.ReadFile("README.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "README.TXT", string(content))
+	require.NoError(t, a.Close())
+
+	_, err = x.OpenNested("MISSING.ZIP")
+	require.Error(t, err)
+}
+
+func TestExtractSince(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	// TEST.EXE is the only file modified after 2012
+	names, err := x.ExtractSince(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TEST.EXE"}, names)
+	assert.FileExists(t, filepath.Join(x.Destination, "TEST.EXE"))
+
+	names, err = x.ExtractSince(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestExtractByExt(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	paths, err := x.ExtractByExt("nfo", ".Txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(x.Destination, "TEST.NFO"),
+		filepath.Join(x.Destination, "TEST.TXT"),
+	}, paths)
+	files, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	paths, err = x.ExtractByExt(".xyz")
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestEntryMatchesFile(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	require.NoError(t, x.Extract("TEST.DIZ"))
+	path := filepath.Join(x.Destination, "TEST.DIZ")
+	match, err := x.EntryMatchesFile("TEST.DIZ", path)
+	require.NoError(t, err)
+	assert.True(t, match)
+	match, err = x.EntryMatchesFile("TEST.NFO", path)
+	require.NoError(t, err)
+	assert.False(t, match)
+	_, err = x.EntryMatchesFile("MISSING.TXT", path)
+	require.ErrorIs(t, err, archive.ErrMissing)
+
+	x.Source = "testdata/SYMLINK.TAR"
+	_, err = x.EntryMatchesFile("DOCS/README.TXT", path)
+	require.ErrorIs(t, err, archive.ErrChecksum)
+}
+
+func TestExtractList(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "extractlist.zip")
+	writeZip(t, src, "DISK3.IMG", "DISK1.IMG", "SUB/DISK2.IMG")
+	x := archive.Extractor{
+		Source:      src,
+		Destination: t.TempDir(),
+	}
+	paths, err := x.ExtractList()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(x.Destination, "DISK1.IMG"),
+		filepath.Join(x.Destination, "DISK3.IMG"),
+		filepath.Join(x.Destination, "SUB", "DISK2.IMG"),
+	}, paths)
+
+	x.Destination = t.TempDir()
+	x.ListOrder = true
+	paths, err = x.ExtractList()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(x.Destination, "DISK3.IMG"),
+		filepath.Join(x.Destination, "DISK1.IMG"),
+		filepath.Join(x.Destination, "SUB", "DISK2.IMG"),
+	}, paths)
+}
+
+func TestMagicExtVerbose(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("file"); err != nil {
+		_, out, err := archive.MagicExtVerbose("testdata/PKZ204EX.ZIP")
+		require.Error(t, err)
+		assert.Empty(t, out)
+		return
+	}
+	ext, out, err := archive.MagicExtVerbose("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, ".zip", ext)
+	assert.Contains(t, strings.ToLower(out), "zip archive data")
+
+	ext, out, err = archive.MagicExtVerbose("testdata/TEST.EXE")
+	require.ErrorIs(t, err, archive.ErrExt)
+	assert.Empty(t, ext)
+	assert.NotEmpty(t, out)
+}
+
+func TestEntryPoint(t *testing.T) {
+	t.Parallel()
+
+	name := archive.Launcher("APP.ZIP", "APP.EXE", "AUTOEXEC.BAT", "SETUP.EXE", "README.TXT")
+	assert.Equal(t, "SETUP.EXE", name)
+	name = archive.Launcher("APP.ZIP", "APP.EXE", "AUTOEXEC.BAT", "TOOL.COM")
+	assert.Equal(t, "AUTOEXEC.BAT", name)
+	name = archive.Launcher("APP.ZIP", "APP.EXE", "TOOL.COM")
+	assert.Equal(t, "APP.EXE", name)
+	name = archive.Launcher("APP.ZIP", "bin/game.exe", "README.TXT")
+	assert.Equal(t, "bin/game.exe", name)
+	assert.Empty(t, archive.Launcher("APP.ZIP", "GAME.EXE", "TOOL.COM"))
+	assert.Empty(t, archive.Launcher("APP.ZIP", "README.TXT"))
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	path, err := x.EntryPoint()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(x.Destination, "TEST.EXE"), path)
+	assert.FileExists(t, path)
+
+	name = filepath.Join(t.TempDir(), "text.zip")
+	writeZip(t, name, "GAME.EXE", "TOOL.COM")
+	x.Source = name
+	_, err = x.EntryPoint()
+	require.ErrorIs(t, err, archive.ErrRead)
+}
+
+func TestPreviewImage(t *testing.T) {
+	t.Parallel()
+
+	entries := func(names ...string) []archive.Entry {
+		es := make([]archive.Entry, len(names))
+		for i, name := range names {
+			es[i] = archive.Entry{Name: name, Size: int64(len(name))}
+		}
+		return es
+	}
+	name := archive.Preview("APP.ZIP", entries("APP.GIF", "shots/SCREEN1.PNG", "BIGGEST_IMAGE.JPG")...)
+	assert.Equal(t, "shots/SCREEN1.PNG", name)
+	name = archive.Preview("APP.ZIP", entries("LOGO.BMP", "APP.PCX", "DESCRIBE.LBM")...)
+	assert.Equal(t, "APP.PCX", name)
+	name = archive.Preview("APP.ZIP", entries("LOGO.BMP", "LONGER.GIF", "README.TXT")...)
+	assert.Equal(t, "LONGER.GIF", name)
+	assert.Empty(t, archive.Preview("APP.ZIP", entries("APP.EXE", "README.TXT")...))
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	path, err := x.PreviewImage()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(x.Destination, "TEST.BMP"), path)
+	assert.FileExists(t, path)
+
+	name = filepath.Join(t.TempDir(), "text.zip")
+	writeZip(t, name, "GAME.EXE", "README.TXT")
+	x.Source = name
+	_, err = x.PreviewImage()
+	require.ErrorIs(t, err, archive.ErrRead)
+}
+
+func TestContentGzip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "renamed.gz")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := gzip.NewWriter(f)
+	w.Name = "FILE_ID.DIZ"
+	w.ModTime = time.Date(1994, time.July, 15, 13, 45, 30, 0, time.UTC)
+	w.OS = 0 // FAT
+	_, err = w.Write([]byte("a short gzip compressed description"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	files, err := archive.List(name, "renamed.gz")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FILE_ID.DIZ"}, files)
+	var c archive.Content
+	require.NoError(t, c.Gzip(name))
+	require.Len(t, c.Entries, 1)
+	assert.Equal(t, int64(35), c.Entries[0].Size)
+	assert.Equal(t, w.ModTime, c.Entries[0].Modified)
+	assert.Equal(t, "FAT", c.Entries[0].SourceOS)
+
+	name = filepath.Join(dir, "NONAME.TXT.gz")
+	f, err = os.Create(name)
+	require.NoError(t, err)
+	w = gzip.NewWriter(f)
+	_, err = w.Write([]byte("no name"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	require.NoError(t, c.Gzip(name))
+	assert.Equal(t, []string{"NONAME.TXT"}, c.Files)
+	require.Len(t, c.Entries, 1)
+	assert.True(t, c.Entries[0].Modified.IsZero(), "an unset gzip mtime should not be the epoch")
+	assert.Empty(t, c.Entries[0].SourceOS, "the gzip writer defaults to the unknown system")
+}
+
+func TestRegisterMagic(t *testing.T) {
+	// the fake file program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Defacto2 Test Archive data, version 9 (GNU)'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, out, err := archive.MagicExtVerbose("testdata/PKZ204EX.ZIP")
+	require.ErrorIs(t, err, archive.ErrExt)
+	assert.Equal(t, "Defacto2 Test Archive data, version 9 (GNU)", out)
+
+	// the registered mappings are used for the file types that the magic numbers do not identify
+	archive.RegisterMagic("test archive", ".bad")
+	archive.RegisterMagic("TEST ARCHIVE", ".d2")
+	ext, err := archive.MagicExt("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, ".zip", ext)
+	unknown := filepath.Join(dir, "TEST.D2")
+	require.NoError(t, os.WriteFile(unknown, []byte("Defacto2 test archive"), 0o600))
+	ext, err = archive.MagicExt(unknown)
+	require.NoError(t, err)
+	assert.Equal(t, ".d2", ext)
+}
+
+func TestExtractJoined(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "split.zip")
+	writeZip(t, src, "NFO.002", "NFO.001", "README.TXT", "NFO.010", "NFO.003", "NFO.004",
+		"NFO.005", "NFO.006", "NFO.007", "NFO.008", "NFO.009")
+	x := archive.Extractor{Source: src}
+	b, err := x.ExtractJoined("nfo.*")
+	require.NoError(t, err)
+	assert.Equal(t, "NFO.001NFO.002NFO.003NFO.004NFO.005NFO.006NFO.007NFO.008NFO.009NFO.010", string(b))
+
+	_, err = x.ExtractJoined("*.DIZ")
+	require.ErrorIs(t, err, archive.ErrRead)
+
+	src = filepath.Join(dir, "gap.zip")
+	writeZip(t, src, "NFO.001", "NFO.003")
+	x.Source = src
+	_, err = x.ExtractJoined("NFO.*")
+	require.ErrorIs(t, err, archive.ErrSequence)
+
+	src = filepath.Join(dir, "first.zip")
+	writeZip(t, src, "NFO.002", "NFO.003")
+	x.Source = src
+	_, err = x.ExtractJoined("NFO.*")
+	require.ErrorIs(t, err, archive.ErrSequence)
+}
+
+func TestEntryAttributes(t *testing.T) {
+	t.Parallel()
+
+	var c archive.Content
+	require.NoError(t, c.Zip("testdata/PKZ204EX.ZIP"))
+	require.NotEmpty(t, c.Entries)
+	assert.Equal(t, "-rw-a--", c.Entries[0].Attributes)
+
+	require.NoError(t, c.Tar("testdata/SYMLINK.TAR"))
+	require.Len(t, c.Entries, 2)
+	assert.Equal(t, "-rw-r--r--", c.Entries[0].Attributes)
+	assert.Equal(t, "Lrwxrwxrwx", c.Entries[1].Attributes)
+}
+
+func TestAutoCharset(t *testing.T) {
+	t.Parallel()
+
+	const fat, ntfs = 0, 11
+	dir := t.TempDir()
+	for _, host := range []uint16{fat, ntfs} {
+		src := filepath.Join(dir, fmt.Sprintf("host%d.zip", host))
+		f, err := os.Create(src)
+		require.NoError(t, err)
+		w := zip.NewWriter(f)
+		for _, name := range []string{"M\x81LLER.TXT", "CAF\x82/MEN\x9a.TXT"} {
+			fw, err := w.CreateHeader(&zip.FileHeader{Name: name, NonUTF8: true, CreatorVersion: host << 8})
+			require.NoError(t, err)
+			_, err = fw.Write([]byte(name))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, f.Close())
+
+		x := archive.Extractor{
+			Source:      src,
+			Destination: t.TempDir(),
+			AutoCharset: true,
+		}
+		require.NoError(t, x.Extract())
+		assert.FileExists(t, filepath.Join(x.Destination, "MüLLER.TXT"), "host %d", host)
+		assert.FileExists(t, filepath.Join(x.Destination, "CAFé", "MENÜ.TXT"), "host %d", host)
+		names := x.NameMap()
+		assert.Equal(t, "MüLLER.TXT", names["müller.txt"], "host %d", host)
+		assert.Equal(t, "CAFé/MENÜ.TXT", names["café/menü.txt"], "host %d", host)
+	}
+}
+
+func TestListFast(t *testing.T) {
+	t.Parallel()
+
+	files, err := archive.ListFast("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	listed, err := archive.List("testdata/PKZ204EX.ZIP", "PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, listed, files)
+
+	files, err = archive.ListFast("testdata/SYMLINK.TAR")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DOCS/README.TXT", "README.TXT"}, files)
+
+	// other files fall back to List
+	files, err = archive.ListFast("testdata/TEST.EXE")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TEST.EXE"}, files)
+}
+
+func TestListSignature(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	defer f.Close()
+	sign, err := magicnumber.Archive(f)
+	require.NoError(t, err)
+	files, err := archive.ListSignature("testdata/PKZ204EX.ZIP", sign)
+	require.NoError(t, err)
+	listed, err := archive.ListFast("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, listed, files)
+
+	files, err = archive.ListSignature("testdata/SYMLINK.TAR", magicnumber.TapeARchive)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DOCS/README.TXT", "README.TXT"}, files)
+
+	_, err = archive.ListSignature("testdata/PKZ204EX.ZIP", magicnumber.TapeARchive)
+	require.Error(t, err, "the reader of the wrong signature should fail")
+	_, err = archive.ListSignature("testdata/TEST.EXE", magicnumber.Unknown)
+	require.ErrorIs(t, err, archive.ErrNotArchive)
+	_, err = archive.ListSignature("testdata/TEST.EXE", magicnumber.MicrosoftCABinet)
+	require.ErrorIs(t, err, archive.ErrNotImplemented)
+}
+
+// smallZips returns the paths of n small zip archives created in a temporary directory.
+func smallZips(b *testing.B, n int) []string {
+	b.Helper()
+	dir := b.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%04d.zip", i))
+		f, err := os.Create(paths[i])
+		require.NoError(b, err)
+		w := zip.NewWriter(f)
+		for _, name := range []string{"FILE_ID.DIZ", "README.TXT", "APP.EXE"} {
+			fw, err := w.Create(name)
+			require.NoError(b, err)
+			_, err = fw.Write([]byte(name))
+			require.NoError(b, err)
+		}
+		require.NoError(b, w.Close())
+		require.NoError(b, f.Close())
+	}
+	return paths
+}
+
+func BenchmarkListFast(b *testing.B) {
+	paths := smallZips(b, 1000)
+	b.ResetTimer()
+	for range b.N {
+		for _, path := range paths {
+			if _, err := archive.ListFast(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	paths := smallZips(b, 1000)
+	b.ResetTimer()
+	for range b.N {
+		for _, path := range paths {
+			if _, err := archive.List(path, filepath.Base(path)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestAllowLinks(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/SYMLINK.TAR",
+		Destination: t.TempDir(),
+	}
+	require.NoError(t, x.Extract())
+	target, err := os.Readlink(filepath.Join(x.Destination, "README.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "DOCS/README.TXT", target)
+
+	x.Destination = t.TempDir()
+	existing := filepath.Join(x.Destination, "EXISTING")
+	require.NoError(t, os.Symlink("/etc/passwd", existing))
+	x.RemoveLinks = true
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "DOCS", "README.TXT"))
+	assert.NoFileExists(t, filepath.Join(x.Destination, "README.TXT"))
+	target, err = os.Readlink(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/passwd", target)
+
+	x.Destination = t.TempDir()
+	x.AllowLinks = true
+	require.NoError(t, x.Extract())
+	target, err = os.Readlink(filepath.Join(x.Destination, "README.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "DOCS/README.TXT", target)
+
+	src := filepath.Join(t.TempDir(), "ESCAPE.TAR")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := tar.NewWriter(f)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "SAFE", Typeflag: tar.TypeSymlink, Linkname: "DIR/../FILE"}))
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "PARENT", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"}))
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "ABS", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}))
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	x.Source = src
+	x.Destination = t.TempDir()
+	require.ErrorIs(t, x.Extract(), archive.ErrTraversal)
+	_, err = os.Lstat(filepath.Join(x.Destination, "SAFE"))
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(x.Destination, "PARENT"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Lstat(filepath.Join(x.Destination, "ABS"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestExtractExcludingNames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "disk2.zip")
+	writeZip(t, src, "FILE_ID.DIZ", "DATA.002", "Readme.txt")
+	x := archive.Extractor{
+		Source:      src,
+		Destination: t.TempDir(),
+	}
+	seen := map[string]bool{"file_id.diz": true, "readme.txt": true, "data.001": true}
+	names, err := x.ExtractExcludingNames(seen)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DATA.002"}, names)
+	assert.FileExists(t, filepath.Join(x.Destination, "DATA.002"))
+	assert.NoFileExists(t, filepath.Join(x.Destination, "FILE_ID.DIZ"))
+	assert.Len(t, seen, 3)
+
+	seen["data.002"] = true
+	names, err = x.ExtractExcludingNames(seen)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestSpanned(t *testing.T) {
+	t.Parallel()
+
+	const src = "testdata/PK00.ZIP"
+	want := []string{"FILE_ID.DIZ", "TEST.TXT"}
+	var c archive.Content
+	require.NoError(t, c.Zip(src))
+	assert.Equal(t, want, c.Files)
+	assert.False(t, c.Partial)
+
+	files, err := archive.ListFast(src)
+	require.NoError(t, err)
+	assert.Equal(t, want, files)
+	files, err = archive.List(src, "PK00.ZIP")
+	require.NoError(t, err)
+	assert.Equal(t, want, files)
+
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	require.NoError(t, x.Extract())
+	b, err := os.ReadFile(filepath.Join(x.Destination, "TEST.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "spanning marker test file TEST.TXT\r\n", string(b))
+}
+
+func TestPrimaryType(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	category, err := x.PrimaryType()
+	require.NoError(t, err)
+	assert.Equal(t, archive.Image, category)
+
+	dir := t.TempDir()
+	x.Source = filepath.Join(dir, "music.zip")
+	writeZip(t, x.Source, "PLAYER.EXE", "SONG1.MOD", "SONG2.S3M", "SONG3.XM", "README.TXT")
+	category, err = x.PrimaryType()
+	require.NoError(t, err)
+	assert.Equal(t, archive.Music, category)
+
+	x.Source = filepath.Join(dir, "unknown.zip")
+	writeZip(t, x.Source, "DATA.BIN")
+	_, err = x.PrimaryType()
+	require.ErrorIs(t, err, archive.ErrRead)
+}
+
+func TestExtractVerbose(t *testing.T) {
+	t.Parallel()
+
+	x := archive.Extractor{
+		Source:      "testdata/PKZ204EX.ZIP",
+		Destination: t.TempDir(),
+	}
+	_, stderr, err := x.ExtractVerbose()
+	require.NoError(t, err)
+	assert.Empty(t, stderr)
+
+	// corrupt the stored data of the file to cause a CRC error
+	name := filepath.Join(t.TempDir(), "badcrc.zip")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	fw, err := w.CreateHeader(&zip.FileHeader{Name: "TEST.TXT", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("checksum"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	i := strings.Index(string(b), "checksum")
+	require.Positive(t, i)
+	b[i] = 'C'
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+
+	x.Source = name
+	x.Destination = t.TempDir()
+	stdout, stderr, err := x.ExtractVerbose()
+	require.Error(t, err)
+	assert.Contains(t, stdout+stderr, "bad CRC")
+}
+
+func TestSevenZipInfo(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath(command.Zip7); err != nil {
+		_, err := archive.SevenZipInfo("testdata/PKZ204EX.ZIP")
+		require.Error(t, err)
+		return
+	}
+	name := filepath.Join(t.TempDir(), "PKZ204EX.7z")
+	require.NoError(t, archive.Recompress("testdata/PKZ204EX.ZIP", name, "7z"))
+	props, err := archive.SevenZipInfo(name)
+	require.NoError(t, err)
+	assert.Contains(t, props.Method, "LZMA")
+	assert.Positive(t, props.PhysicalSize)
+	assert.False(t, props.Encrypted)
+	assert.False(t, props.HeaderEncrypted)
+}
+
+func TestZip7HeaderEncrypted(t *testing.T) {
+	// the fake 7z program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Enter password (will not be echoed):'\n" +
+		"echo 'ERROR: SECRET.7z : Cannot open encrypted archive. Wrong password?' >&2\nexit 2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Zip7), []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var c archive.Content
+	err := c.Zip7("testdata/PKZ204EX.ZIP")
+	require.ErrorIs(t, err, archive.ErrEncrypted)
+	props, err := archive.SevenZipInfo("testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.True(t, props.HeaderEncrypted)
+}
+
+func TestContentFallback(t *testing.T) {
+	// the fake file and 7z programs on the PATH prevent the use of a parallel test
+	dir := t.TempDir()
+	file := "#!/bin/sh\necho 'ARJ archive data, v11, slash-switched, original name: DISK.ARJ, os: MS-DOS'\n"
+	zip7 := "#!/bin/sh\nprintf -- '--\\nPath = DISK.ARJ\\nType = Arj\\n\\n----------\\n" +
+		"Path = README.TXT\\nFolder = -\\nSize = 14\\nPacked Size = 12\\n\\n'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(file), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Zip7), []byte(zip7), 0o700))
+	empty := filepath.Join(dir, command.Arj)
+	require.NoError(t, os.WriteFile(empty, []byte("#!/bin/sh\nexit 0\n"), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// the magic numbers do not identify the file, so the fake file program is used
+	src := filepath.Join(dir, "DISK.ARJ")
+	require.NoError(t, os.WriteFile(src, []byte("damaged arj archive"), 0o600))
+
+	var c archive.Content
+	require.Error(t, c.Read(src))
+
+	c = archive.Content{Fallback: true}
+	require.NoError(t, c.Read(src))
+	assert.Equal(t, []string{"README.TXT"}, c.Files)
+	assert.Equal(t, ".arj", c.Ext)
+	assert.Equal(t, command.Zip7, c.Tool)
+}
+
+func TestStripComponents(t *testing.T) {
+	t.Parallel()
+
+	zipped := func(names ...string) string {
+		name := filepath.Join(t.TempDir(), "wrapped.zip")
+		f, err := os.Create(name)
+		require.NoError(t, err)
+		w := zip.NewWriter(f)
+		for _, name := range names {
+			fw, err := w.Create(name)
+			require.NoError(t, err)
+			_, err = fw.Write([]byte(name))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, f.Close())
+		return name
+	}
+	x := archive.Extractor{
+		Source:          zipped("release/README.TXT", "release/DOCS/INFO.TXT", "TOP.TXT"),
+		Destination:     t.TempDir(),
+		StripComponents: 1,
+	}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "README.TXT"))
+	assert.FileExists(t, filepath.Join(x.Destination, "DOCS", "INFO.TXT"))
+	assert.NoFileExists(t, filepath.Join(x.Destination, "TOP.TXT"))
+	files, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	x.Source = zipped("one/README.TXT", "two/README.TXT")
+	x.Destination = t.TempDir()
+	err = x.Extract()
+	require.ErrorIs(t, err, archive.ErrCollision)
+	files, err = os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+// arcCRC16 returns the CRC-16 checksum of p used by ARC and PAK archives.
+func arcCRC16(p []byte) uint16 {
+	sum := uint16(0)
+	for _, b := range p {
+		sum ^= uint16(b)
+		for range 8 {
+			if sum&1 != 0 {
+				sum = sum>>1 ^ 0xa001
+			} else {
+				sum >>= 1
+			}
+		}
+	}
+	return sum
+}
+
+// arcAdd appends an ARC file header of the method and name to buf,
+// followed by the compressed data of the orig file.
+func arcAdd(buf []byte, method byte, name string, data, orig []byte) []byte {
+	h := make([]byte, 29)
+	copy(h, name)
+	binary.LittleEndian.PutUint32(h[13:], uint32(len(data)))
+	binary.LittleEndian.PutUint16(h[17:], 0x1c4f) // 15 Feb 1994
+	binary.LittleEndian.PutUint16(h[21:], arcCRC16(orig))
+	binary.LittleEndian.PutUint32(h[25:], uint32(len(orig)))
+	buf = append(buf, 0x1a, method)
+	buf = append(buf, h...)
+	return append(buf, data...)
+}
+
+func TestARCFile(t *testing.T) {
+	t.Parallel()
+
+	var buf []byte
+	buf = arcAdd(buf, 2, "STORED.TXT", []byte("stored"), []byte("stored"))
+	buf = arcAdd(buf, 3, "PACKED.TXT", []byte{'Z', 0x90, 5, 0x90, 0}, []byte{'Z', 'Z', 'Z', 'Z', 'Z', 0x90})
+	// the squeeze tree encodes A as 0, B as 10 and the end of file as 11
+	squeezed := []byte{2, 0, 0xbe, 0xff, 1, 0, 0xbd, 0xff, 0xff, 0xfe, 0x34}
+	buf = arcAdd(buf, 4, "SQUEEZED.TXT", squeezed, []byte("AAB"))
+	buf = arcAdd(buf, 8, "CRUNCHED.TXT", []byte{0}, []byte("crunched"))
+	buf = append(buf, 0x1a, 0)
+	src := filepath.Join(t.TempDir(), "TEST.ARC")
+	require.NoError(t, os.WriteFile(src, buf, 0o600))
+
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	for name, want := range map[string]string{
+		"stored.txt":   "stored",
+		"PACKED.TXT":   "ZZZZZ\x90",
+		"SQUEEZED.TXT": "AAB",
+	} {
+		path, err := x.ARCFile(name)
+		require.NoError(t, err, name)
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(b), name)
+		st, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1994, st.ModTime().UTC().Year())
+	}
+	_, err := x.ARCFile("MISSING.TXT")
+	require.ErrorIs(t, err, archive.ErrMissing)
+}
+
+func TestExtractFromFS(t *testing.T) {
+	t.Parallel()
+
+	zipped, err := os.ReadFile("testdata/PK00.ZIP")
+	require.NoError(t, err)
+	var tarred strings.Builder
+	tw := tar.NewWriter(&tarred)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "DOCS/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "DOCS/README.TXT", Size: 5, Mode: 0o644}))
+	_, err = tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Flush())
+	// the tar archive without the escaping member is ended by two empty blocks
+	docs := tarred.String() + strings.Repeat("\x00", 1024)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../ESCAPE.TXT", Size: 1, Mode: 0o644}))
+	_, err = tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	fsys := fstest.MapFS{
+		"files/PK00.ZIP":   {Data: zipped},
+		"files/DOCS.TAR":   {Data: []byte(docs)},
+		"files/ESCAPE.TAR": {Data: []byte(tarred.String())},
+		"files/NOTES.TXT":  {Data: []byte("not an archive")},
+	}
+
+	dst := t.TempDir()
+	require.NoError(t, archive.ExtractFromFS(fsys, "files/PK00.ZIP", dst))
+	assert.FileExists(t, filepath.Join(dst, "FILE_ID.DIZ"))
+	assert.FileExists(t, filepath.Join(dst, "TEST.TXT"))
+
+	dst = filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, os.Mkdir(dst, 0o755))
+	require.NoError(t, archive.ExtractFromFS(fsys, "files/DOCS.TAR", dst))
+	b, err := os.ReadFile(filepath.Join(dst, "DOCS", "README.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	// the members are checked before any file is written, the same as Extract
+	dst = filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, os.Mkdir(dst, 0o755))
+	require.ErrorIs(t, archive.ExtractFromFS(fsys, "files/ESCAPE.TAR", dst), archive.ErrTraversal)
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(dst), "ESCAPE.TXT"))
+	assert.NoDirExists(t, filepath.Join(dst, "DOCS"))
+
+	require.Error(t, archive.ExtractFromFS(fsys, "files/NOTES.TXT", t.TempDir()))
+	require.Error(t, archive.ExtractFromFS(fsys, "files/MISSING.ZIP", t.TempDir()))
+}
+
+func TestStripComponentsLinks(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "links.tar")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "top/FILE.TXT", Size: 5, Mode: 0o644}))
+	_, err = tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	for name, target := range map[string]string{
+		"top/SAFE":     "FILE.TXT",
+		"top/ESCAPE":   "../x",
+		"top/sub/LINK": "../FILE.TXT",
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name, Linkname: target, Typeflag: tar.TypeSymlink, Mode: 0o777,
+		}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	// the relative links resolve inside the temporary directory, but not once they are moved
+	for _, allow := range []bool{false, true} {
+		x := archive.Extractor{
+			Source:          src,
+			Destination:     t.TempDir(),
+			StripComponents: 1,
+			AllowLinks:      allow,
+		}
+		err = x.Extract()
+		require.ErrorIs(t, err, archive.ErrTraversal)
+		assert.Contains(t, err.Error(), "ESCAPE")
+		_, err = os.Lstat(filepath.Join(x.Destination, "ESCAPE"))
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		b, err := os.ReadFile(filepath.Join(x.Destination, "SAFE"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+		b, err = os.ReadFile(filepath.Join(x.Destination, "sub", "LINK"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+	}
+
+	// the rename changes the depth of the link, so its target escapes the destination
+	x := archive.Extractor{
+		Source:      src,
+		Destination: t.TempDir(),
+		Rename: func(original string) string {
+			if original == "top/sub/LINK" {
+				return "LINK"
+			}
+			return ""
+		},
+	}
+	err = x.Extract()
+	require.ErrorIs(t, err, archive.ErrTraversal)
+	_, err = os.Lstat(filepath.Join(x.Destination, "LINK"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestExtractRename(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "rename.zip")
+	writeZip(t, src, "DOCS/README.TXT", "FILE_ID.DIZ", "SKIP.BAK")
+	x := archive.Extractor{
+		Source:      src,
+		Destination: t.TempDir(),
+		Rename: func(original string) string {
+			if strings.HasSuffix(original, ".BAK") {
+				return ""
+			}
+			return strings.ToLower(original)
+		},
+	}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "docs", "readme.txt"))
+	assert.FileExists(t, filepath.Join(x.Destination, "file_id.diz"))
+	files, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	x.Destination = t.TempDir()
+	x.Rename = func(string) string { return "SAME.TXT" }
+	require.ErrorIs(t, x.Extract(), archive.ErrCollision)
+
+	x.Destination = t.TempDir()
+	x.Rename = func(original string) string { return "../" + original }
+	require.ErrorIs(t, x.Extract(), archive.ErrRename)
+}
+
+func TestLHAKeepPaths(t *testing.T) {
+	t.Parallel()
+
+	_, errLha := exec.LookPath(command.Lha)
+	_, err7 := exec.LookPath(command.Zip7)
+	if errLha != nil && err7 != nil {
+		t.Skip("neither the lha or 7z programs are installed")
+	}
+	// the level 2 archive contains a DOCS directory, a README.TXT file within it,
+	// a FILE_ID.DIZ file and an ESCAPE symbolic link to a file outside of the destination
+	x := archive.Extractor{
+		Source:      "testdata/LEVEL2.LZH",
+		Destination: t.TempDir(),
+		KeepPaths:   true,
+	}
+	require.NoError(t, x.Extract())
+	assert.DirExists(t, filepath.Join(x.Destination, "DOCS"))
+	assert.FileExists(t, filepath.Join(x.Destination, "DOCS", "README.TXT"))
+	assert.FileExists(t, filepath.Join(x.Destination, "FILE_ID.DIZ"))
+	_, err := os.Lstat(filepath.Join(x.Destination, "ESCAPE"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	x.Destination = t.TempDir()
+	x.KeepPaths = false
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "README.TXT"))
+	assert.NoDirExists(t, filepath.Join(x.Destination, "DOCS"))
+}
+
+func TestZip7Match(t *testing.T) {
+	// the fake 7z program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	zip7 := "#!/bin/sh\necho \"$@\" > '" + args + "'\nfor arg in \"$@\"; do\n" +
+		"  case \"$arg\" in\n" +
+		"    -o*) dst=\"${arg#-o}\" ;;\n" +
+		"    '-ir!*.nfo') mkdir -p \"$dst/sub\" && echo nfo > \"$dst/sub/GROUP.NFO\" && exit 0 ;;\n" +
+		"    '-ir!*.lnk') ln -s /etc/passwd \"$dst/ESCAPE.LNK\" && exit 0 ;;\n" +
+		"  esac\ndone\necho 'No files to process'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Zip7), []byte(zip7), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP", Destination: t.TempDir()}
+	require.NoError(t, x.Zip7Match("*.nfo"))
+	assert.FileExists(t, filepath.Join(x.Destination, "sub", "GROUP.NFO"))
+	b, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "-p")
+
+	x.Password = "secret"
+	require.NoError(t, x.Zip7Match("*.nfo"))
+	b, err = os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "-psecret")
+	x.Password = ""
+
+	x.AllowLinks = true
+	require.ErrorIs(t, x.Zip7Match("*.lnk"), archive.ErrTraversal)
+	_, err = os.Lstat(filepath.Join(x.Destination, "ESCAPE.LNK"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	x.AllowLinks = false
+
+	require.NoError(t, os.Remove(args))
+	x.MaxTotalSize = 1
+	require.ErrorIs(t, x.Zip7Match("*.nfo"), archive.ErrTooMany)
+	assert.NoFileExists(t, args, "the limits are checked before the program is run")
+	x.MaxTotalSize = 0
+
+	require.ErrorIs(t, x.Zip7Match("*.diz"), archive.ErrMissing)
+	require.ErrorIs(t, x.Zip7Match(), archive.ErrPattern)
+	require.ErrorIs(t, x.Zip7Match(""), archive.ErrPattern)
+	require.ErrorIs(t, x.Zip7Match("../*.nfo"), archive.ErrPattern)
+	require.ErrorIs(t, x.Zip7Match("/etc/*"), archive.ErrPattern)
+}
+
+func TestStreamTar(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "stream.zip")
+	writeZip(t, src, "DOCS/README.TXT", "FILE_ID.DIZ")
+	var b strings.Builder
+	x := archive.Extractor{Source: src}
+	require.NoError(t, x.StreamTar(&b))
+
+	tr := tar.NewReader(strings.NewReader(b.String()))
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		p, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(p)
+	}
+	assert.Equal(t, map[string]string{
+		"DOCS/":           "",
+		"DOCS/README.TXT": "DOCS/README.TXT",
+		"FILE_ID.DIZ":     "FILE_ID.DIZ",
+	}, files)
+
+	x.Source = "testdata/missing.zip"
+	require.Error(t, x.StreamTar(io.Discard))
+}
+
+func TestZipUTF8Flag(t *testing.T) {
+	t.Parallel()
+
+	const fat = 0
+	names := []string{"CAFÉ/MENÜ.TXT", "NAÏVE.TXT"}
+	src := filepath.Join(t.TempDir(), "utf8.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range names {
+		// the writer sets the language encoding flag for the non-ASCII names
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, CreatorVersion: fat << 8})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	var c archive.Content
+	require.NoError(t, c.Zip(src))
+	assert.Equal(t, names, c.Files)
+
+	x := archive.Extractor{
+		Source:      src,
+		Destination: t.TempDir(),
+		AutoCharset: true,
+	}
+	require.NoError(t, x.Extract())
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(x.Destination, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, name, string(b))
+	}
+}
+
+func TestZipUTF8Links(t *testing.T) {
+	t.Parallel()
+
+	// the first file is created on MS-DOS, so the zip is extracted without the unzip program
+	src := filepath.Join(t.TempDir(), "links.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	add := func(fh *zip.FileHeader, content string) {
+		fw, err := w.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	add(&zip.FileHeader{Name: "CAFÉ.TXT"}, "café")
+	mode := &zip.FileHeader{Name: "MODÉ.TXT"}
+	mode.SetMode(0o4600)
+	add(mode, "mode")
+	link := &zip.FileHeader{Name: "LIÉN"}
+	link.SetMode(os.ModeSymlink | 0o777)
+	add(link, "CAFÉ.TXT")
+	escape := &zip.FileHeader{Name: "ÉSCAPE"}
+	escape.SetMode(os.ModeSymlink | 0o777)
+	add(escape, "../x")
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	x := archive.Extractor{Source: src, Destination: t.TempDir(), PreserveModes: true}
+	require.NoError(t, x.Extract())
+	target, err := os.Readlink(filepath.Join(x.Destination, "LIÉN"))
+	require.NoError(t, err)
+	assert.Equal(t, "CAFÉ.TXT", target)
+	st, err := os.Stat(filepath.Join(x.Destination, "MODÉ.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), st.Mode(), "the setuid bit is never restored")
+
+	x = archive.Extractor{Source: src, Destination: t.TempDir(), RemoveLinks: true}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(x.Destination, "CAFÉ.TXT"))
+	_, err = os.Lstat(filepath.Join(x.Destination, "LIÉN"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	x = archive.Extractor{Source: src, Destination: t.TempDir(), AllowLinks: true}
+	require.ErrorIs(t, x.Extract(), archive.ErrTraversal)
+	_, err = os.Lstat(filepath.Join(x.Destination, "LIÉN"))
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(x.Destination, "ÉSCAPE"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestChanged(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "changed.zip")
+	writeZip(t, src, "DOCS/README.TXT", "FILE_ID.DIZ", "NEW.TXT", "SAME.TXT")
+	ref := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(ref, "DOCS"), 0o755))
+	// writeZip uses the names of the files as their content
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(ref, filepath.FromSlash(name)), []byte(content), 0o600))
+	}
+	write("DOCS/README.TXT", "DOCS/README.TXT")
+	write("FILE_ID.DIZ", "file_id.diz")
+	write("SAME.TXT", "a longer file")
+
+	x := archive.Extractor{Source: src}
+	names, err := x.Changed(ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"NEW.TXT", "SAME.TXT"}, names)
+
+	names, err = x.ChangedCRC(ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FILE_ID.DIZ", "NEW.TXT", "SAME.TXT"}, names)
+
+	_, err = x.Changed(filepath.Join(ref, "missing"))
+	require.Error(t, err)
+}
+
+func TestListPage(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"A.TXT", "B.TXT", "C.TXT", "D.TXT", "E.TXT"}
+	src := filepath.Join(t.TempDir(), "page.zip")
+	writeZip(t, src, names...)
+	tarball := filepath.Join(t.TempDir(), "page.tar")
+	f, err := os.Create(tarball)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "DIR/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	for _, src := range []string{src, tarball} {
+		page, total, err := archive.ListPage(src, filepath.Base(src), 0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"A.TXT", "B.TXT"}, page)
+		assert.Equal(t, 5, total)
+		page, total, err = archive.ListPage(src, filepath.Base(src), 4, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"E.TXT"}, page)
+		assert.Equal(t, 5, total)
+		page, _, err = archive.ListPage(src, filepath.Base(src), 10, 2)
+		require.NoError(t, err)
+		assert.Empty(t, page)
+	}
+	_, _, err = archive.ListPage(src, "page.zip", -1, 2)
+	require.ErrorIs(t, err, archive.ErrPage)
+}
+
+func TestMatchesManifest(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "manifest.zip")
+	writeZip(t, src, "DOCS/README.TXT", "FILE_ID.DIZ")
+	// writeZip uses the names of the files as their content
+	expected := []archive.ManifestEntry{
+		{Name: "DOCS/README.TXT", Size: 15, CRC32: crc32.ChecksumIEEE([]byte("DOCS/README.TXT"))},
+		{Name: "file_id.diz", Size: 11},
+	}
+	x := archive.Extractor{Source: src}
+	ok, diffs, err := x.MatchesManifest(expected)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, diffs)
+
+	expected = []archive.ManifestEntry{
+		{Name: "DOCS/README.TXT", Size: 15, CRC32: 1},
+		{Name: "FILE_ID.DIZ", Size: 12},
+		{Name: "MISSING.TXT", Size: 1},
+	}
+	ok, diffs, err = x.MatchesManifest(expected)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.Len(t, diffs, 3)
+	assert.Contains(t, diffs[0], "crc: DOCS/README.TXT")
+	assert.Equal(t, "size: FILE_ID.DIZ is 11 bytes, expected 12", diffs[1])
+	assert.Equal(t, "missing: MISSING.TXT", diffs[2])
+
+	ok, diffs, err = x.MatchesManifest(nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"unexpected: DOCS/README.TXT", "unexpected: FILE_ID.DIZ"}, diffs)
+}
+
+func TestMaxStderr(t *testing.T) {
+	// the fake unzip program on the PATH and the changed MaxStderr prevent the use of a parallel test
+	dir := t.TempDir()
+	unzip := "#!/bin/sh\nhead -c 10000 /dev/zero | tr '\\0' 'x' >&2\nexit 9\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Unzip), []byte(unzip), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP", Destination: t.TempDir()}
+	err := x.Zip()
+	require.ErrorIs(t, err, archive.ErrProg)
+	assert.Contains(t, err.Error(), strings.Repeat("x", archive.MaxStderr)+"…(truncated)")
+	assert.NotContains(t, err.Error(), strings.Repeat("x", archive.MaxStderr+1))
+
+	defer func(n int) { archive.MaxStderr = n }(archive.MaxStderr)
+	archive.MaxStderr = 0
+	err = x.Zip()
+	require.ErrorIs(t, err, archive.ErrProg)
+	assert.Contains(t, err.Error(), strings.Repeat("x", 10000))
+}
+
+func TestExtractCAS(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	store := filepath.Join(tmp, "store")
+	a, b := filepath.Join(tmp, "a.zip"), filepath.Join(tmp, "b.zip")
+	// writeZip uses the names of the files as their content
+	writeZip(t, a, "FILE_ID.DIZ", "README.TXT")
+	writeZip(t, b, "FILE_ID.DIZ")
+
+	x := archive.Extractor{Source: a}
+	index, err := x.ExtractCAS(store)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("FILE_ID.DIZ"))
+	diz := hex.EncodeToString(sum[:])
+	require.Len(t, index, 2)
+	assert.Equal(t, diz, index["FILE_ID.DIZ"])
+	p := archive.CASPath(store, diz)
+	assert.Equal(t, filepath.Join(store, diz[:2], diz[2:]), p)
+	body, err := os.ReadFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, "FILE_ID.DIZ", string(body))
+
+	x = archive.Extractor{Source: b}
+	index, err = x.ExtractCAS(store)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"FILE_ID.DIZ": diz}, index)
+	dirs, err := os.ReadDir(store)
+	require.NoError(t, err)
+	assert.Len(t, dirs, 2, "the identical files should share a stored path and the temporary directory removed")
+}
+
+func TestSpecialFile(t *testing.T) {
+	t.Parallel()
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: "testdata/DEVICE.TAR", Destination: dst}
+	err := x.Extract()
+	require.ErrorIs(t, err, archive.ErrSpecialFile)
+	assert.Contains(t, err.Error(), "dev/null")
+	files, err := os.ReadDir(dst)
+	require.NoError(t, err)
+	assert.Empty(t, files, "nothing should be extracted from the refused archive")
+
+	b, err := os.ReadFile("testdata/DEVICE.TAR")
+	require.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "DEVICE.TAR.GZ")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := gzip.NewWriter(f)
+	_, err = w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	x.Source = name
+	require.ErrorIs(t, x.Extract(), archive.ErrSpecialFile)
+
+	x.Source = "testdata/SYMLINK.TAR"
+	require.NotErrorIs(t, x.Extract(), archive.ErrSpecialFile)
+}
+
+func TestMagicReader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{"testdata/PKZ204EX.ZIP", ".zip"},
+		{"testdata/SYMLINK.TAR", ".tar"},
+		{"testdata/LEVEL2.LZH", ".lha"},
+	}
+	for _, tt := range tests {
+		b, err := os.ReadFile(tt.name)
+		require.NoError(t, err)
+		ext, err := archive.MagicReader(bytes.NewReader(b))
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.ext, ext, tt.name)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte("gzip compressed data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	ext, err := archive.MagicReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, ".tar.gz", ext)
+
+	_, err = archive.MagicReader(strings.NewReader("plain text"))
+	require.ErrorIs(t, err, archive.ErrExt)
+	_, err = archive.MagicReader(strings.NewReader(""))
+	require.ErrorIs(t, err, archive.ErrRead)
+}
+
+func TestANSI(t *testing.T) {
+	t.Parallel()
+
+	art := []byte("\x1b[0;1;33mDEFACTO2\x1b[0m presents\r\n\x1b[2J\xdb\xb2 done\x1b")
+	assert.True(t, archive.HasANSI(art))
+	assert.Equal(t, []byte("DEFACTO2 presents\r\n\xdb\xb2 done\x1b"), archive.StripANSI(art))
+
+	plain := []byte("a plain text nfo with a lone \x1b escape")
+	assert.False(t, archive.HasANSI(plain))
+	assert.Equal(t, plain, archive.StripANSI(plain))
+	assert.False(t, archive.HasANSI([]byte("incomplete \x1b[1;3")))
+	assert.Equal(t, []byte("incomplete "), archive.StripANSI([]byte("incomplete \x1b[1;3")))
+	assert.Empty(t, archive.StripANSI(nil))
+
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	var buf bytes.Buffer
+	require.NoError(t, x.ExtractToWriter(&buf, "TEST.TXT"))
+	assert.False(t, archive.HasANSI(buf.Bytes()))
+	buf.Reset()
+	require.NoError(t, x.ExtractToWriter(&buf, "TEST.ANS"))
+	assert.True(t, archive.HasANSI(buf.Bytes()))
+	assert.Equal(t, []byte("This is a test \x7f\x7f ANSI DOCUMENT!\n"), archive.StripANSI(buf.Bytes()))
+}
+
+func TestEntriesModified(t *testing.T) {
+	// the fake arj and 7z programs on the PATH prevent the use of a parallel test
+	dir := t.TempDir()
+	arj := "#!/bin/sh\nprintf '" +
+		"Sequence/Pos   Size     Compressed Ratio  DateTime modified Attributes/GUA BPMGS\\n" +
+		"------------ ---------- ---------- ----- ----------------- -------------- -----\\n" +
+		"001) README.TXT\\n" +
+		" 11 MS-DOS            68         62 0.912 25-02-14 13:21:10                  1\\n" +
+		"002) FILE_ID.DIZ\\n" +
+		" 11 MS-DOS            13         13 1.000 94-07-15 01:02:03                  1\\n'\n"
+	zip7 := "#!/bin/sh\nprintf -- '--\\nPath = DISK.7Z\\nType = 7z\\n\\n----------\\n" +
+		"Path = README.TXT\\nFolder = -\\nSize = 14\\nPacked Size = \\nModified = 2012-09-19 14:21:52.1234567\\n\\n" +
+		"Path = FILE_ID.DIZ\\nFolder = -\\nSize = 13\\nPacked Size = \\nModified = \\n\\n'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Arj), []byte(arj), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Zip7), []byte(zip7), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	src := filepath.Join(t.TempDir(), "DISK")
+	require.NoError(t, os.WriteFile(src, nil, 0o600))
+
+	var c archive.Content
+	require.NoError(t, c.ARJ(src))
+	assert.Equal(t, []string{"README.TXT", "FILE_ID.DIZ"}, c.Files)
+	require.Len(t, c.Entries, 2)
+	assert.Equal(t, time.Date(2025, time.February, 14, 13, 21, 10, 0, time.UTC), c.Entries[0].Modified)
+	assert.Equal(t, time.Date(1994, time.July, 15, 1, 2, 3, 0, time.UTC), c.Entries[1].Modified)
+	assert.Equal(t, int64(62), c.Entries[0].CompressedSize)
+
+	c = archive.Content{}
+	require.NoError(t, c.Zip7(src))
+	require.Len(t, c.Entries, 2)
+	assert.Equal(t, int64(14), c.Entries[0].Size)
+	assert.Zero(t, c.Entries[0].CompressedSize)
+	assert.True(t, time.Date(2012, time.September, 19, 14, 21, 52, 123456700, time.UTC).Equal(c.Entries[0].Modified))
+	assert.True(t, c.Entries[1].Modified.IsZero())
+}
+
+func TestExtractPassword(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("zip"); err != nil {
+		t.Skip("the zip program is required to create an encrypted archive")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "SECRET.TXT"), []byte("hello"), 0o600))
+	cmd := exec.Command("zip", "-q", "-P", "defacto2", "enc.zip", "SECRET.TXT")
+	cmd.Dir = dir
+	require.NoError(t, cmd.Run())
+	src := filepath.Join(dir, "enc.zip")
+
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	require.ErrorIs(t, x.Extract(), pkzip.ErrPassParse)
+
+	x.Password = "wrong"
+	require.ErrorIs(t, x.Extract(), archive.ErrWrongPassword)
+
+	x.Password = "defacto2"
+	require.NoError(t, x.Extract())
+	b, err := os.ReadFile(filepath.Join(x.Destination, "SECRET.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
+
+func TestZipStreamedFallback(t *testing.T) {
+	// the fake unzip and 7z programs on the PATH prevent the use of a parallel test
+	dir := t.TempDir()
+	unzip := "#!/bin/sh\necho 'unzip failed' >&2\nexit 3\n"
+	zip7 := "#!/bin/sh\nfor a in \"$@\"; do case \"$a\" in -o*) d=\"${a#-o}\";; esac; done\n" +
+		"echo 7z > \"$d/A.TXT\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Unzip), []byte(unzip), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Zip7), []byte(zip7), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the zip writer uses data descriptors for the created files
+	src := filepath.Join(t.TempDir(), "streamed.zip")
+	writeZip(t, src, "A.TXT", "B.TXT")
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	_, stderr, err := x.ExtractVerbose("A.TXT")
+	require.NoError(t, err)
+	assert.Contains(t, stderr, "streamed.zip uses data descriptors")
+	b, err := os.ReadFile(filepath.Join(x.Destination, "A.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "7z\n", string(b))
+}
+
+func TestTranscode(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "source.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	mod := time.Date(1994, time.July, 15, 13, 45, 30, 0, time.UTC)
+	for _, name := range []string{"DOCS/README.TXT", "FILE_ID.DIZ"} {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		fh.ModifiedDate, fh.ModifiedTime = pkzip.DosDateTime(mod)
+		fw, err := w.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	dest := filepath.Join(t.TempDir(), "dest.zip")
+	require.NoError(t, archive.Transcode(src, dest, archive.TranscodeOptions{}))
+	r, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer r.Close()
+	files := map[string]time.Time{}
+	for _, f := range r.File {
+		files[f.Name] = f.Modified
+	}
+	require.Len(t, files, 3)
+	assert.Contains(t, files, "DOCS/")
+	for _, name := range []string{"DOCS/README.TXT", "FILE_ID.DIZ"} {
+		require.Contains(t, files, name)
+		assert.Equal(t, mod.Format(time.DateTime), files[name].Format(time.DateTime), name)
+	}
+
+	err = archive.Transcode(src, dest, archive.TranscodeOptions{})
+	require.ErrorIs(t, err, fs.ErrExist)
+}
+
+func TestZipEntryCRC32(t *testing.T) {
+	t.Parallel()
+
+	var c archive.Content
+	require.NoError(t, c.Zip("testdata/PKZ204EX.ZIP"))
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP"}
+	var buf bytes.Buffer
+	require.NoError(t, x.ExtractToWriter(&buf, "TEST.DIZ"))
+	i := slices.Index(c.Files, "TEST.DIZ")
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, crc32.ChecksumIEEE(buf.Bytes()), c.Entries[i].CRC32)
+
+	// the directory entry has no checksum, which must not misalign the other entries
+	src := filepath.Join(t.TempDir(), "dirs.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	_, err = w.Create("DOCS/")
+	require.NoError(t, err)
+	for _, name := range []string{"DOCS/README.TXT", "FILE_ID.DIZ"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	c = archive.Content{}
+	require.NoError(t, c.Zip(src))
+	crcs := map[string]uint32{}
+	for _, e := range c.Entries {
+		crcs[e.Name] = e.CRC32
+	}
+	assert.Equal(t, crc32.ChecksumIEEE([]byte("DOCS/README.TXT")), crcs["DOCS/README.TXT"])
+	assert.Equal(t, crc32.ChecksumIEEE([]byte("FILE_ID.DIZ")), crcs["FILE_ID.DIZ"])
+}
+
+func TestExtractContext(t *testing.T) {
+	// the fake unzip program on the PATH prevents the use of a parallel test
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	x := archive.Extractor{Source: "testdata/PKZ204EX.ZIP", Destination: t.TempDir()}
+	require.ErrorIs(t, x.ExtractContext(ctx), context.Canceled)
+	_, err := archive.ListContext(ctx, "testdata/PKZ204EX.ZIP", "PKZ204EX.ZIP")
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, x.ExtractContext(context.Background(), "TEST.DIZ"))
+	assert.FileExists(t, filepath.Join(x.Destination, "TEST.DIZ"))
+
+	dir := t.TempDir()
+	unzip := "#!/bin/sh\nexec sleep 10\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Unzip), []byte(unzip), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = x.ExtractContext(ctx, "TEST.TXT")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// the listing of the archive before the extraction is also stopped
+	require.NoError(t, os.WriteFile(filepath.Join(dir, command.Unrar), []byte(unzip), 0o700))
+	x.Source = filepath.Join(dir, "TEST.RAR")
+	require.NoError(t, os.WriteFile(x.Source, []byte("Rar!\x1a\x07\x00\x00\x00\x00\x00\x00\x00"), 0o600))
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	require.ErrorIs(t, x.ExtractContext(ctx), archive.ErrRead)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestARCWorkingCopy(t *testing.T) {
+	// the fake arc program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	// the fake arc extracts a member with the same name as the source archive
+	script := "#!/bin/sh\n[ -f \"$2\" ] || exit 1\necho member > SAMPLE.ARC\n"
+	prog := filepath.Join(dir, command.Arc)
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	src := filepath.Join(t.TempDir(), "SAMPLE.ARC")
+	require.NoError(t, os.WriteFile(src, []byte("archive"), 0o644))
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	require.NoError(t, x.ARC())
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	assert.Equal(t, "archive", string(b))
+	b, err = os.ReadFile(filepath.Join(x.Destination, "SAMPLE.ARC"))
+	require.NoError(t, err)
+	assert.Equal(t, "member\n", string(b))
+	entries, err := os.ReadDir(x.Destination)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestARCNote(t *testing.T) {
+	// the fake arc program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	table := "Name          Length    Stowage    SF   Size now  Date       Time    CRC\\n" +
+		"============  ========  ========  ====  ========  =========  ======  ====\\n" +
+		"TEST.TXT            14  Stored      0%%        14  14 Feb 25   1:21p  7a2c\\n" +
+		"FILE_ID.DIZ        300  Crunched   40%%       180  15 Jul 94  11:02a  1b3f\\n" +
+		"        ====  ========  ====  ========\\n" +
+		"Total      2       314   38%%       194\\n"
+	prog := filepath.Join(dir, command.Arc)
+	require.NoError(t, os.WriteFile(prog, []byte("#!/bin/sh\nprintf '"+table+"'\n"), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var c archive.Content
+	s, err := c.ARCNote(filepath.Join(dir, "NOTE.ARC"))
+	require.NoError(t, err)
+	assert.Empty(t, s)
+
+	note := "Call the Defacto2 BBS\\n  300 baud\\n"
+	require.NoError(t, os.WriteFile(prog, []byte("#!/bin/sh\nprintf '"+table+note+"'\n"), 0o700))
+	s, err = c.ARCNote(filepath.Join(dir, "NOTE.ARC"))
+	require.NoError(t, err)
+	assert.Equal(t, "Call the Defacto2 BBS\n  300 baud", s)
+}
+
+func TestExtractSalvage(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "damaged.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"A.TXT", "B.TXT", "C.TXT"} {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(strings.Repeat(name, 10)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	// damage the stored content of B.TXT so its checksum no longer matches
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	i := bytes.LastIndex(b, []byte("B.TXTB.TXT"))
+	require.Positive(t, i)
+	copy(b[i:], "XXXXX")
+	require.NoError(t, os.WriteFile(src, b, 0o600))
+
+	x := archive.Extractor{Source: src, Destination: t.TempDir()}
+	require.Error(t, x.Extract())
+
+	x = archive.Extractor{Source: src, Destination: t.TempDir(), ContinueOnError: true}
+	names, err := x.ExtractSalvage()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "B.TXT")
+	assert.Equal(t, []string{"A.TXT", "C.TXT"}, names)
+	assert.FileExists(t, filepath.Join(x.Destination, "A.TXT"))
+	assert.FileExists(t, filepath.Join(x.Destination, "C.TXT"))
+
+	x.Destination = t.TempDir()
+	err = x.Extract()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "B.TXT")
+	assert.FileExists(t, filepath.Join(x.Destination, "C.TXT"))
+}
+
+func TestSafePaths(t *testing.T) {
+	t.Parallel()
+
+	tarball := func(names ...string) string {
+		name := filepath.Join(t.TempDir(), "SLIP.TAR")
+		f, err := os.Create(name)
+		require.NoError(t, err)
+		w := tar.NewWriter(f)
+		for _, n := range names {
+			require.NoError(t, w.WriteHeader(&tar.Header{Name: n, Size: 4, Mode: 0o644}))
+			_, err = w.Write([]byte("test"))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, f.Close())
+		return name
+	}
+	for _, slip := range []string{"../../evil.txt", "dir/../../evil.txt", "/tmp/evil.txt", `C:\evil.txt`} {
+		dst := t.TempDir()
+		x := archive.Extractor{Source: tarball("README.TXT", slip), Destination: dst}
+		err := x.Extract()
+		require.ErrorIs(t, err, archive.ErrTraversal, slip)
+		assert.Contains(t, err.Error(), slip)
+		_, err = x.ExtractSalvage()
+		require.ErrorIs(t, err, archive.ErrTraversal, slip)
+		files, err := os.ReadDir(dst)
+		require.NoError(t, err)
+		assert.Empty(t, files, "nothing should be extracted from the refused archive")
+	}
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: tarball("README.TXT", "./dir/FILE.TXT"), Destination: dst}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(dst, "dir", "FILE.TXT"))
+
+	x = archive.Extractor{Source: tarball("README.TXT", "../evil.txt"), Destination: dst, UnsafePaths: true}
+	require.NotErrorIs(t, x.Extract(), archive.ErrTraversal)
+}
+
+func TestSafePathsDirectory(t *testing.T) {
+	// the fake zoo program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	list := "       0   0%%        0  20 May 92 16:57:26+1   ../evil/\n" +
+		"    2680  56%%     1189  20 May 92 16:57:26+1   24mhzhck.txt\n"
+	script := "#!/bin/sh\ncase \"$1\" in\n" +
+		"l) printf '" + list + "' ;;\n" +
+		"xO) mkdir -p ../evil ;;\n" +
+		"esac\nexit 0\n"
+	prog := filepath.Join(dir, command.Zoo)
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the directory entry is removed from the listing, but it is still checked before the extraction
+	var c archive.Content
+	require.NoError(t, c.Zoo("testdata/TEST.ZOO"))
+	assert.Equal(t, []string{"24mhzhck.txt"}, c.Files)
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, os.Mkdir(dst, 0o755))
+	x := archive.Extractor{Source: "testdata/TEST.ZOO", Destination: dst}
+	require.ErrorIs(t, x.Extract(), archive.ErrTraversal)
+	assert.NoDirExists(t, filepath.Join(filepath.Dir(dst), "evil"))
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "BOMB.ZIP")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	fw, err := w.Create("ZEROS.BIN")
+	require.NoError(t, err)
+	_, err = fw.Write(make([]byte, 1<<20))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: name, Destination: dst, MaxTotalSize: 1 << 19}
+	err = x.Extract()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+	assert.Contains(t, err.Error(), "uncompressed")
+	x = archive.Extractor{Source: name, Destination: dst, MaxRatio: 100}
+	err = x.Extract()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+	assert.Contains(t, err.Error(), "ratio")
+	files, err := os.ReadDir(dst)
+	require.NoError(t, err)
+	assert.Empty(t, files, "nothing should be extracted from the refused archive")
+
+	x = archive.Extractor{Source: name, Destination: dst, MaxTotalSize: 1 << 20, MaxRatio: 10000}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(dst, "ZEROS.BIN"))
+}
+
+func TestMaxTotalSizeRar(t *testing.T) {
+	// the fake unrar program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	block := "        Name: README.TXT\\n        Type: File\\n        Size: 600000\\n" +
+		" Packed size: 6000\\n       mtime: 2023-11-14 22:13:00,000000000\\n       CRC32: 6A1D1B2F\\n\\n"
+	script := "#!/bin/sh\ncase \"$1\" in\n" +
+		"lt) printf 'Archive: TEST.RAR\\nDetails: RAR 4\\n\\n" + block + block + "' ;;\n" +
+		"esac\nexit 0\n"
+	prog := filepath.Join(dir, command.Unrar)
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	name := filepath.Join(dir, "TEST.RAR")
+	require.NoError(t, os.WriteFile(name, []byte("Rar!\x1a\x07\x00\x00\x00\x00\x00\x00\x00"), 0o600))
+	// the sizes of the duplicate names are both counted
+	x := archive.Extractor{Source: name, Destination: t.TempDir(), MaxTotalSize: 1000000}
+	err := x.Extract()
+	require.ErrorIs(t, err, archive.ErrTooMany)
+	assert.Contains(t, err.Error(), "1200000 bytes")
+
+	// an archive that cannot be listed is not extracted when a limit is set
+	require.NoError(t, os.WriteFile(prog, []byte("#!/bin/sh\nexit 1\n"), 0o700))
+	require.ErrorIs(t, x.Extract(), archive.ErrRead)
+}
+
+func TestSameContentsStrictRar(t *testing.T) {
+	// the fake unrar program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	log := filepath.Join(dir, "lt.log")
+	block := func(name, crc string) string {
+		return "        Name: " + name + "\\n        Type: File\\n        Size: 5\\n" +
+			" Packed size: 5\\n       CRC32: " + crc + "\\n\\n"
+	}
+	fake := func(crc string) {
+		script := "#!/bin/sh\ncase \"$1\" in\n" +
+			"lb) printf 'A.TXT\\nB.TXT\\n' ;;\n" +
+			"x) for a; do d=${a#-op}; done; printf A.TXT > \"$d/A.TXT\"; printf B.TXT > \"$d/B.TXT\" ;;\n" +
+			"lt) echo lt >> " + log + "; printf 'Archive: TEST.RAR\\n\\n" +
+			block("A.TXT", "968D9A34") + block("B.TXT", crc) + "' ;;\n" +
+			"esac\nexit 0\n"
+		prog := filepath.Join(dir, command.Unrar)
+		require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	srcA := filepath.Join(dir, "TEST.ZIP")
+	writeZip(t, srcA, "A.TXT", "B.TXT")
+	srcB := filepath.Join(dir, "TEST.RAR")
+	require.NoError(t, os.WriteFile(srcB, []byte("Rar!\x1a\x07\x00\x00\x00\x00\x00\x00\x00"), 0o600))
+
+	fake("D12DE0E4")
+	same, err := archive.SameContentsStrict(srcA, srcB)
+	require.NoError(t, err)
+	assert.True(t, same)
+	// the checksums of every file are read from a single technical listing,
+	// while the other listing checks the member names before the rar archive is extracted by List
+	b, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "lt\nlt\n", string(b))
+
+	fake("00000001")
+	same, err = archive.SameContentsStrict(srcA, srcB)
+	require.NoError(t, err)
+	assert.False(t, same)
+}
+
+func TestZoo(t *testing.T) {
+	// the fake zoo program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	list := "Archive TEST.ZOO:\\n" +
+		"Length    CF  Size Now  Date      Time\\n" +
+		"--------  --- --------  --------- --------\\n" +
+		"    2680  56%%     1189  20 May 92 16:57:26+1   24mhzhck.txt\\n" +
+		"--------  --- --------  --------- --------\\n" +
+		"    2680  56%%     1189     1 file\\n"
+	script := "#!/bin/sh\ncase \"$1\" in\n" +
+		"l) printf '" + list + "' ;;\n" +
+		"xO) printf 'hello' > 24mhzhck.txt ;;\n" +
+		"esac\nexit 0\n"
+	prog := filepath.Join(dir, command.Zoo)
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	const src = "testdata/TEST.ZOO"
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	ext, err := archive.MagicReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, ".zoo", ext)
+
+	var c archive.Content
+	require.NoError(t, c.Zoo(src))
+	assert.Equal(t, []string{"24mhzhck.txt"}, c.Files)
+	assert.Equal(t, ".zoo", c.Ext)
+	require.Len(t, c.Entries, 1)
+	assert.Equal(t, int64(2680), c.Entries[0].Size)
+	assert.Equal(t, int64(1189), c.Entries[0].CompressedSize)
+	assert.Equal(t, time.Date(1992, 5, 20, 16, 57, 26, 0, time.UTC), c.Entries[0].Modified)
+
+	files, err := archive.List(src, "TEST.ZOO")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"24mhzhck.txt"}, files)
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: src, Destination: dst}
+	require.NoError(t, x.Extract())
+	assert.FileExists(t, filepath.Join(dst, "24mhzhck.txt"))
+	assert.NoFileExists(t, filepath.Join(dst, "TEST.ZOO"), "the working copy should be removed")
+}
+
+func TestPak(t *testing.T) {
+	t.Parallel()
+
+	var buf []byte
+	buf = arcAdd(buf, 2, "STORED.TXT", []byte("stored"), []byte("stored"))
+	buf = arcAdd(buf, 3, "PACKED.TXT", []byte{'Z', 0x90, 5, 0x90, 0}, []byte{'Z', 'Z', 'Z', 'Z', 'Z', 0x90})
+	buf = arcAdd(buf, 10, "CRUSHED.TXT", []byte{0, 1, 2}, []byte("crushed"))
+	buf = append(buf, 0x1a, 0)
+	src := filepath.Join(t.TempDir(), "PAK100.PAK")
+	require.NoError(t, os.WriteFile(src, buf, 0o600))
+	assert.True(t, archive.PAK(src))
+
+	var c archive.Content
+	require.NoError(t, c.Pak(src))
+	assert.Equal(t, []string{"STORED.TXT", "PACKED.TXT", "CRUSHED.TXT"}, c.Files)
+	assert.Equal(t, ".pak", c.Ext)
+	require.Len(t, c.Entries, 3)
+	assert.Equal(t, int64(7), c.Entries[2].Size)
+	assert.Equal(t, int64(3), c.Entries[2].CompressedSize)
+	assert.Equal(t, 1994, c.Entries[2].Modified.Year())
+
+	assert.Equal(t, "pak", c.Tool)
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: src, Destination: dst}
+	require.ErrorIs(t, x.Extract(), archive.ErrNotImplemented, "the crushed method is not supported")
+	entries, err := os.ReadDir(dst)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the files of the other methods are salvaged using the Pak extractor
+	err = x.Pak()
+	require.ErrorIs(t, err, archive.ErrMethod)
+	b, err := os.ReadFile(filepath.Join(dst, "STORED.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "stored", string(b))
+	assert.FileExists(t, filepath.Join(dst, "PACKED.TXT"))
+
+	dst = t.TempDir()
+	x.Destination = dst
+	require.NoError(t, x.Pak("PACKED.TXT"))
+	assert.FileExists(t, filepath.Join(dst, "PACKED.TXT"))
+	assert.NoFileExists(t, filepath.Join(dst, "STORED.TXT"))
+	require.ErrorIs(t, x.Pak("MISSING.TXT"), archive.ErrMissing)
+}
+
+func TestComment(t *testing.T) {
+	// the fake arj and unrar programs on the PATH prevent the use of a parallel test
+	dir := t.TempDir()
+	var c archive.Content
+
+	name := filepath.Join(dir, "ADVERT.ZIP")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	_, err = w.Create("README.TXT")
+	require.NoError(t, err)
+	require.NoError(t, w.SetComment("Call the Defacto2 BBS"))
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	s, err := c.Comment(name)
+	require.NoError(t, err)
+	assert.Equal(t, "Call the Defacto2 BBS", s)
+
+	s, err = c.Comment("testdata/PKZ80A1.ZIP")
+	require.NoError(t, err)
+	assert.Empty(t, s)
+
+	name = filepath.Join(dir, "ADVERT.GZ")
+	f, err = os.Create(name)
+	require.NoError(t, err)
+	gw := gzip.NewWriter(f)
+	gw.Comment = "300 baud"
+	require.NoError(t, gw.Close())
+	require.NoError(t, f.Close())
+	s, err = c.Comment(name)
+	require.NoError(t, err)
+	assert.Equal(t, "300 baud", s)
+
+	s, err = c.Comment("testdata/SYMLINK.TAR")
+	require.NoError(t, err)
+	assert.Empty(t, s)
+
+	arj := "Processing archive: ADVERT.ARJ\\n" +
+		"Archive created: 1994-02-15 10:04:23, modified: 1994-02-15 10:04:23\\n" +
+		"Call the Defacto2 BBS\\n  300 baud\\n" +
+		"Sequence/Pos   Size     Compressed Ratio  DateTime modified Attributes/GUA BPMGS\\n" +
+		"------------ ---------- ---------- ----- ----------------- -------------- -----\\n"
+	prog := filepath.Join(dir, command.Arj)
+	require.NoError(t, os.WriteFile(prog, []byte("#!/bin/sh\nprintf '"+arj+"'\n"), 0o700))
+	prog = filepath.Join(dir, command.Unrar)
+	require.NoError(t, os.WriteFile(prog, []byte("#!/bin/sh\nprintf 'Greetings\\r\\n' > \"$4\"\n"), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	name = filepath.Join(dir, "ADVERT")
+	const mainType = 2
+	b := append(arjHeader(0, mainType, "ADVERT.ARJ"), 0x60, 0xea, 0, 0)
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+	s, err = c.Comment(name)
+	require.NoError(t, err)
+	assert.Equal(t, "Call the Defacto2 BBS\n  300 baud", s)
+	assert.NoFileExists(t, name+".arj", "the symbolic link should be removed")
+
+	name = filepath.Join(dir, "ADVERT.RAR")
+	require.NoError(t, os.WriteFile(name, []byte("Rar!\x1a\x07\x00\x00\x00\x00\x00\x00\x00"), 0o600))
+	s, err = c.Comment(name)
+	require.NoError(t, err)
+	assert.Equal(t, "Greetings", s)
+}
+
+func TestWalk(t *testing.T) {
+	// the fake unrar program on the PATH prevents the use of a parallel test
+	var c archive.Content
+	names := []string{}
+	err := c.Walk("testdata/SYMLINK.TAR", func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	require.NoError(t, err)
+	files, err := archive.ListFast("testdata/SYMLINK.TAR")
+	require.NoError(t, err)
+	assert.Equal(t, files, names)
+
+	names = names[:0]
+	err = c.Walk("testdata/PKZ204EX.ZIP", func(name string) error {
+		names = append(names, name)
+		return fs.SkipAll
+	})
+	require.NoError(t, err)
+	assert.Len(t, names, 1, "the walk should stop after the first file")
+
+	errStop := errors.New("stop")
+	err = c.Walk("testdata/PKZ204EX.ZIP", func(string) error { return errStop })
+	require.ErrorIs(t, err, errStop)
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "MAC.ZIP")
+	writeZip(t, name, "README.TXT", "__MACOSX/._README.TXT")
+	x := archive.Extractor{Source: name, SkipAppleDouble: true}
+	names = names[:0]
+	require.NoError(t, x.Walk(func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	assert.Equal(t, []string{"README.TXT"}, names)
+
+	prog := filepath.Join(dir, command.Unrar)
+	// the technical listing names the directories without a trailing slash
+	unrar := "#!/bin/sh\nprintf '" +
+		"        Name: FILE_ID.DIZ\\n        Type: File\\n  Attributes: ..A....\\n\\n" +
+		"        Name: DOCS\\n        Type: Directory\\n  Attributes: ...D...\\n\\n" +
+		"        Name: UNIX\\n  Attributes: drwxr-xr-x\\n\\n" +
+		"        Name: README.TXT\\n        Type: File\\n\\n" +
+		"        Name: README.TXT\\n        Type: File\\n'\n"
+	require.NoError(t, os.WriteFile(prog, []byte(unrar), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	name = filepath.Join(dir, "TEST.RAR")
+	require.NoError(t, os.WriteFile(name, []byte("Rar!\x1a\x07\x00\x00\x00\x00\x00\x00\x00"), 0o600))
+	names = names[:0]
+	require.NoError(t, c.Walk(name, func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	assert.Equal(t, []string{"FILE_ID.DIZ", "README.TXT"}, names)
+	names = names[:0]
+	require.NoError(t, c.Walk(name, func(name string) error {
+		names = append(names, name)
+		return fs.SkipAll
+	}))
+	assert.Equal(t, []string{"FILE_ID.DIZ"}, names)
+
+	// a name longer than the scanner buffer stops the program that is still writing
+	script := "#!/bin/sh\nhead -c 70000 /dev/zero | tr '\\0' a\nexec sleep 30\n"
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	start := time.Now()
+	err = c.Walk(name, func(string) error { return nil })
+	require.ErrorIs(t, err, bufio.ErrTooLong)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestWalkCP437(t *testing.T) {
+	t.Parallel()
+
+	const fat = 0
+	src := filepath.Join(t.TempDir(), "cp437.zip")
+	f, err := os.Create(src)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"README.TXT", "M\x81LLER.TXT"} {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, NonUTF8: true, CreatorVersion: fat << 8})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	var c archive.Content
+	require.NoError(t, c.Zip(src))
+	names := []string{}
+	require.NoError(t, c.Walk(src, func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	assert.Equal(t, c.Files, names)
+	assert.NotContains(t, names, "M\x81LLER.TXT")
+}
+
+func TestExtractVerboseLHA(t *testing.T) {
+	// the fake lha program on the PATH prevents the use of a parallel test
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\n" +
+		"-l) printf '[generic]                   12 100.0%% Apr 10 17:03 README.TXT\\n' ;;\n" +
+		"*) printf 'hello' > \"${1#*w=}/README.TXT\"; printf 'README.TXT\\t- Melted\\n' ;;\n" +
+		"esac\nexit 0\n"
+	prog := filepath.Join(dir, command.Lha)
+	require.NoError(t, os.WriteFile(prog, []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dst := t.TempDir()
+	x := archive.Extractor{Source: "testdata/LEVEL2.LZH", Destination: dst}
+	stdout, _, err := x.ExtractVerbose()
+	require.NoError(t, err)
+	assert.Contains(t, stdout, "README.TXT\t- Melted")
+	assert.FileExists(t, filepath.Join(dst, "README.TXT"))
+}
@@ -0,0 +1,121 @@
+package archive
+
+// Package file archive/arj.go contains the native ARJ header parsing functions.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	arjMaxHeader   = 2600 // maximum size of an ARJ basic header
+	arjVolume      = 0x04 // main header flag for an archive that continues on the next volume
+	arjLabelType   = 4    // file type of a volume label entry
+	arjFirstSize   = 0    // offset of the first header size
+	arjFlags       = 4    // offset of the archive or file flags
+	arjFileType    = 6    // offset of the file type
+	arjPackedSize  = 12   // offset of the compressed size of a file entry
+	arjFileMinSize = 16   // minimum size of a file entry basic header
+)
+
+// ARJVolumeInfo reads the headers of the src ARJ archive and returns the volume label
+// and whether the archive is a part of a multi-volume disk set.
+//
+// The label is stored as a volume label entry when the archive was created with the
+// volume label option, otherwise it is empty. The multi-volume state is read from the
+// flags of the main header, which the arj program sets on every volume that continues
+// onto another disk, such as the .arj and .a01 files of a disk set.
+//
+// The headers are read directly from the file, so the [arj program] is not required.
+//
+// [arj program]: https://arj.sourceforge.net/
+func ARJVolumeInfo(src string) (string, bool, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", false, fmt.Errorf("arj volume info %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	main, err := arjHeader(r)
+	if err != nil {
+		return "", false, fmt.Errorf("arj volume info %w", err)
+	}
+	if len(main) <= arjFlags {
+		return "", false, fmt.Errorf("arj volume info %w: %s", ErrNotArchive, src)
+	}
+	multiVolume := main[arjFlags]&arjVolume != 0
+	for {
+		h, err := arjHeader(r)
+		if err != nil {
+			return "", multiVolume, fmt.Errorf("arj volume info %w", err)
+		}
+		if h == nil {
+			return "", multiVolume, nil
+		}
+		if len(h) < arjFileMinSize {
+			return "", multiVolume, fmt.Errorf("arj volume info %w: %s", ErrRead, src)
+		}
+		if h[arjFileType] == arjLabelType {
+			return arjName(h), multiVolume, nil
+		}
+		packed := int64(binary.LittleEndian.Uint32(h[arjPackedSize:]))
+		if _, err := io.CopyN(io.Discard, r, packed); err != nil {
+			return "", multiVolume, fmt.Errorf("arj volume info %w", err)
+		}
+	}
+}
+
+// arjHeader reads and returns the next basic header from the ARJ archive reader,
+// skipping over the header CRC and any extended headers that follow it.
+// A nil header is returned for the end of archive marker.
+func arjHeader(r *bufio.Reader) ([]byte, error) {
+	var id [2]byte
+	if _, err := io.ReadFull(r, id[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	if id != [2]byte{0x60, 0xea} {
+		return nil, ErrNotArchive
+	}
+	var size uint16
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	if size > arjMaxHeader {
+		return nil, fmt.Errorf("%w: header size %d", ErrRead, size)
+	}
+	const crc = 4
+	h := make([]byte, int(size)+crc)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	for {
+		var ext uint16
+		if err := binary.Read(r, binary.LittleEndian, &ext); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRead, err)
+		}
+		if ext == 0 {
+			break
+		}
+		if _, err := r.Discard(int(ext) + crc); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRead, err)
+		}
+	}
+	return h[:size], nil
+}
+
+// arjName returns the null terminated filename that follows the fixed fields of the basic header.
+func arjName(h []byte) string {
+	first := int(h[arjFirstSize])
+	if first >= len(h) {
+		return ""
+	}
+	name, _, _ := bytes.Cut(h[first:], []byte{0})
+	return string(name)
+}
@@ -0,0 +1,89 @@
+package archive
+
+// Package file archive/cas.go contains the content-addressed store extraction functions.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ExtractCAS extracts all the files of the source archive into the storeDir content-addressed store
+// and returns a map of the archive-relative path of each file, using forward slashes, to its
+// hexadecimal SHA-256 checksum.
+//
+// Each file is stored in a subdirectory named with the first two characters of its checksum,
+// using the remaining characters as the filename, for example "storeDir/ab/cdef...".
+// Identical files, whether within the same or different archives, share the same stored path,
+// so a file that already exists in the store is not replaced. The Destination directory is not used.
+func (x Extractor) ExtractCAS(storeDir string) (map[string]string, error) {
+	if err := destWritable(storeDir); err != nil {
+		return nil, fmt.Errorf("extract cas %w", err)
+	}
+	if err := os.MkdirAll(storeDir, 0o755); err != nil {
+		return nil, fmt.Errorf("extract cas %w", err)
+	}
+	// the temporary directory is within the store to keep the moves on the same device
+	tmp, err := os.MkdirTemp(storeDir, ".cas-")
+	if err != nil {
+		return nil, fmt.Errorf("extract cas %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	x.Destination = tmp
+	if err := x.Extract(); err != nil {
+		return nil, fmt.Errorf("extract cas %w", err)
+	}
+	index := map[string]string{}
+	err = filepath.WalkDir(tmp, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(tmp, name)
+		if err != nil {
+			return err
+		}
+		_, sum, err := checksum(name)
+		if err != nil {
+			return err
+		}
+		if err := casStore(storeDir, name, sum); err != nil {
+			return err
+		}
+		index[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("extract cas %w", err)
+	}
+	return index, nil
+}
+
+// CASPath returns the path of the file with the hexadecimal SHA-256 sum within the storeDir
+// content-addressed store used by ExtractCAS.
+func CASPath(storeDir, sum string) string {
+	const shard = 2
+	if len(sum) <= shard {
+		return filepath.Join(storeDir, sum)
+	}
+	return filepath.Join(storeDir, sum[:shard], sum[shard:])
+}
+
+// casStore moves the named file to its sum path within the storeDir,
+// unless an identical file is already stored.
+func casStore(storeDir, name, sum string) error {
+	dst := CASPath(storeDir, sum)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(name, dst)
+}
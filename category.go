@@ -0,0 +1,70 @@
+package archive
+
+// Package file archive/category.go contains the classification of the files within an archive.
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The categories returned by PrimaryType.
+const (
+	Application = "application" // Application is a program or game.
+	Document    = "document"    // Document is a text, NFO or formatted document.
+	Image       = "image"       // Image is a graphic, photo or artwork.
+	Music       = "music"       // Music is a module, MIDI or digital audio.
+	Source      = "source"      // Source is the source code of a program.
+)
+
+// PrimaryTypes are the lowercased file extensions mapped to the category of the files used by PrimaryType.
+// Files with extensions that are not listed are not counted. The table can be changed or extended
+// by the caller before use, but it is not safe to modify it concurrently with PrimaryType.
+var PrimaryTypes = map[string]string{
+	".bat": Application, ".com": Application, ".dll": Application, ".exe": Application, ".ovl": Application,
+	".diz": Document, ".doc": Document, ".htm": Document, ".html": Document, ".me": Document,
+	".nfo": Document, ".pdf": Document, ".rtf": Document, ".txt": Document,
+	".ans": Image, ".asc": Image, ".bmp": Image, ".gif": Image, ".ice": Image, ".jpe": Image,
+	".jpeg": Image, ".jpg": Image, ".lbm": Image, ".pcx": Image, ".png": Image, ".tga": Image,
+	".it": Music, ".mid": Music, ".mod": Music, ".mp3": Music, ".ogg": Music, ".s3m": Music,
+	".voc": Music, ".wav": Music, ".xm": Music,
+	".asm": Source, ".bas": Source, ".c": Source, ".cpp": Source, ".go": Source, ".h": Source,
+	".inc": Source, ".pas": Source,
+}
+
+// PrimaryType returns the dominant category of the files within the source archive,
+// such as [Application], [Document], [Image], [Music] or [Source],
+// which is the category with the most files using the extensions in the [PrimaryTypes] table.
+// Ties are broken by the name of the category.
+// If none of the files have a listed extension then ErrRead is returned.
+func (x Extractor) PrimaryType() (string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return "", fmt.Errorf("primary type %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return "", fmt.Errorf("primary type %w", err)
+	}
+	counts := make(map[string]int)
+	for _, name := range c.Files {
+		if category, found := PrimaryTypes[strings.ToLower(filepath.Ext(name))]; found {
+			counts[category]++
+		}
+	}
+	if len(counts) == 0 {
+		return "", fmt.Errorf("primary type %w: no files are categorized", ErrRead)
+	}
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	slices.SortFunc(categories, func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(counts[b], counts[a]),
+			cmp.Compare(a, b))
+	})
+	return categories[0], nil
+}
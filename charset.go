@@ -0,0 +1,243 @@
+package archive
+
+// Package file archive/charset.go contains the decoding of the MS-DOS and Japanese filenames.
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// autoCharset renames the files and directories in the destination directory that have
+// names that are not valid UTF-8, by decoding the names with the likely codepage of the source archive.
+//
+// The names of MS-DOS era archives are usually stored using the IBM PC codepage 437.
+// But the unzip program converts the names of zip archives created on MS-DOS to ISO 8859-1,
+// which is found using the host operating system stored in the archive.
+// The names of LHA archives are decoded as Shift-JIS when they are valid Japanese text,
+// as the format was popular in Japan.
+// Zip archives with the UTF-8 language encoding flag set on every file are never renamed,
+// and names that would replace an existing file are left unchanged.
+func (x Extractor) autoCharset() error {
+	decode := x.charset()
+	paths := []string{}
+	err := filepath.WalkDir(x.Destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != x.Destination && !utf8.ValidString(d.Name()) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("auto charset %w", err)
+	}
+	// rename the deepest paths first, so the parent directories are still valid
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		name := decode(filepath.Base(path))
+		if name == "" {
+			continue
+		}
+		newpath := filepath.Join(filepath.Dir(path), name)
+		if _, err := os.Lstat(newpath); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(path, newpath); err != nil {
+			return fmt.Errorf("auto charset %w", err)
+		}
+	}
+	return nil
+}
+
+// charset returns the decoder of the names extracted from the source archive.
+// The decoder returns an empty string when the name cannot be decoded.
+func (x Extractor) charset() func(string) string {
+	cp437 := func(name string) string {
+		s, err := charmap.CodePage437.NewDecoder().String(name)
+		if err != nil {
+			return ""
+		}
+		return s
+	}
+	sign, _ := signature(x.Source)
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		if zipUTF8(x.Source) {
+			// the names are already UTF-8, so any invalid names are left unchanged
+			return func(string) string { return "" }
+		}
+		if !zipFAT(x.Source) {
+			return cp437
+		}
+		return func(name string) string {
+			s, err := charmap.ISO8859_1.NewDecoder().String(name)
+			if err != nil {
+				return ""
+			}
+			return s
+		}
+	case magicnumber.YoshiLHA:
+		return func(name string) string {
+			if s, ok := shiftJIS(name); ok {
+				return s
+			}
+			return cp437(name)
+		}
+	}
+	return cp437
+}
+
+// zipUTF8 returns true if every file of the src zip archive has the language encoding flag set,
+// which takes precedence over the codepage guessed from the host system.
+func zipUTF8(src string) bool {
+	entries, err := pkzip.CentralDirectory(src)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	for _, e := range entries {
+		if !e.UTF8() {
+			return false
+		}
+	}
+	return true
+}
+
+// extractZipUTF8 extracts the targets from the source zip archive, which has UTF-8 names,
+// to the destination directory using the Go standard library rather than the unzip program,
+// as the program converts the UTF-8 names of archives created on MS-DOS as if they were codepage 437.
+// If the targets are empty then all files are extracted, otherwise the targets are matched
+// to the names within the archive using the wildcards of path.Match.
+//
+// The symbolic links are created after all the other files, so no file is written through a link,
+// and are not created when RemoveLinks is set without AllowLinks.
+func (x Extractor) extractZipUTF8(targets ...string) error {
+	r, err := zip.OpenReader(x.Source)
+	if err != nil {
+		return fmt.Errorf("archive zip utf-8 extract %w", err)
+	}
+	defer r.Close()
+	links := []*zip.File{}
+	for _, file := range r.File {
+		if !zipTarget(file.Name, targets...) {
+			continue
+		}
+		if file.FileInfo().IsDir() {
+			if err := fsysDir(x.Destination, file.Name); err != nil {
+				return fmt.Errorf("archive zip utf-8 extract %w", err)
+			}
+			continue
+		}
+		if file.Mode()&fs.ModeSymlink != 0 {
+			if !x.RemoveLinks || x.AllowLinks {
+				links = append(links, file)
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("archive zip utf-8 extract %w", err)
+		}
+		err = fsysWrite(x.Destination, file.Name, file.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("archive zip utf-8 extract %w", err)
+		}
+	}
+	for _, file := range links {
+		if err := zipLink(x.Destination, file); err != nil {
+			return fmt.Errorf("archive zip utf-8 extract %w", err)
+		}
+	}
+	return nil
+}
+
+// zipLink creates the symbolic link of the file entry within the dst directory,
+// where the content of the entry is the target of the link.
+func zipLink(dst string, file *zip.File) error {
+	p := fsysLocal(dst, file.Name)
+	if p == "" {
+		return nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	const maxTarget = 4096
+	target, err := io.ReadAll(io.LimitReader(rc, maxTarget))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// a link replaces an existing file, the same as the overwrite option of the unzip program
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(string(target), p)
+}
+
+// zipTarget returns true if the name matches any of the targets, or if there are no targets.
+func zipTarget(name string, targets ...string) bool {
+	if len(targets) == 0 {
+		return true
+	}
+	for _, target := range targets {
+		if ok, _ := path.Match(target, name); ok || target == name {
+			return true
+		}
+	}
+	return false
+}
+
+// zipFAT returns true if the first file of the src zip archive was created on MS-DOS or OS/2,
+// which are the host systems that have their names converted to ISO 8859-1 by the unzip program.
+func zipFAT(src string) bool {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	if len(r.File) == 0 {
+		return false
+	}
+	const fat, hpfs = 0, 6
+	host := r.File[0].CreatorVersion >> 8
+	return host == fat || host == hpfs
+}
+
+// shiftJIS returns the name decoded from Shift-JIS and true if the result is Japanese text,
+// which must contain at least one Hiragana, full-width Katakana or Han character,
+// as the single-byte half-width Katakana are easily confused with the codepage 437 characters.
+func shiftJIS(name string) (string, bool) {
+	s, err := japanese.ShiftJIS.NewDecoder().String(name)
+	if err != nil || strings.ContainsRune(s, utf8.RuneError) {
+		return "", false
+	}
+	japan := strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.In(r, unicode.Hiragana, unicode.Han) ||
+			(unicode.Is(unicode.Katakana, r) && r < 0xff00)
+	})
+	return s, japan
+}
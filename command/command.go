@@ -13,6 +13,8 @@ const (
 	Tar     = "tar"     // Tar is the tar decompression command.
 	Unrar   = "unrar"   // Unrar is the rar decompression command.
 	Unzip   = "unzip"   // Unzip is the zip decompression command.
+	Xdms    = "xdms"    // Xdms is the Amiga DMS disk image decompression command.
 	Zip7    = "7zz"     // Zip7 is the 7-Zip decompression command.
 	ZipInfo = "zipinfo" // ZipInfo is the zip information command.
+	Zoo     = "zoo"     // Zoo is the zoo decompression command.
 )
@@ -0,0 +1,187 @@
+package archive
+
+// Package file archive/comment.go contains the archive comment functions.
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/helper"
+	"github.com/Defacto2/magicnumber"
+)
+
+// Comment returns the comment text stored in the src archive without extracting any files,
+// such as the advertisements that scene groups added to their releases.
+// An empty string is returned when the archive has no comment.
+//
+// The comments of ZIP and gzip archives are read natively, while the comments of RAR,
+// ARJ and ARC archives are read using the unrar, arj and arc programs.
+// The text is returned as it is stored, which is often codepage 437 for archives created on MS-DOS.
+// Tar archives cannot store a comment, and the other formats return ErrNotImplemented.
+func (c *Content) Comment(src string) (string, error) {
+	sign, err := signature(src)
+	if err != nil {
+		return "", fmt.Errorf("archive comment %w", err)
+	}
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		return zipComment(src)
+	case magicnumber.GzipCompressArchive:
+		return gzipComment(src)
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.TapeARchive:
+		return "", nil
+	case magicnumber.ARChiveSEA:
+		return c.ARCNote(src)
+	case magicnumber.ArchiveRobertJung:
+		return c.arjComment(src)
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		return c.rarComment(src)
+	case magicnumber.Unknown:
+		return "", fmt.Errorf("archive comment %w, %s", ErrNotArchive, sign)
+	}
+	return "", fmt.Errorf("archive comment %w, %s", ErrNotImplemented, sign)
+}
+
+// zipComment returns the comment of the src zip archive,
+// which is stored in the end of central directory record.
+func zipComment(src string) (string, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return "", fmt.Errorf("archive zip comment %w", err)
+	}
+	defer r.Close()
+	return r.Comment, nil
+}
+
+// gzipComment returns the comment of the src gzip compressed file,
+// which is an optional field of the gzip header.
+func gzipComment(src string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("archive gzip comment %w", err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("archive gzip comment %w", err)
+	}
+	defer r.Close()
+	return r.Header.Comment, nil
+}
+
+// rarComment returns the comment of the src RAR archive,
+// which is written to a temporary file by the comment command of the [unrar program].
+//
+// [unrar program]: https://www.rarlab.com/rar_add.htm
+func (c *Content) rarComment(src string) (string, error) {
+	prog, err := exec.LookPath(command.Unrar)
+	if err != nil {
+		return "", fmt.Errorf("archive unrar comment %w", err)
+	}
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-comment-")
+	if err != nil {
+		return "", fmt.Errorf("archive unrar comment %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	name := filepath.Join(tmp, "comment.txt")
+	const (
+		writeComment = "cw" // cw write archive comment to file
+		yes          = "-y" // -y assume yes to all queries
+	)
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, writeComment, yes, src, name)
+	cmd.Stderr = &b
+	if err := cmd.Run(); err != nil {
+		if b.String() != "" {
+			return "", fmt.Errorf("archive unrar comment %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return "", fmt.Errorf("archive unrar comment %w", err)
+	}
+	p, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("archive unrar comment %w", err)
+	}
+	return strings.TrimRight(string(p), "\r\n"), nil
+}
+
+// arjComment returns the comment of the src ARJ archive,
+// which is read from the verbose list command of the [arj program].
+//
+// [arj program]: https://arj.sourceforge.net/
+func (c *Content) arjComment(src string) (string, error) {
+	prog, err := exec.LookPath(command.Arj)
+	if err != nil {
+		return "", fmt.Errorf("archive arj comment %w", err)
+	}
+	// note: arj REQUIRES a file extension for the source archive
+	srcWithExt := src + arjx
+	if _, err := os.Stat(srcWithExt); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Symlink(src, srcWithExt); err != nil {
+			return "", fmt.Errorf("archive arj symlink %w", err)
+		}
+		defer os.Remove(srcWithExt)
+	}
+	const verboselist = "v"
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, verboselist, srcWithExt)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		if b.String() != "" {
+			return "", fmt.Errorf("archive arj comment %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return "", fmt.Errorf("archive arj comment %w", err)
+	}
+	return arjNote(string(out)), nil
+}
+
+// arjNote returns the lines of the arj program verbose list output
+// between the archive created line and the column headings, which is the archive comment.
+//
+//	Processing archive: TEST.ARJ
+//	Archive created: 2024-02-26 10:04:23, modified: 2024-02-26 10:04:23
+//	Call the Defacto2 BBS
+//	Sequence/Pos   Size     Compressed Ratio  DateTime modified Attributes/GUA BPMGS
+func arjNote(out string) string {
+	lines := []string{}
+	comment := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if strings.HasPrefix(line, "Archive created:") {
+			comment = true
+			continue
+		}
+		if strings.HasPrefix(line, "Sequence/Pos") || strings.HasPrefix(line, "Filename") {
+			break
+		}
+		if comment {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,298 @@
+package archive
+
+// Package file archive/crc.go contains the CRC-32 checksum comparison functions.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+)
+
+// ErrChecksum is returned when the CRC-32 checksum of a file within an archive cannot be read.
+var ErrChecksum = errors.New("archive file checksum is not available")
+
+// EntryMatchesFile returns true if the CRC-32 checksum of the named file within the source archive
+// matches the checksum of the file on disk at path, which is cheaper than extracting the file
+// to find if an existing file is up to date.
+//
+// The stored checksums are read from the central directory of ZIP archives,
+// the technical listing of the [unrar program] for RAR archives,
+// and the technical listing of the [7z program] for 7z archives.
+// Other formats and RAR archives that use the BLAKE2 hash return ErrChecksum.
+//
+// [unrar program]: https://www.rarlab.com/rar_add.htm
+// [7z program]: https://www.7-zip.org/
+func (x Extractor) EntryMatchesFile(name, path string) (bool, error) {
+	stored, err := x.entryCRC(name)
+	if err != nil {
+		return false, fmt.Errorf("entry matches file %w", err)
+	}
+	sum, err := fileCRC(path)
+	if err != nil {
+		return false, fmt.Errorf("entry matches file %w", err)
+	}
+	return stored == sum, nil
+}
+
+// Changed returns the names of the files within the source archive that are new or differ
+// from the files of the same name within the refDir directory, such as a previous extraction,
+// so only these files need to be extracted to bring the directory up to date.
+//
+// The files are compared by their uncompressed size, which is cheap but misses edits
+// that keep the same size, see ChangedCRC for a stronger comparison.
+// When the archive listing does not report the sizes, only the new files are returned.
+// The names are returned in the order of the archive listing.
+func (x Extractor) Changed(refDir string) ([]string, error) {
+	names, err := x.changed(refDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("changed %w", err)
+	}
+	return names, nil
+}
+
+// ChangedCRC returns the names of the files within the source archive that are new or differ
+// from the files of the same name within the refDir directory, the same as Changed,
+// but files of the same size are also compared by their CRC-32 checksums.
+//
+// The stored checksums are only available for the ZIP, RAR and 7z formats, see EntryMatchesFile,
+// so the files of other formats are compared by size. Each file of the same size within
+// refDir is read to calculate its checksum.
+func (x Extractor) ChangedCRC(refDir string) ([]string, error) {
+	names, err := x.changed(refDir, true)
+	if err != nil {
+		return nil, fmt.Errorf("changed crc %w", err)
+	}
+	return names, nil
+}
+
+// changed returns the names of the new or different files within the source archive
+// compared to the refDir directory, optionally comparing the checksums of the files.
+func (x Extractor) changed(refDir string, checksums bool) ([]string, error) {
+	if st, err := os.Stat(refDir); err != nil {
+		return nil, err
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrPath, refDir)
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, err
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, err
+	}
+	entries := c.Entries
+	sized := len(entries) > 0
+	if !sized {
+		for _, name := range c.Files {
+			entries = append(entries, Entry{Name: name})
+		}
+	}
+	var sums map[string]uint32
+	if checksums && sized {
+		sums, _ = x.entryCRCs()
+	}
+	names := []string{}
+	for _, e := range entries {
+		if !regular(e.Name) || !filepath.IsLocal(filepath.FromSlash(e.Name)) {
+			continue
+		}
+		path := filepath.Join(refDir, filepath.FromSlash(e.Name))
+		st, err := os.Stat(path)
+		if err != nil || !st.Mode().IsRegular() {
+			names = append(names, e.Name)
+			continue
+		}
+		if !sized {
+			continue
+		}
+		if st.Size() != e.Size {
+			names = append(names, e.Name)
+			continue
+		}
+		if !checksums {
+			continue
+		}
+		stored, ok := lookupCRC(sums, e.Name)
+		if !ok {
+			continue
+		}
+		sum, err := fileCRC(path)
+		if err != nil {
+			return nil, err
+		}
+		if stored != sum {
+			names = append(names, e.Name)
+		}
+	}
+	return names, nil
+}
+
+// entryCRC returns the stored CRC-32 checksum of the named file within the source archive.
+func (x Extractor) entryCRC(name string) (uint32, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return 0, err
+	}
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		return zipCRC(x.Source, name)
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		const technical = "lt" // lt list technical information
+		return programCRC(x.ctx, command.Unrar, "CRC32:", technical, x.Source, name)
+	case magicnumber.X7zCompressArchive:
+		const list, technical = "l", "-slt"
+		return programCRC(x.ctx, command.Zip7, "CRC =", list, technical, x.Source, name)
+	}
+	return 0, fmt.Errorf("%w: %s", ErrChecksum, sign)
+}
+
+// entryCRCs returns the stored CRC-32 checksums of the files within the source archive keyed by name,
+// which are read from a single listing of the archive, rather than a listing for each file.
+// Files without a stored checksum, such as the RAR files that use the BLAKE2 hash, are left out.
+func (x Extractor) entryCRCs() (map[string]uint32, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		headers, err := pkzip.CentralDirectory(x.Source)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range headers {
+			entries = append(entries, Entry{Name: h.Name, Size: h.Size, CRC32: h.CRC32})
+		}
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		entries, err = rarTechnical(x.ctx, x.Source)
+		if err != nil {
+			return nil, err
+		}
+	case magicnumber.X7zCompressArchive:
+		c := Content{ctx: x.ctx}
+		if err := c.Zip7(x.Source); err != nil {
+			return nil, err
+		}
+		entries = c.Entries
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrChecksum, sign)
+	}
+	sums := make(map[string]uint32, len(entries))
+	for _, e := range entries {
+		// the checksum of an empty file is zero, so only a file with content can lack a checksum
+		if e.CRC32 == 0 && e.Size > 0 {
+			continue
+		}
+		sums[e.Name] = e.CRC32
+	}
+	return sums, nil
+}
+
+// lookupCRC returns the checksum of the named file within the sums of entryCRCs.
+// The name is matched case-insensitively when there is no exact match.
+func lookupCRC(sums map[string]uint32, name string) (uint32, bool) {
+	if sum, ok := sums[name]; ok {
+		return sum, true
+	}
+	for key, sum := range sums {
+		if strings.EqualFold(key, name) {
+			return sum, true
+		}
+	}
+	return 0, false
+}
+
+// zipCRC returns the CRC-32 checksum of the named file stored in the central directory
+// of the src zip archive. The name is matched case-insensitively when there is no exact match.
+func zipCRC(src, name string) (uint32, error) {
+	entries, err := pkzip.CentralDirectory(src)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e.CRC32, nil
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name, name) {
+			return e.CRC32, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrMissing, name)
+}
+
+// programCRC returns the hexadecimal CRC-32 checksum that follows the key
+// in the output of the archiver prog run with the args, which is stopped when the parent is canceled.
+func programCRC(parent context.Context, prog, key string, args ...string) (uint32, error) {
+	path, err := exec.LookPath(prog)
+	if err != nil {
+		return 0, err
+	}
+	var b bytes.Buffer
+	ctx, cancel := withTimeout(parent, TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		if b.String() != "" {
+			return 0, fmt.Errorf("%w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return 0, fmt.Errorf("%w: %s", err, prog)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		_, value, found := strings.Cut(line, key)
+		if !found {
+			continue
+		}
+		sum, err := strconv.ParseUint(strings.TrimSpace(value), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrChecksum, prog)
+		}
+		return uint32(sum), nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrChecksum, prog)
+}
+
+// fileCRC returns the IEEE CRC-32 checksum of the named file.
+func fileCRC(name string) (uint32, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
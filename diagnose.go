@@ -0,0 +1,79 @@
+package archive
+
+// Package file archive/diagnose.go contains the file type detection diagnostic functions.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+)
+
+// HeaderBytes returns up to n bytes read from the start of the src file.
+// Fewer bytes are returned when the file is smaller than n.
+func HeaderBytes(src string, n int) ([]byte, error) {
+	if n <= 0 {
+		return []byte{}, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("header bytes %w", err)
+	}
+	defer f.Close()
+	p := make([]byte, n)
+	i, err := io.ReadFull(f, p)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("header bytes %w", err)
+	}
+	return p[:i], nil
+}
+
+// DescribeHeader returns a human-readable identification of the src file,
+// to help diagnose why an archive was detected or extracted as another format.
+// The description combines the magic number signature, the output of the [file] program,
+// the archive extension matched by MagicExt and the leading bytes of the file in hexadecimal.
+// ZIP archives also report the minimum PKZIP version needed to extract the files.
+//
+// Failures of the individual detection methods, such as a missing file program,
+// are included in the description rather than returned as an error.
+//
+// [file]: https://www.darwinsys.com/file/
+func DescribeHeader(src string) (string, error) {
+	const n = 16
+	p, err := HeaderBytes(src, n)
+	if err != nil {
+		return "", fmt.Errorf("describe header %w", err)
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("describe header %w", err)
+	}
+	defer f.Close()
+	sign := magicnumber.Find(f)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "magic number: %s (%s)\n", sign.Title(), sign)
+	ext := ""
+	out, err := magicFile(context.Background(), src)
+	if err != nil {
+		fmt.Fprintf(&sb, "file program: %s\n", err)
+	} else {
+		fmt.Fprintf(&sb, "file program: %s\n", strings.TrimSpace(out))
+		ext, err = magicMatch(out)
+	}
+	if err != nil {
+		fmt.Fprintf(&sb, "extension: %s\n", err)
+	} else {
+		fmt.Fprintf(&sb, "extension: %s\n", ext)
+	}
+	if v, err := pkzip.VersionNeeded(src); err == nil {
+		fmt.Fprintf(&sb, "zip version needed: %d.%d\n", v/10, v%10)
+	}
+	fmt.Fprintf(&sb, "header: % x", p)
+	return sb.String(), nil
+}
@@ -0,0 +1,62 @@
+package archive
+
+// Package file archive/dms.go contains the Amiga DMS disk image functions.
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/Defacto2/archive/command"
+)
+
+const dmsx = ".dms" // Disk Masher System for the Commodore Amiga
+
+var dmsSign = []byte("DMS!") // Disk Masher System signature
+
+// DMS returns true if the src file is an Amiga Disk Masher System (DMS) disk image,
+// which is a compressed image of a floppy disk rather than an archive of files.
+func DMS(src string) bool {
+	p, err := HeaderBytes(src, len(dmsSign))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(p, dmsSign)
+}
+
+// DMS unpacks the source Amiga DMS disk image to an Amiga Disk File (ADF) image
+// in the destination directory using the [xdms program].
+// The files within the disk image are not extracted, as the ADF image
+// requires an Amiga file system reader.
+//
+// If the xdms program is not installed then ErrNotImplemented is returned.
+//
+// [xdms program]: https://zakalwe.fi/~shd/foss/xdms/
+func (x Extractor) DMS() error {
+	src, dst := x.Source, x.Destination
+	if err := destDir(dst); err != nil {
+		return err
+	}
+	prog, err := exec.LookPath(command.Xdms)
+	if err != nil {
+		return fmt.Errorf("archive dms extract %w: %w", ErrNotImplemented, err)
+	}
+	var b bytes.Buffer
+	ctx, cancel := x.context(TimeoutDefunct)
+	defer cancel()
+	const (
+		quiet     = "-q" // -q quiet mode
+		targetDir = "-d" // -d destination directory
+		unpack    = "u"  // u unpack to an ADF disk image
+	)
+	args := []string{quiet, targetDir, dst, unpack, src}
+	cmd := exec.CommandContext(ctx, prog, args...)
+	x.output(cmd, &b)
+	if err = cmd.Run(); err != nil {
+		if b.String() != "" {
+			return fmt.Errorf("archive dms %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return fmt.Errorf("archive dms %w: %s", err, prog)
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package archive
+
+// Package file archive/entry.go contains the archive file entry metadata functions.
+
+import (
+	"archive/zip"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Defacto2/archive/internal"
+	"github.com/Defacto2/archive/pkzip"
+)
+
+// Entry is the metadata of a file within an archive,
+// as reported by the listing of a system archiver program.
+// Values that are not reported by the archiver are left as zero values.
+type Entry struct {
+	Name           string    // Name of the file within the archive.
+	Size           int64     // Size is the uncompressed size of the file in bytes.
+	CompressedSize int64     // CompressedSize is the packed size of the file in bytes.
+	LinkTarget     string    // LinkTarget is the target path of a symbolic link, otherwise it is empty.
+	Modified       time.Time // Modified is the last modification time of the file in the UTC location.
+	CRC32          uint32    // CRC32 is the IEEE checksum of the uncompressed file stored by ZIP and 7z archives, otherwise it is zero.
+	Attributes     string    // Attributes is the raw attributes reported by the archiver program, such as "-rw-a--" or "A--W".
+	SourceOS       string    // SourceOS is the operating system that created the file, such as "Unix" or "FAT" in a gzip header.
+}
+
+// Control returns true if the name of the entry contains control characters, such as NUL,
+// carriage return or escape. These names are confusing and potentially unsafe when printed
+// or written to the file system, but are technically permitted by some archive formats.
+func (e Entry) Control() bool {
+	return strings.ContainsFunc(e.Name, unicode.IsControl)
+}
+
+// Ratio returns the compression ratio of the entry, which is the compressed size
+// divided by the uncompressed size. A value close to 1 means the file was not
+// reduced, while a stored file or an already compressed payload will return 1 or more.
+// Empty files have no ratio and return 0.
+func (e Entry) Ratio() float64 {
+	if e.Size <= 0 {
+		return 0
+	}
+	return float64(e.CompressedSize) / float64(e.Size)
+}
+
+// ByRatio returns a copy of the entries sorted by their compression ratio in ascending order,
+// so the best compressed files are listed first and the stored or incompressible files last.
+// Entries with equal ratios keep their archive order.
+func (c *Content) ByRatio() []Entry {
+	entries := slices.Clone(c.Entries)
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return cmp.Compare(a.Ratio(), b.Ratio())
+	})
+	return entries
+}
+
+// Sizes returns the total compressed and uncompressed sizes in bytes of the entries,
+// which can be used to find the overall compression ratio of the archive.
+// Entries without reported sizes are counted as zero.
+func (c *Content) Sizes() (int64, int64) {
+	compressed, uncompressed := int64(0), int64(0)
+	for _, e := range c.Entries {
+		compressed += e.CompressedSize
+		uncompressed += e.Size
+	}
+	return compressed, uncompressed
+}
+
+// arjRatio matches the ratio column of the arj program verbose list command, for example "0.912".
+var arjRatio = regexp.MustCompile(`^\d+\.\d{3}$`)
+
+// arjEntry returns the entry using the name and the details row that follows it
+// in the [arj program] verbose list command.
+//
+//	Sequence/Pos   Size     Compressed Ratio  DateTime modified Attributes/GUA BPMGS
+//	------------ ---------- ---------- ----- ----------------- -------------- -----
+//	001) TEST.ANS
+//	 11 MS-DOS            68         62 0.912 12-09-19 14:21:52                  1
+//
+// The host operating system column can contain spaces, such as "ATARI ST",
+// so the sizes are located using the position of the ratio column.
+//
+// [arj program]: https://arj.sourceforge.net/
+func arjEntry(name, details string) Entry {
+	e := Entry{Name: name}
+	fields := strings.Fields(details)
+	for i, field := range fields {
+		const sizeCols, dateCols = 2, 2
+		if i < sizeCols || !arjRatio.MatchString(field) {
+			continue
+		}
+		e.Size, _ = strconv.ParseInt(fields[i-2], 10, 64)
+		e.CompressedSize, _ = strconv.ParseInt(fields[i-1], 10, 64)
+		if i+dateCols < len(fields) {
+			e.Modified = arjDate(fields[i+1], fields[i+dateCols])
+			e.Attributes = arjAttributes(details, fields[i+dateCols])
+		}
+		break
+	}
+	return e
+}
+
+// arjDate returns the modification time of the date and clock columns of the arj program
+// verbose list command, for example "25-02-14 13:21:10", which uses a two-digit year.
+// A zero time is returned when the columns cannot be parsed.
+func arjDate(date, clock string) time.Time {
+	t, err := time.Parse("06-01-02 15:04:05", date+" "+clock)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Date(dosYear(t.Year()%100), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// arjAttributes returns the Attributes/GUA column of the details row,
+// which follows the clock of the modification time and is blank for most MS-DOS files.
+func arjAttributes(details, clock string) string {
+	const width = len("Attributes/GUA")
+	i := strings.Index(details, " "+clock+" ")
+	if i < 0 {
+		return ""
+	}
+	col := details[i+len(clock)+2:]
+	return strings.TrimSpace(col[:min(width, len(col))])
+}
+
+// zipinfoEntry returns the entry of a row from the [zipinfo program] long list command.
+// The boolean is false if the row is not a file entry, such as the header or summary.
+//
+//	-rw-a--     2.0 fat       68 t-       62 defX 12-Sep-19 14:21 TEST.ANS
+//
+// [zipinfo program]: https://infozip.sourceforge.net/
+func zipinfoEntry(s string) (Entry, bool) {
+	const (
+		columns    = 9
+		size       = 3
+		compressed = 5
+		date       = 7
+		clock      = 8
+	)
+	fields, name := internal.Fields(s, columns)
+	if len(fields) < columns || name == "" {
+		return Entry{}, false
+	}
+	const attributes = 0
+	e := Entry{Name: name, Attributes: fields[attributes]}
+	var err error
+	if e.Size, err = strconv.ParseInt(fields[size], 10, 64); err != nil {
+		return Entry{}, false
+	}
+	if e.CompressedSize, err = strconv.ParseInt(fields[compressed], 10, 64); err != nil {
+		return Entry{}, false
+	}
+	if t, err := time.Parse("06-Jan-02 15:04", fields[date]+" "+fields[clock]); err == nil {
+		e.Modified = time.Date(dosYear(t.Year()%100), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	}
+	return e, true
+}
+
+// arcEntry returns the file entry of a row from the [arc program] list command,
+// which lists the name, the uncompressed size and the date with a two-digit year.
+//
+//	Name          Length    Date
+//	============  ========  =========
+//	TEST.TXT            14  14 Feb 25
+//
+// [arc program]: https://linux.die.net/man/1/arc
+func arcEntry(s string) (Entry, bool) {
+	fields := strings.Fields(s)
+	const name, size, day, month, year, cols = 0, 1, 2, 3, 4, 5
+	if len(fields) != cols {
+		return Entry{}, false
+	}
+	n, err := strconv.ParseInt(fields[size], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	t, err := time.Parse("2 Jan 06", strings.Join(fields[day:year+1], " "))
+	if err != nil {
+		return Entry{}, false
+	}
+	yy := t.Year() % 100
+	return Entry{
+		Name:     fields[name],
+		Size:     n,
+		Modified: time.Date(dosYear(yy), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC),
+	}, true
+}
+
+// dosYear returns the four-digit year of a two-digit yy year, using a window from 1980,
+// the first year of the MS-DOS file date, so 80 to 99 are 1980 to 1999 and 0 to 79 are 2000 to 2079.
+func dosYear(yy int) int {
+	const dos, century = 80, 100
+	if yy >= dos {
+		return 1900 + yy
+	}
+	return 2000 + yy%century
+}
+
+// lhaDate returns the modification time of the date column from the [lha program] list command.
+// Recent files are listed with the month, day and time, for example "Feb 14 13:21",
+// where the year is the most recent that is not after the now time.
+// Older files are listed with the month, day and year, for example "Feb 14  1994".
+//
+// [lha program]: https://fragglet.github.io/lhasa/
+func lhaDate(s string, now time.Time) time.Time {
+	s = strings.Join(strings.Fields(s), " ")
+	if t, err := time.Parse("Jan 2 2006", s); err == nil {
+		return t
+	}
+	t, err := time.Parse("Jan 2 15:04", s)
+	if err != nil {
+		return time.Time{}
+	}
+	t = t.AddDate(now.Year()-t.Year(), 0, 0)
+	if t.After(now) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// zip7Entries returns the file entries of the [7z program] technical list command.
+// Each file is listed as a block of "key = value" properties separated by an empty line,
+// following the properties of the archive and a line of dashes.
+//
+//	----------
+//	Path = TEST.ANS
+//	Folder = -
+//	Size = 68
+//	Packed Size = 62
+//	Modified = 2012-09-19 14:21:52
+//	Attributes = A
+//	CRC = 5CE2F707
+//
+// Directories are skipped and a blank packed size, used by the files of a solid block
+// or the stored files of some formats, is left as zero, as is a blank modification time.
+//
+// [7z program]: https://www.7-zip.org/
+func zip7Entries(out string) []Entry {
+	_, list, found := strings.Cut(out, "\n----------\n")
+	if !found {
+		return nil
+	}
+	entries := []Entry{}
+	for _, block := range strings.Split(list, "\n\n") {
+		props := zip7Props(block)
+		name := props["Path"]
+		if name == "" || props["Folder"] == "+" {
+			continue
+		}
+		e := Entry{Name: name, Attributes: props["Attributes"]}
+		e.Size, _ = strconv.ParseInt(props["Size"], 10, 64)
+		e.CompressedSize, _ = strconv.ParseInt(props["Packed Size"], 10, 64)
+		// newer versions of 7z list fractional seconds, which are accepted by the parser
+		if t, err := time.Parse(time.DateTime, props["Modified"]); err == nil {
+			e.Modified = t
+		}
+		if sum, err := strconv.ParseUint(props["CRC"], 16, 32); err == nil {
+			e.CRC32 = uint32(sum)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// zip7Props returns the "key = value" properties of a block from the 7z technical list command.
+func zip7Props(block string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(block, "\n") {
+		key, value, found := strings.Cut(strings.TrimRight(line, "\r"), " = ")
+		if !found {
+			continue
+		}
+		props[key] = value
+	}
+	return props
+}
+
+// zipControls restores the names of the entries of a zip archive that contain control characters,
+// as the zipinfo program escapes these characters with a caret, for example "^M" for a carriage return.
+// The entries are expected to be in the same order as the central directory headers,
+// otherwise they are left unchanged.
+func zipControls(headers []pkzip.Entry, files []string, entries []Entry) {
+	if len(headers) != len(entries) || len(files) != len(entries) {
+		return
+	}
+	for i, h := range headers {
+		if !strings.ContainsFunc(h.Name, unicode.IsControl) {
+			continue
+		}
+		files[i] = h.Name
+		entries[i].Name = h.Name
+	}
+}
+
+// zipUTF8Names restores the names of the entries of a zip archive that have the UTF-8
+// language encoding flag set, as the zipinfo program ignores the flag for archives created
+// on MS-DOS and instead converts the names from codepage 437, which mangles any non-ASCII names.
+// The entries are expected to be in the same order as the central directory headers,
+// otherwise they are left unchanged.
+func zipUTF8Names(headers []pkzip.Entry, files []string, entries []Entry) {
+	if len(headers) != len(entries) || len(files) != len(entries) {
+		return
+	}
+	for i, h := range headers {
+		if !h.UTF8() || !utf8.ValidString(h.Name) {
+			continue
+		}
+		files[i] = h.Name
+		entries[i].Name = h.Name
+	}
+}
+
+// zipCRCs sets the CRC-32 checksums of the entries of a zip archive,
+// which are read from the central directory headers as the zipinfo long list does not report them.
+// The entries are expected to be in the same order as the central directory headers,
+// otherwise they are left unchanged. Directories and empty files keep a zero checksum.
+func zipCRCs(headers []pkzip.Entry, entries []Entry) {
+	if len(headers) != len(entries) {
+		return
+	}
+	for i, h := range headers {
+		entries[i].CRC32 = h.CRC32
+	}
+}
+
+// zipLinks sets the LinkTarget of the symbolic link entries of the src zip archive,
+// as the zipinfo program does not report the targets. Unix symbolic links are stored
+// in zip archives as files with the link mode in the external attributes,
+// and with the target path as their content.
+func zipLinks(src string, entries []Entry) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	targets := make(map[string]string)
+	for _, file := range r.File {
+		if file.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			continue
+		}
+		const maxPath = 4096
+		b, err := io.ReadAll(io.LimitReader(rc, maxPath))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		targets[file.Name] = string(b)
+	}
+	for i, e := range entries {
+		if target, ok := targets[e.Name]; ok {
+			entries[i].LinkTarget = target
+		}
+	}
+}
+
+// zipHeaders sets the content of the src zip archive using the file headers read from
+// the central directory or, when the central directory is damaged, the local file headers.
+// It is used to recover the files of broken zip archives that the zipinfo program refuses.
+func (c *Content) zipHeaders(src string) error {
+	headers, err := pkzip.CentralDirectory(src)
+	if err != nil || len(headers) == 0 {
+		headers, err = pkzip.LocalHeaders(src)
+	}
+	if len(headers) == 0 {
+		return fmt.Errorf("zip headers %w: %w", ErrRead, err)
+	}
+	files := make([]string, 0, len(headers))
+	entries := make([]Entry, 0, len(headers))
+	for _, h := range headers {
+		files = append(files, h.Name)
+		entries = append(entries, Entry{
+			Name: h.Name, Size: h.Size, CompressedSize: h.CompressedSize, Modified: h.Modified,
+			CRC32: h.CRC32,
+		})
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = zipx
+	c.Tool = "pkzip"
+	c.Partial = true
+	return nil
+}
+
+// zipDiscrepancy returns true if the files named in the central directory headers of the src zip archive
+// do not match the files found in the local file headers, or the local file headers could not be fully read.
+func zipDiscrepancy(src string, central []pkzip.Entry) bool {
+	local, err := pkzip.LocalHeaders(src)
+	if err != nil {
+		return true
+	}
+	names := func(headers []pkzip.Entry) []string {
+		s := make([]string, len(headers))
+		for i, h := range headers {
+			s[i] = h.Name
+		}
+		slices.Sort(s)
+		return s
+	}
+	return !slices.Equal(names(central), names(local))
+}
+
+// Clean removes the empty names, the directory entries and the duplicate names
+// from both the files and the entries of the content. This produces a canonical
+// list of files regardless of the archiver program that was used to read the archive,
+// as some programs include directories or list duplicates from broken archives.
+//
+// Directory entries are names with a trailing slash or backslash.
+// Duplicate names are matched case-insensitively, as many handled file archives
+// are created on MS-DOS and Windows file systems, and the first occurrence is kept.
+func (c *Content) Clean() {
+	if c.raw {
+		return
+	}
+	seen := make(map[string]bool, len(c.Files))
+	c.Files = slices.DeleteFunc(c.Files, func(name string) bool {
+		return redundant(name, seen)
+	})
+	seen = make(map[string]bool, len(c.Entries))
+	c.Entries = slices.DeleteFunc(c.Entries, func(e Entry) bool {
+		return redundant(e.Name, seen)
+	})
+}
+
+// SkipAppleDouble removes the macOS AppleDouble files from the content,
+// which are the "__MACOSX" directory and the "._" prefixed files that store the
+// resource forks and metadata of Mac-origin archives.
+func (c *Content) SkipAppleDouble() {
+	c.Files = slices.DeleteFunc(c.Files, AppleDouble)
+	c.Entries = slices.DeleteFunc(c.Entries, func(e Entry) bool {
+		return AppleDouble(e.Name)
+	})
+}
+
+// AppleDouble returns true if the named file within an archive is a macOS AppleDouble file,
+// either within a "__MACOSX" directory or with a base name that begins with "._".
+func AppleDouble(name string) bool {
+	elems := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	if len(elems) == 0 {
+		return false
+	}
+	if slices.Contains(elems, "__MACOSX") {
+		return true
+	}
+	return strings.HasPrefix(elems[len(elems)-1], "._")
+}
+
+// redundant returns true if the name is empty, a directory or has already been seen.
+func redundant(name string, seen map[string]bool) bool {
+	if strings.TrimSpace(name) == "" {
+		return true
+	}
+	if strings.HasSuffix(name, "/") || strings.HasSuffix(name, "\\") {
+		return true
+	}
+	key := strings.ToLower(name)
+	if seen[key] {
+		return true
+	}
+	seen[key] = true
+	return false
+}
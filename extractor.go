@@ -0,0 +1,1356 @@
+package archive
+
+// Package file archive/extractor.go contains the additional extractor methods
+// that are used after or around the extraction of an archive.
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+)
+
+const (
+	// TimeoutMax is the maximum time allowed for the archive extraction by [TimeoutScale].
+	TimeoutMax = 3 * time.Minute
+	// throughput is the estimated number of source bytes that are extracted per second.
+	throughput = 2 * 1024 * 1024
+)
+
+// TimeoutScale returns a timeout for the extraction that scales with the srcSize
+// of the source archive file in bytes. The timeout is the TimeoutDefunct duration
+// plus the estimated time to extract the source at 2 MB per second, capped at TimeoutMax.
+//
+// Small archives are given less time than the fixed TimeoutExtract,
+// while large archives are given more time to prevent premature timeouts.
+func TimeoutScale(srcSize int64) time.Duration {
+	if srcSize < 0 {
+		srcSize = 0
+	}
+	d := TimeoutDefunct + time.Duration(srcSize/throughput)*time.Second
+	return min(d, TimeoutMax)
+}
+
+// Throughput are the rough numbers of source bytes extracted per second for each archive format,
+// which are used by EstimateExtractTime. Formats that are not listed use 2 MB per second.
+// Solid and dictionary compressed formats are slower, while stored and tape archives are faster.
+var Throughput = map[magicnumber.Signature]int64{
+	magicnumber.X7zCompressArchive:   1 * 1024 * 1024,
+	magicnumber.RoshalARchive:        2 * 1024 * 1024,
+	magicnumber.RoshalARchivev5:      2 * 1024 * 1024,
+	magicnumber.XZCompressArchive:    1 * 1024 * 1024,
+	magicnumber.Bzip2CompressArchive: 1 * 1024 * 1024,
+	magicnumber.GzipCompressArchive:  8 * 1024 * 1024,
+	magicnumber.ZStandardArchive:     16 * 1024 * 1024,
+	magicnumber.TapeARchive:          32 * 1024 * 1024,
+	magicnumber.PKWAREZip:            8 * 1024 * 1024,
+	magicnumber.PKWAREZip64:          8 * 1024 * 1024,
+	magicnumber.PKWAREZipShrink:      1 * 1024 * 1024,
+	magicnumber.PKWAREZipReduce:      1 * 1024 * 1024,
+	magicnumber.PKWAREZipImplode:     1 * 1024 * 1024,
+	magicnumber.ARChiveSEA:           512 * 1024,
+	magicnumber.ArchiveRobertJung:    1 * 1024 * 1024,
+	magicnumber.YoshiLHA:             1 * 1024 * 1024,
+	magicnumber.ZooArchive:           512 * 1024,
+}
+
+// EstimateExtractTime returns a rough estimate of the time needed to extract the src archive,
+// using the size of the file and the [Throughput] of the detected archive format.
+// It is not precise and is intended for scheduling, adaptive timeouts and progress indicators.
+func EstimateExtractTime(src string) (time.Duration, error) {
+	st, err := os.Stat(src)
+	if err != nil {
+		return 0, fmt.Errorf("estimate extract time %w", err)
+	}
+	sign, err := signature(src)
+	if err != nil {
+		return 0, fmt.Errorf("estimate extract time %w", err)
+	}
+	rate, ok := Throughput[sign]
+	if !ok || rate <= 0 {
+		rate = throughput
+	}
+	return time.Duration(float64(st.Size()) / float64(rate) * float64(time.Second)), nil
+}
+
+// timeout returns the maximum time allowed for the extraction of the source archive.
+// The fallback duration is returned when the TimeoutFunc is nil or the source cannot be read.
+func (x Extractor) timeout(fallback time.Duration) time.Duration {
+	if x.TimeoutFunc == nil {
+		return fallback
+	}
+	st, err := os.Stat(x.Source)
+	if err != nil {
+		return fallback
+	}
+	return x.TimeoutFunc(st.Size())
+}
+
+// context returns a context for the archiver program that is canceled after the timeout,
+// or at the deadline of the extractor when that is sooner, or when the parent context
+// given to ExtractContext is done.
+func (x Extractor) context(fallback time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := withTimeout(x.ctx, x.timeout(fallback))
+	if x.deadline.IsZero() {
+		return ctx, cancel
+	}
+	ctx, cancelDeadline := context.WithDeadline(ctx, x.deadline)
+	return ctx, func() {
+		cancelDeadline()
+		cancel()
+	}
+}
+
+// ExtractDeadline extracts the targets from the source file archive to the destination directory,
+// the same as Extract, but every archiver program must finish by the absolute deadline.
+// This aligns the extraction with the overall budget of an incoming server request.
+// The relative timeouts of the archiver programs still apply, so whichever is sooner is used.
+//
+// If the deadline has already passed then context.DeadlineExceeded is returned
+// without attempting the extraction.
+func (x Extractor) ExtractDeadline(deadline time.Time, targets ...string) error {
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return fmt.Errorf("extractor extract deadline %w", context.DeadlineExceeded)
+	}
+	x.deadline = deadline
+	return x.Extract(targets...)
+}
+
+// ExtractContext extracts the targets from the source file archive to the destination directory,
+// the same as Extract, but the archiver programs are stopped when the ctx is canceled,
+// for example when the client of a web handler disconnects.
+//
+// When the ctx has a deadline, it replaces the fixed TimeoutExtract and TimeoutDefunct durations
+// and any TimeoutFunc, otherwise those timeouts still apply. The returned error wraps the ctx error
+// when the ctx is done, so context.Canceled and context.DeadlineExceeded can be checked by the caller.
+func (x Extractor) ExtractContext(ctx context.Context, targets ...string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("extractor extract context %w", err)
+	}
+	x.ctx = ctx
+	if err := x.Extract(targets...); err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			return fmt.Errorf("extractor extract context %w: %w", cerr, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// withTimeout returns a context of the parent that is canceled after the timeout,
+// unless the parent has its own deadline, which then replaces the timeout.
+// A nil parent is the same as context.Background.
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if _, ok := parent.Deadline(); ok {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// destDir returns an error if the dst directory is empty, does not exist, is a file or is not writable.
+func destDir(dst string) error {
+	if dst == "" {
+		return ErrDest
+	}
+	st, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, dst)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%w: %s", ErrPath, dst)
+	}
+	return writable(dst)
+}
+
+// destWritable returns an error if the dst directory is empty, is a file or is not writable.
+// Many archiver programs create a missing destination, so when dst does not exist
+// the nearest existing parent directory is checked instead.
+// The check is done before any archiver program is run, so a read-only destination
+// returns ErrDestReadOnly rather than a program error partway through the extraction.
+func destWritable(dst string) error {
+	if dst == "" {
+		return ErrDest
+	}
+	dir := dst
+	for {
+		st, err := os.Stat(dir)
+		if err == nil {
+			if !st.IsDir() {
+				return fmt.Errorf("%w: %s", ErrPath, dir)
+			}
+			return writable(dir)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", err, dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("%w: %s", err, dst)
+		}
+		dir = parent
+	}
+}
+
+// writable returns ErrDestReadOnly if a temporary file cannot be created and removed in the dir directory.
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".archive-write-*")
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrDestReadOnly, dir)
+	}
+	name := f.Name()
+	f.Close()
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("%w: %s", ErrDestReadOnly, dir)
+	}
+	return nil
+}
+
+// listing is the listing of the members of the source archive, which is read once before
+// the extraction and shared by the checks of the archive against the limits of the Extractor.
+type listing struct {
+	names      []string // names of the members of the archive, including the directories and duplicates
+	size       int64    // size is the total uncompressed size of the members
+	compressed int64    // compressed is the total compressed size of the members
+	sized      bool     // sized is true when the listing reports the uncompressed size of every member
+}
+
+// members returns the listing of the source archive using the reader of the sign file type signature,
+// so the file program is never used. Tar and zip archives are read natively, and the other
+// formats use the same archiver programs as a listing, which are stopped with the ctx.
+// The names are unfiltered, so they include the directories and any duplicates that Clean removes,
+// as an archiver program still writes those members.
+func (x Extractor) members(sign magicnumber.Signature) (listing, error) {
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		// gzip compressed files that are not tarballs are read by the signature reader
+		if l, err := tarMembers(x.Source); err == nil {
+			return l, nil
+		}
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		return zipMembers(x.Source)
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		// the brief list command of the rar reader has no sizes
+		entries, err := rarTechnical(x.ctx, x.Source)
+		if err != nil {
+			return listing{}, err
+		}
+		names := make([]string, len(entries))
+		for i, e := range entries {
+			names[i] = e.Name
+		}
+		return contentMembers(Content{Files: names, Entries: entries}), nil
+	case
+		magicnumber.MicrosoftCABinet,
+		magicnumber.XZCompressArchive,
+		magicnumber.ZStandardArchive:
+		return x.bsdtarMembers()
+	case
+		magicnumber.PKSFX,
+		magicnumber.Unknown:
+		if enc, _ := pkzip.EncryptionType(x.Source); enc == pkzip.AES {
+			return zipMembers(x.Source)
+		}
+		if DMS(x.Source) {
+			// a disk image is extracted as a single file named after the source
+			return listing{}, nil
+		}
+		if ext, _ := SFXFormat(x.Source); ext != "" {
+			c := Content{ctx: x.ctx, raw: true}
+			if err := c.read(x.Source, ext); err != nil {
+				return listing{}, err
+			}
+			return contentMembers(c), nil
+		}
+	}
+	c := Content{ctx: x.ctx, raw: true}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return listing{}, err
+	}
+	return contentMembers(c), nil
+}
+
+// contentMembers returns the listing of the files and entries of c,
+// which is only sized when the archiver program reports an entry for every file.
+func contentMembers(c Content) listing {
+	compressed, size := c.Sizes()
+	return listing{
+		names: c.Files, size: size, compressed: compressed,
+		sized: len(c.Entries) == len(c.Files),
+	}
+}
+
+// zipMembers returns the listing of the src zip archive using the names and sizes
+// of the central directory, which includes any directory entries.
+func zipMembers(src string) (listing, error) {
+	headers, err := pkzip.CentralDirectory(src)
+	if err != nil {
+		return listing{}, err
+	}
+	l := listing{names: make([]string, 0, len(headers)), sized: true}
+	for _, h := range headers {
+		l.names = append(l.names, h.Name)
+		l.size += h.Size
+		l.compressed += h.CompressedSize
+	}
+	return l, nil
+}
+
+// bsdtarMembers returns the listing of the names within the source archive
+// using the list command of the [bsdtar program], for the formats without a reader.
+//
+// [bsdtar program]: https://man.freebsd.org/cgi/man.cgi?query=bsdtar&sektion=1&format=html
+func (x Extractor) bsdtarMembers() (listing, error) {
+	prog, err := exec.LookPath("bsdtar")
+	if err != nil {
+		return listing{}, fmt.Errorf("archive tar list %w", err)
+	}
+	const (
+		list   = "-t"     // -t list archive contents
+		source = "--file" // -f file path to list
+	)
+	var b bytes.Buffer
+	ctx, cancel := x.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, list, source, x.Source)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		if b.String() != "" {
+			return listing{}, fmt.Errorf("archive tar list %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return listing{}, fmt.Errorf("archive tar list %w: %s", err, prog)
+	}
+	names := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	return listing{names: slices.DeleteFunc(names, func(name string) bool {
+		return name == ""
+	})}, nil
+}
+
+// entries returns ErrTooMany if the number of members in the listing l exceeds MaxEntries.
+func (x Extractor) entries(l listing) error {
+	if MaxEntries <= 0 {
+		return nil
+	}
+	if n := len(l.names); n > MaxEntries {
+		return fmt.Errorf("%w: %d entries exceed the %d maximum", ErrTooMany, n, MaxEntries)
+	}
+	return nil
+}
+
+// inspect lists the source archive once before the extraction to apply MaxEntries and the
+// UnsafePaths, MaxTotalSize and MaxRatio options, which avoids the listing when none are used
+// or when the caller has already checked the listing.
+//
+// An archive that cannot be listed, such as a zip with a damaged central directory or a format
+// without an installed listing program, is left for the archiver program to extract or salvage.
+// Except when MaxTotalSize or MaxRatio are set, as these limits cannot be checked without
+// the sizes of the listing, or when the ctx is done, which return ErrRead.
+func (x Extractor) inspect(sign magicnumber.Signature) error {
+	if x.checked || MaxEntries <= 0 && x.UnsafePaths && x.MaxTotalSize <= 0 && x.MaxRatio <= 0 {
+		return nil
+	}
+	l, err := x.members(sign)
+	if err != nil {
+		if x.MaxTotalSize > 0 || x.MaxRatio > 0 || x.ctx != nil && x.ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", ErrRead, err)
+		}
+		return nil
+	}
+	return x.check(l)
+}
+
+// check applies MaxEntries and the UnsafePaths, MaxTotalSize and MaxRatio options to the listing l.
+func (x Extractor) check(l listing) error {
+	if err := x.entries(l); err != nil {
+		return err
+	}
+	if !x.UnsafePaths {
+		if err := safePaths(l.names); err != nil {
+			return err
+		}
+	}
+	return x.totalSize(l)
+}
+
+// safePaths returns ErrTraversal if any of the names of the archive members is an absolute path
+// or escapes the destination directory.
+func safePaths(names []string) error {
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		if !localPath(name) {
+			return fmt.Errorf("%w: %s", ErrTraversal, name)
+		}
+	}
+	return nil
+}
+
+// totalSize returns ErrTooMany if the total uncompressed size of the listing l exceeds MaxTotalSize,
+// or if the uncompressed size divided by the compressed size exceeds MaxRatio.
+// When the listing does not report the compressed sizes, the size of the source archive is used,
+// and when it does not report the uncompressed sizes, ErrRead is returned as the limits cannot be checked.
+func (x Extractor) totalSize(l listing) error {
+	if x.MaxTotalSize <= 0 && x.MaxRatio <= 0 {
+		return nil
+	}
+	if !l.sized {
+		return fmt.Errorf("%w: the listing has no uncompressed sizes to check against the limits", ErrRead)
+	}
+	compressed, uncompressed := l.compressed, l.size
+	if x.MaxTotalSize > 0 && uncompressed > x.MaxTotalSize {
+		return fmt.Errorf("%w: %d bytes uncompressed exceed the %d maximum",
+			ErrTooMany, uncompressed, x.MaxTotalSize)
+	}
+	if x.MaxRatio <= 0 || uncompressed == 0 {
+		return nil
+	}
+	if compressed <= 0 {
+		st, err := os.Stat(x.Source)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrRead, err)
+		}
+		compressed = max(st.Size(), 1)
+	}
+	if ratio := float64(uncompressed) / float64(compressed); ratio > x.MaxRatio {
+		return fmt.Errorf("%w: %.1f compression ratio exceeds the %.1f maximum",
+			ErrTooMany, ratio, x.MaxRatio)
+	}
+	return nil
+}
+
+// localPath returns true if the name of an archive member is a relative path that stays within
+// the destination once cleaned. Both forward and backslash separators are treated as separators,
+// and names with an MS-DOS drive letter, such as "C:\AUTOEXEC.BAT", are treated as absolute.
+func localPath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if len(name) > 1 && name[1] == ':' {
+		return false
+	}
+	if strings.HasPrefix(name, "/") {
+		return false
+	}
+	return filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// retryDelay is the delay before the first retry of an extraction, which doubles with each attempt.
+const retryDelay = 250 * time.Millisecond
+
+// retryWait returns the delay before the retry of the zero-based attempt,
+// which doubles the retryDelay with each attempt but never exceeds TimeoutExtract,
+// so a large number of Retries cannot overflow the duration.
+func retryWait(attempt int) time.Duration {
+	delay := retryDelay
+	for range attempt {
+		if delay >= TimeoutExtract/2 {
+			return TimeoutExtract
+		}
+		delay *= 2
+	}
+	return min(delay, TimeoutExtract)
+}
+
+// transientErrnos are the temporary I/O failures that may succeed when retried.
+var transientErrnos = []syscall.Errno{syscall.EIO, syscall.EAGAIN, syscall.ESTALE, syscall.ETIMEDOUT}
+
+// transient returns true if the err is a temporary I/O failure that may succeed when retried,
+// such as an I/O error or a stale file handle of a network mounted file system.
+//
+// The archiver programs report these failures in their standard error output, so an ErrProg
+// is transient when the output contains the message of one of the failures, for example
+// "Input/output error" or "Stale file handle". Other archiver failures are never retried.
+func transient(err error) bool {
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	if !errors.Is(err, ErrProg) {
+		return false
+	}
+	s := strings.ToLower(err.Error())
+	for _, errno := range transientErrnos {
+		if strings.Contains(s, strings.ToLower(errno.Error())) {
+			return true
+		}
+	}
+	return false
+}
+
+// appleTargets returns the targets without the macOS AppleDouble files, so they are never extracted.
+// When the targets are empty and the archive listing has AppleDouble files,
+// all the other files of the listing are returned as the targets.
+// False is returned when there is nothing left to extract.
+func (x Extractor) appleTargets(targets ...string) ([]string, bool, error) {
+	if len(targets) > 0 {
+		targets = slices.DeleteFunc(slices.Clone(targets), AppleDouble)
+		return targets, len(targets) > 0, nil
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, false, fmt.Errorf("apple double %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, false, fmt.Errorf("apple double %w", err)
+	}
+	if !slices.ContainsFunc(c.Files, AppleDouble) {
+		return nil, true, nil
+	}
+	c.SkipAppleDouble()
+	return c.Files, len(c.Files) > 0, nil
+}
+
+// existingLinks returns the symbolic links within the destination directory mapped to their targets,
+// which are taken before the extraction so the links of the caller are never changed by links.
+// Nil is returned when neither AllowLinks or RemoveLinks is set, as the links are then not checked.
+func (x Extractor) existingLinks() map[string]string {
+	if !x.AllowLinks && !x.RemoveLinks {
+		return nil
+	}
+	root, err := filepath.Abs(x.Destination)
+	if err != nil {
+		return nil
+	}
+	existing := map[string]string{}
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if target, err := os.Readlink(path); err == nil {
+			existing[path] = target
+		}
+		return nil
+	})
+	return existing
+}
+
+// links removes the symbolic links created by the extraction from the destination directory
+// when RemoveLinks is set, or when AllowLinks is set, only the created links with targets outside
+// of the destination. The existing links that are unchanged by the extraction are kept.
+// The links are checked after the extraction, as the archiver programs write the files.
+func (x Extractor) links(existing map[string]string) error {
+	if !x.AllowLinks && !x.RemoveLinks {
+		return nil
+	}
+	root, err := filepath.Abs(x.Destination)
+	if err != nil {
+		return fmt.Errorf("links %w", err)
+	}
+	escaped := ""
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if target, ok := existing[path]; ok {
+			if now, err := os.Readlink(path); err == nil && now == target {
+				return nil
+			}
+		}
+		if x.AllowLinks && inside(root, path) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if x.AllowLinks && escaped == "" {
+			escaped, _ = filepath.Rel(root, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("links %w", err)
+	}
+	if escaped != "" {
+		return fmt.Errorf("links %w: %s", ErrTraversal, escaped)
+	}
+	return nil
+}
+
+// inside returns true if the target of the symbolic link at path resolves inside the root directory.
+// The target must be a relative path that stays within the root, and when the target exists,
+// the resolved path, including any other links, must also be within the root.
+func inside(root, path string) bool {
+	target, err := os.Readlink(path)
+	if err != nil || filepath.IsAbs(target) {
+		return false
+	}
+	rel, err := filepath.Rel(root, filepath.Join(filepath.Dir(path), target))
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	base, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	rel, err = filepath.Rel(base, resolved)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// capture is the standard output and standard error of the archiver programs.
+type capture struct {
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// ExtractVerbose extracts the targets from the source archive to the destination directory,
+// the same as Extract, but also returns the standard output and standard error of the archiver programs.
+// The output is returned even when the extraction is successful, which allows the caller to find
+// archives that were extracted with warnings, such as CRC errors or recovered files, for a manual review.
+// When an extraction is retried or uses a fallback program, the output of every attempt is returned.
+func (x Extractor) ExtractVerbose(targets ...string) (string, string, error) {
+	x.verbose = &capture{}
+	err := x.Extract(targets...)
+	return x.verbose.stdout.String(), x.verbose.stderr.String(), err
+}
+
+// output sets the standard output and standard error of the archiver program cmd,
+// where the standard error is always written to the b buffer, and both are also
+// written to the captured output when used by ExtractVerbose.
+func (x Extractor) output(cmd *exec.Cmd, b *bytes.Buffer) {
+	cmd.Stderr = b
+	if x.verbose == nil {
+		return
+	}
+	cmd.Stdout = &x.verbose.stdout
+	cmd.Stderr = io.MultiWriter(b, &x.verbose.stderr)
+}
+
+// warn writes a warning line to the captured standard error used by ExtractVerbose,
+// such as the use of a fallback archiver program. It is discarded by the other methods.
+func (x Extractor) warn(format string, a ...any) {
+	if x.verbose == nil {
+		return
+	}
+	fmt.Fprintf(&x.verbose.stderr, format+"\n", a...)
+}
+
+// ExtractExecutable extracts the best matching MS-DOS or Windows program from the source archive
+// to the destination directory and returns the path of the extracted file.
+// The program is chosen using [Executable], which prefers an EXE, COM or BAT file named after the archive.
+// If the archive does not contain a program then ErrRead is returned.
+func (x Extractor) ExtractExecutable() (string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return "", fmt.Errorf("extract executable %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return "", fmt.Errorf("extract executable %w", err)
+	}
+	name := Executable(filepath.Base(x.Source), c.Files...)
+	if name == "" {
+		return "", fmt.Errorf("extract executable %w: no program found", ErrRead)
+	}
+	path, err := x.extractNamed(name)
+	if err != nil {
+		return "", fmt.Errorf("extract executable %w", err)
+	}
+	return path, nil
+}
+
+// EntryPoint extracts the program that is used to start or install the release in the source archive
+// to the destination directory and returns the path of the extracted file.
+// The program is chosen using [Launcher], which prefers an INSTALL or SETUP program,
+// followed by an AUTOEXEC or AUTORUN program, a program named after the archive, or the sole program.
+// If the archive does not contain a clear entry point then ErrRead is returned.
+func (x Extractor) EntryPoint() (string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return "", fmt.Errorf("entry point %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return "", fmt.Errorf("entry point %w", err)
+	}
+	name := Launcher(filepath.Base(x.Source), c.Files...)
+	if name == "" {
+		return "", fmt.Errorf("entry point %w: no launcher found", ErrRead)
+	}
+	path, err := x.extractNamed(name)
+	if err != nil {
+		return "", fmt.Errorf("entry point %w", err)
+	}
+	return path, nil
+}
+
+// PreviewImage extracts the most likely screenshot or preview image in the source archive
+// to the destination directory and returns the path of the extracted file.
+// The image is chosen using [Preview], which prefers an image named as a screenshot or preview,
+// followed by an image named after the archive, and then the largest image.
+// If the archive does not contain an image then ErrRead is returned.
+func (x Extractor) PreviewImage() (string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return "", fmt.Errorf("preview image %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return "", fmt.Errorf("preview image %w", err)
+	}
+	entries := c.Entries
+	if len(entries) == 0 {
+		// the sizes are unknown when the archive listing only reports the names
+		for _, name := range c.Files {
+			entries = append(entries, Entry{Name: name})
+		}
+	}
+	name := Preview(filepath.Base(x.Source), entries...)
+	if name == "" {
+		return "", fmt.Errorf("preview image %w: no image found", ErrRead)
+	}
+	path, err := x.extractNamed(name)
+	if err != nil {
+		return "", fmt.Errorf("preview image %w", err)
+	}
+	return path, nil
+}
+
+// extractNamed extracts the named file from the source archive to the destination directory
+// and returns the path of the extracted file.
+func (x Extractor) extractNamed(name string) (string, error) {
+	if err := x.Extract(name); err != nil {
+		return "", err
+	}
+	names := x.nameMap([]string{name})
+	path, found := names[strings.ToLower(filepath.ToSlash(name))]
+	if !found {
+		// some archiver programs do not keep the directory paths
+		path, found = names[strings.ToLower(filepath.Base(name))]
+	}
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrMissing, name)
+	}
+	return filepath.Join(x.Destination, filepath.FromSlash(path)), nil
+}
+
+// ExtractSince extracts the files within the source archive that were modified after the t time
+// to the destination directory, and returns the names of the extracted files.
+// No files are extracted when none were modified after the time.
+//
+// The modification times are read from the archive listing, which are available for
+// the 7z, ARC, ARJ, LHA, TAR and ZIP formats. Other formats return ErrModified.
+func (x Extractor) ExtractSince(t time.Time) ([]string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract since %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, fmt.Errorf("extract since %w", err)
+	}
+	if len(c.Entries) == 0 {
+		return nil, fmt.Errorf("extract since %w: %s", ErrModified, sign)
+	}
+	names := []string{}
+	for _, e := range c.Entries {
+		if e.Modified.IsZero() {
+			return nil, fmt.Errorf("extract since %w: %s", ErrModified, e.Name)
+		}
+		if e.Modified.After(t) {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		return names, nil
+	}
+	if err := x.Extract(names...); err != nil {
+		return nil, fmt.Errorf("extract since %w", err)
+	}
+	return names, nil
+}
+
+// ExtractByExt extracts the files within the source archive with a filename extension in exts
+// to the destination directory, and returns the paths of the extracted files in the order of the listing.
+// The extensions are matched regardless of case, with or without the leading dot,
+// so "txt" and ".TXT" both match "README.TXT" and "readme.txt".
+// No files are extracted when none of the files match.
+func (x Extractor) ExtractByExt(exts ...string) ([]string, error) {
+	want := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+		if ext != "" {
+			want["."+ext] = true
+		}
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract by ext %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, fmt.Errorf("extract by ext %w", err)
+	}
+	names := []string{}
+	for _, name := range c.Files {
+		if want[strings.ToLower(filepath.Ext(name))] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{}, nil
+	}
+	if err := x.Extract(names...); err != nil {
+		return nil, fmt.Errorf("extract by ext %w", err)
+	}
+	extracted := x.nameMap(names)
+	paths := []string{}
+	for _, name := range names {
+		path, found := extracted[strings.ToLower(filepath.ToSlash(name))]
+		if !found {
+			// some archiver programs do not keep the directory paths
+			path, found = extracted[strings.ToLower(filepath.Base(name))]
+		}
+		if found {
+			paths = append(paths, filepath.Join(x.Destination, filepath.FromSlash(path)))
+		}
+	}
+	return paths, nil
+}
+
+// ExtractSalvage extracts the targets from the source archive to the destination directory
+// one file at a time, and returns the names of the files that were extracted, together with
+// an errors.Join of the errors of the files that failed. If the targets are empty then all the
+// files of the archive listing are extracted. It is intended to recover the good files of a
+// partially corrupt archive, as a single damaged file does not stop the other extractions.
+//
+// The extraction of each file runs an archiver program, so it is slower than Extract.
+// An archive that cannot be listed returns the error of the listing and no names.
+func (x Extractor) ExtractSalvage(targets ...string) ([]string, error) {
+	if err := destWritable(x.Destination); err != nil {
+		return nil, fmt.Errorf("extract salvage %w", err)
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract salvage %w", err)
+	}
+	if err := x.inspect(sign); err != nil {
+		return nil, fmt.Errorf("extract salvage %w", err)
+	}
+	if x.CaseInsensitive {
+		targets = x.matchTargets(targets...)
+	}
+	if x.SkipAppleDouble {
+		var ok bool
+		targets, ok, err = x.appleTargets(targets...)
+		if err != nil || !ok {
+			return nil, err
+		}
+	}
+	existing := x.existingLinks()
+	names, err := x.extractEach(sign, nil, targets...)
+	if ferr := x.finish(existing); ferr != nil {
+		err = errors.Join(err, ferr)
+	}
+	return names, err
+}
+
+// extractEach extracts the targets, or every file of the archive listing, one at a time
+// from the source archive of the sign file type signature, and returns the names of the
+// extracted files and the joined errors of the failed files. The cause is the error of the
+// failed extraction of the whole archive, which is returned when the archive cannot be listed.
+// The archive and destination are expected to be checked before the extraction.
+func (x Extractor) extractEach(sign magicnumber.Signature, cause error, targets ...string) ([]string, error) {
+	names := targets
+	if len(names) == 0 {
+		c := Content{ctx: x.ctx}
+		if err := c.readSign(x.Source, sign); err != nil {
+			return nil, errors.Join(cause, fmt.Errorf("extract each %w", err))
+		}
+		names = c.Files
+	}
+	extracted := []string{}
+	errs := []error{}
+	for _, name := range names {
+		if err := x.extract(sign, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		extracted = append(extracted, name)
+	}
+	return extracted, errors.Join(errs...)
+}
+
+// ExtractList extracts the targets from the source archive to the destination directory,
+// and returns the paths of all the files in the destination directory after the extraction.
+// If the targets are empty then all files are extracted.
+//
+// The paths are in lexical order unless ListOrder is set, when they are in the order
+// the files are stored within the archive listing. Paths that are not found in the listing,
+// such as files that existed before the extraction, are kept in lexical order after the listed files.
+func (x Extractor) ExtractList(targets ...string) ([]string, error) {
+	if err := x.Extract(targets...); err != nil {
+		return nil, fmt.Errorf("extract list %w", err)
+	}
+	paths := []string{}
+	err := filepath.WalkDir(x.Destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("extract list %w", err)
+	}
+	if !x.ListOrder {
+		return paths, nil
+	}
+	if err := x.listOrder(paths); err != nil {
+		return nil, fmt.Errorf("extract list %w", err)
+	}
+	return paths, nil
+}
+
+// listOrder sorts the paths of the extracted files in the order of the source archive listing.
+// The names are matched regardless of case and, as some archiver programs do not keep
+// the directory paths, also by the base name of the file.
+func (x Extractor) listOrder(paths []string) error {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return err
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return err
+	}
+	order := make(map[string]int, len(c.Files))
+	bases := make(map[string]int, len(c.Files))
+	for i, name := range c.Files {
+		name = strings.ToLower(filepath.ToSlash(name))
+		if _, exists := order[name]; !exists {
+			order[name] = i
+		}
+		if _, exists := bases[path.Base(name)]; !exists {
+			bases[path.Base(name)] = i
+		}
+	}
+	position := func(name string) int {
+		rel, err := filepath.Rel(x.Destination, name)
+		if err != nil {
+			return len(c.Files)
+		}
+		rel = strings.ToLower(filepath.ToSlash(rel))
+		if i, found := order[rel]; found {
+			return i
+		}
+		if i, found := bases[path.Base(rel)]; found {
+			return i
+		}
+		return len(c.Files)
+	}
+	slices.SortStableFunc(paths, func(a, b string) int {
+		return position(a) - position(b)
+	})
+	return nil
+}
+
+// ExtractExcludingNames extracts the files within the source archive to the destination directory,
+// except for the files with lowercased names that are true in the seen map, and returns the names
+// of the extracted files. The seen map is not modified, so the caller can add the returned names
+// before extracting the sibling archives of a multi-archive release into the same destination.
+// No files are extracted when all the names have been seen.
+func (x Extractor) ExtractExcludingNames(seen map[string]bool) ([]string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract excluding names %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, fmt.Errorf("extract excluding names %w", err)
+	}
+	names := []string{}
+	for _, name := range c.Files {
+		if !seen[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return names, nil
+	}
+	if err := x.Extract(names...); err != nil {
+		return nil, fmt.Errorf("extract excluding names %w", err)
+	}
+	return names, nil
+}
+
+// matchTargets returns the targets replaced with the names of the files within the source archive
+// that match regardless of case. Targets with an exact match or without any match are unchanged,
+// as are all the targets when the archive cannot be listed.
+func (x Extractor) matchTargets(targets ...string) []string {
+	if len(targets) == 0 {
+		return targets
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return targets
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return targets
+	}
+	matched := make([]string, len(targets))
+	for i, target := range targets {
+		matched[i] = target
+		if slices.Contains(c.Files, target) {
+			continue
+		}
+		for _, name := range c.Files {
+			if strings.EqualFold(name, target) {
+				matched[i] = name
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// NameMap returns a map of the lowercased names of the extracted files in the destination
+// directory mapped to their original names, as they were written by the archiver program.
+// The names are relative to the destination directory and use forward slashes.
+//
+// Many handled file archives are created on case-insensitive MS-DOS FAT16 or Windows FAT32
+// file systems, where documents and scripts may refer to the same file in mixed case.
+// The map allows these references to be resolved on case-sensitive file systems
+// after the extraction, for example a reference to "Readme.Txt" can be resolved using
+// the key "readme.txt" to the extracted "README.TXT" file.
+//
+// Only the files named in the listing of the source archive are included, so any other files
+// that existed in the destination before the extraction are not. The names are matched
+// regardless of case, control characters and the codepage of any non-ASCII characters,
+// which the archiver programs and AutoCharset can change. When the source archive cannot
+// be listed, every file in the destination directory is included.
+//
+// When multiple files only differ by case, the first file in lexical order is kept.
+// A nil map is returned if the destination is empty or cannot be read.
+func (x Extractor) NameMap() map[string]string {
+	if x.Destination == "" {
+		return nil
+	}
+	sign, err := signature(x.Source)
+	if err != nil {
+		return x.nameMap(nil)
+	}
+	l, err := x.members(sign)
+	if err != nil {
+		return x.nameMap(nil)
+	}
+	return x.nameMap(l.names)
+}
+
+// nameMap returns the NameMap of the files in the destination directory that are named by the listed
+// names of the source archive, after any StripComponents levels are removed and the Rename function
+// is applied. As some archiver programs do not keep the directory paths, a file in the root of the
+// destination also matches the base of a listed name. Every file is included when listed is empty.
+func (x Extractor) nameMap(listed []string) map[string]string {
+	keys := make(map[string]bool, len(listed)*2)
+	for _, name := range listed {
+		name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+		if x.StripComponents > 0 || x.Rename != nil {
+			moved, err := x.movedName(name)
+			if err != nil || moved == "" {
+				continue
+			}
+			name = filepath.ToSlash(moved)
+		}
+		keys[nameKey(name)] = true
+		keys[nameKey(path.Base(name))] = true
+	}
+	names := make(map[string]string)
+	err := filepath.WalkDir(x.Destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(x.Destination, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if len(listed) > 0 && !keys[nameKey(rel)] {
+			return nil
+		}
+		key := strings.ToLower(rel)
+		if _, exists := names[key]; !exists {
+			names[key] = rel
+		}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// nameKey returns the name lowercased with the control characters removed and each run of
+// non-ASCII characters or bytes replaced by a single question mark, so a name stored in the
+// archive using a codepage matches the name of the file written by an archiver program,
+// which could be converted to ISO 8859-1 or decoded to UTF-8.
+func nameKey(name string) string {
+	var b strings.Builder
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 0x80:
+			if ascii {
+				b.WriteByte('?')
+			}
+			ascii = false
+			continue
+		case c < 0x20 || c == 0x7f:
+		case c >= 'A' && c <= 'Z':
+			b.WriteByte(c + 'a' - 'A')
+		default:
+			b.WriteByte(c)
+		}
+		ascii = true
+	}
+	return b.String()
+}
+
+// zipModes sets the permissions of the files extracted from the zip archive
+// to the Unix modes that are stored in the external attributes of the archive.
+// Files created on MS-DOS and Windows do not store a Unix mode and are skipped,
+// as are any files that were not extracted to the destination.
+func (x Extractor) zipModes() error {
+	r, err := zip.OpenReader(x.Source)
+	if err != nil {
+		return fmt.Errorf("zip modes %w", err)
+	}
+	defer r.Close()
+	const unix = 3
+	for _, file := range r.File {
+		if file.CreatorVersion>>8 != unix || !file.Mode().IsRegular() || !filepath.IsLocal(file.Name) {
+			continue
+		}
+		path := filepath.Join(x.Destination, filepath.FromSlash(file.Name))
+		if st, err := os.Lstat(path); err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		if err := os.Chmod(path, file.Mode().Perm()); err != nil {
+			return fmt.Errorf("zip modes %w", err)
+		}
+	}
+	return nil
+}
+
+// tarModes removes the setuid, setgid and sticky bits from the files and directories extracted
+// by the bsdtar program when PreserveModes is set, as bsdtar restores these bits when it is run
+// by root. Only the paths of the members of the archive are changed.
+func (x Extractor) tarModes() error {
+	l, err := tarMembers(x.Source)
+	if err != nil {
+		// the compressed tarballs and other formats that are not read natively
+		if l, err = x.bsdtarMembers(); err != nil {
+			return fmt.Errorf("tar modes %w", err)
+		}
+	}
+	const special = fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+	for _, name := range l.names {
+		if !localPath(name) {
+			continue
+		}
+		path := filepath.Join(x.Destination, filepath.FromSlash(name))
+		st, err := os.Lstat(path)
+		if err != nil || st.Mode()&special == 0 {
+			continue
+		}
+		if err := os.Chmod(path, st.Mode().Perm()); err != nil {
+			return fmt.Errorf("tar modes %w", err)
+		}
+	}
+	return nil
+}
+
+// extractMoved extracts the targets to a temporary directory within the destination
+// and then moves the files to the destination using the StripComponents and Rename names.
+func (x Extractor) extractMoved(targets ...string) error {
+	if err := destWritable(x.Destination); err != nil {
+		return fmt.Errorf("extractor moved %w", err)
+	}
+	tmp, err := os.MkdirTemp(x.Destination, ".moved-")
+	if err != nil {
+		return fmt.Errorf("extractor moved %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	y := x
+	y.Destination, y.StripComponents, y.Rename = tmp, 0, nil
+	// the files salvaged by ContinueOnError are still moved
+	extractErr := y.Extract(targets...)
+	if extractErr != nil && !x.ContinueOnError {
+		return extractErr
+	}
+	moves, err := x.moves(tmp)
+	if err != nil {
+		return errors.Join(extractErr, fmt.Errorf("extractor moved %w", err))
+	}
+	links := []string{}
+	for src, dst := range moves {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return errors.Join(extractErr, fmt.Errorf("extractor moved %w", err))
+		}
+		if st, err := os.Lstat(src); err == nil && st.Mode()&fs.ModeSymlink != 0 {
+			links = append(links, dst)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return errors.Join(extractErr, fmt.Errorf("extractor moved %w", err))
+		}
+	}
+	if err := x.movedLinks(links); err != nil {
+		return errors.Join(extractErr, fmt.Errorf("extractor moved %w", err))
+	}
+	return extractErr
+}
+
+// movedLinks removes the moved symbolic links with targets that resolve outside the destination
+// directory, as a relative target that stayed inside the temporary directory can escape once
+// StripComponents or Rename changes the depth of the link. ErrTraversal is returned
+// with the first of the removed links.
+func (x Extractor) movedLinks(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	root, err := filepath.Abs(x.Destination)
+	if err != nil {
+		return err
+	}
+	slices.Sort(paths)
+	escaped := ""
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if inside(root, path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if escaped == "" {
+			escaped, _ = filepath.Rel(root, path)
+		}
+	}
+	if escaped != "" {
+		return fmt.Errorf("%w: %s", ErrTraversal, escaped)
+	}
+	return nil
+}
+
+// movedName returns the destination name of the rel path of an extracted file,
+// with the StripComponents directory levels removed and then the Rename function applied.
+// An empty name is returned for files that are skipped.
+func (x Extractor) movedName(rel string) (string, error) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) <= x.StripComponents {
+		return "", nil
+	}
+	name := strings.Join(parts[x.StripComponents:], "/")
+	if x.Rename == nil {
+		return filepath.FromSlash(name), nil
+	}
+	renamed := x.Rename(name)
+	if renamed == "" {
+		return "", nil
+	}
+	renamed = filepath.Clean(filepath.FromSlash(renamed))
+	if !filepath.IsLocal(renamed) {
+		return "", fmt.Errorf("%w: %s renamed to %s", ErrRename, name, renamed)
+	}
+	return renamed, nil
+}
+
+// moves returns the paths of the files in the tmp directory mapped to their destination paths
+// using the movedName of each file, where the skipped files are not included.
+// ErrCollision is returned when two files share a destination path or a destination path already exists.
+func (x Extractor) moves(tmp string) (map[string]string, error) {
+	moves := map[string]string{}
+	owner, dirs := map[string]string{}, map[string]string{}
+	err := filepath.WalkDir(tmp, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			return err
+		}
+		name, err := x.movedName(rel)
+		if err != nil || name == "" {
+			return err
+		}
+		if prev, ok := owner[name]; ok {
+			return fmt.Errorf("%w: %s and %s", ErrCollision, prev, rel)
+		}
+		if prev, ok := dirs[name]; ok {
+			return fmt.Errorf("%w: %s and %s", ErrCollision, prev, rel)
+		}
+		for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+			if prev, ok := owner[dir]; ok {
+				return fmt.Errorf("%w: %s and %s", ErrCollision, prev, rel)
+			}
+			dirs[dir] = rel
+		}
+		dst := filepath.Join(x.Destination, name)
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("%w: %s exists", ErrCollision, name)
+		}
+		owner[name] = rel
+		moves[path] = dst
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
@@ -28,7 +28,9 @@ func (f Finds) BestMatch() string {
 		i++
 	}
 	slices.SortStableFunc(matches, func(a, b match) int {
-		return cmp.Compare(a.Usability, b.Usability)
+		return cmp.Or(
+			cmp.Compare(a.Usability, b.Usability),
+			cmp.Compare(a.Filename, b.Filename))
 	})
 	for _, m := range matches {
 		return m.Filename // return first result
@@ -40,6 +42,9 @@ const (
 	diz = ".diz"
 	nfo = ".nfo"
 	txt = ".txt"
+	bat = ".bat"
+	com = ".com"
+	exe = ".exe"
 )
 
 // Readme returns the best matching scene text README or NFO file from a collection of files.
@@ -49,6 +54,9 @@ const (
 func Readme(filename string, files ...string) string {
 	f := make(Finds)
 	for _, file := range files {
+		if !regular(file) {
+			continue
+		}
 		name := strings.ToLower(file)
 		base := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
 		ext := strings.ToLower(filepath.Ext(name))
@@ -63,6 +71,15 @@ func Readme(filename string, files ...string) string {
 	return f.BestMatch()
 }
 
+// regular returns true if the name is a file, rather than an empty name
+// from a broken listing or a directory with a trailing slash.
+func regular(name string) bool {
+	if strings.TrimSpace(name) == "" {
+		return false
+	}
+	return !strings.HasSuffix(name, "/") && !strings.HasSuffix(name, "\\")
+}
+
 func matchs(file, name, base string, f Finds) Finds {
 	ext := strings.ToLower(filepath.Ext(name))
 	switch {
@@ -93,6 +110,123 @@ func matchs(file, name, base string, f Finds) Finds {
 	return f
 }
 
+// Executable returns the best matching MS-DOS or Windows program from a collection of files.
+// The filename is the name of the archive file, and the files are the list of files in the archive.
+// Programs named after the archive are preferred, followed by any EXE, COM and then BAT file.
+// Like Readme, the filename matches are case-insensitive.
+func Executable(filename string, files ...string) string {
+	f := make(Finds)
+	base := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	for _, file := range files {
+		if !regular(file) {
+			continue
+		}
+		name := strings.ToLower(filepath.Base(file))
+		ext := filepath.Ext(name)
+		switch {
+		case name == base+exe:
+			// [archive name].exe
+			f[file] = Lvl1
+		case name == base+com:
+			// [archive name].com
+			f[file] = Lvl2
+		case name == base+bat:
+			// [archive name].bat
+			f[file] = Lvl3
+		case ext == exe:
+			// [random].exe
+			f[file] = Lvl4
+		case ext == com:
+			// [random].com
+			f[file] = Lvl5
+		case ext == bat:
+			// [random].bat
+			f[file] = Lvl6
+		}
+	}
+	return f.BestMatch()
+}
+
+// Launcher returns the MS-DOS or Windows program from a collection of files that is used to start or
+// install a release, or an empty string when there is no clear entry point.
+// The filename is the name of the archive file, and the files are the list of files in the archive.
+//
+// The priorities are an INSTALL or SETUP program, followed by an AUTOEXEC or AUTORUN program,
+// followed by a program named after the archive, and finally the sole program in the archive.
+// Like Readme, the filename matches are case-insensitive.
+func Launcher(filename string, files ...string) string {
+	f := make(Finds)
+	base := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	programs := []string{}
+	for _, file := range files {
+		if !regular(file) {
+			continue
+		}
+		name := strings.ToLower(filepath.Base(file))
+		ext := filepath.Ext(name)
+		switch ext {
+		case exe, com, bat:
+			programs = append(programs, file)
+		default:
+			continue
+		}
+		switch strings.TrimSuffix(name, ext) {
+		case "install", "setup":
+			// install.exe or setup.exe
+			f[file] = Lvl1
+		case "autoexec", "autorun":
+			// autoexec.bat or autorun.exe
+			f[file] = Lvl2
+		case base:
+			// [archive name].exe
+			f[file] = Lvl3
+		}
+	}
+	if len(f) == 0 && len(programs) == 1 {
+		return programs[0]
+	}
+	return f.BestMatch()
+}
+
+// images are the file extensions of the images used by Preview.
+var images = []string{".png", ".gif", ".jpg", ".bmp", ".lbm", ".pcx"}
+
+// Preview returns the name of the most likely screenshot or preview image from the entries of an archive,
+// or an empty string when there are no images. The filename is the name of the archive file.
+//
+// The priorities are an image with a name containing "screen" or "preview", or starting with "scr",
+// followed by an image named after the archive, and finally any other image.
+// When there are multiple images with the same priority, the largest image by size is used.
+// Like Readme, the filename matches are case-insensitive.
+func Preview(filename string, entries ...Entry) string {
+	base := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	best, bestLvl, bestSize := "", Usability(0), int64(0)
+	for _, e := range entries {
+		if !regular(e.Name) {
+			continue
+		}
+		name := strings.ToLower(filepath.Base(e.Name))
+		ext := filepath.Ext(name)
+		if !slices.Contains(images, ext) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, ext)
+		lvl := Lvl3
+		switch {
+		case strings.Contains(stem, "screen"), strings.Contains(stem, "preview"), strings.HasPrefix(stem, "scr"):
+			// screen1.png, preview.gif or scr01.pcx
+			lvl = Lvl1
+		case stem == base:
+			// [archive name].gif
+			lvl = Lvl2
+		}
+		if best == "" || lvl < bestLvl || lvl == bestLvl && e.Size > bestSize {
+			best, bestLvl, bestSize = e.Name, lvl, e.Size
+		}
+	}
+	return best
+}
+
 // Usability of search, filename pattern matches.
 type Usability uint
 
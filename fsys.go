@@ -0,0 +1,265 @@
+package archive
+
+// Package file archive/fsys.go contains the extraction functions for sources within an io/fs file system.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/Defacto2/helper"
+	"github.com/Defacto2/magicnumber"
+)
+
+// ExtractFromFS extracts all the files of the named archive within the fsys file system
+// to the dst destination directory, which allows extraction from virtual file systems,
+// such as an embed.FS or the fstest.MapFS used by tests.
+//
+// Zip archives that only use the Deflate or Stored methods, and tar archives that are
+// uncompressed or compressed with gzip or bzip2, are read directly from the fsys file
+// using the Go standard library. These require the file to implement io.ReaderAt,
+// which is the case for the files of an os.DirFS, embed.FS and fstest.MapFS.
+// All other archives and formats are first copied to a temporary file that is then
+// extracted using the archiver programs, the same as Extract.
+//
+// The directly read archives only extract regular files and directories. Their members are
+// checked the same as Extract before any file is written, so ErrTooMany is returned when
+// there are more members than MaxEntries, and ErrTraversal is returned when a member
+// has an absolute path or a path that escapes the destination.
+func ExtractFromFS(fsys fs.FS, name, dst string) error {
+	if err := destDir(dst); err != nil {
+		return fmt.Errorf("extract from fs %w", err)
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("extract from fs %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("extract from fs %w", err)
+	}
+	if st.IsDir() {
+		return fmt.Errorf("extract from fs %w: %s", ErrFile, name)
+	}
+	var r io.Reader = f
+	if ra, ok := f.(io.ReaderAt); ok {
+		done, err := fsysNative(ra, st.Size(), dst)
+		if err != nil {
+			return fmt.Errorf("extract from fs %w", err)
+		}
+		if done {
+			return nil
+		}
+		r = io.NewSectionReader(ra, 0, st.Size())
+	}
+	if err := fsysSpool(r, path.Base(name), dst); err != nil {
+		return fmt.Errorf("extract from fs %w", err)
+	}
+	return nil
+}
+
+// fsysNative extracts the zip or tar archive of the ra reader to the dst directory
+// using the Go standard library. It returns false when the archive format
+// or compression method is not supported, and nothing was extracted.
+//
+// The members are listed and checked the same as Extract before any file is written,
+// which applies MaxEntries and refuses the members with unsafe paths.
+func fsysNative(ra io.ReaderAt, size int64, dst string) (bool, error) {
+	sign, err := magicnumber.Archive(ra)
+	if err != nil {
+		return false, nil
+	}
+	x := Extractor{Destination: dst}
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64:
+		return x.fsysZip(ra, size)
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		return x.fsysTar(ra, size, sign)
+	}
+	return false, nil
+}
+
+// fsysZip extracts the zip archive of the ra reader to the destination directory,
+// unless the archive uses methods other than Deflate or Stored, or is encrypted.
+func (x Extractor) fsysZip(ra io.ReaderAt, size int64) (bool, error) {
+	r, err := zip.NewReader(ra, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return false, nil
+	}
+	const encrypted = 0x1
+	l := listing{sized: true}
+	for _, file := range r.File {
+		if file.Method != zip.Store && file.Method != zip.Deflate || file.Flags&encrypted != 0 {
+			return false, nil
+		}
+		l.names = append(l.names, file.Name)
+		l.size += int64(file.UncompressedSize64)
+		l.compressed += int64(file.CompressedSize64)
+	}
+	if err := x.check(l); err != nil {
+		return true, err
+	}
+	dst := x.Destination
+	for _, file := range r.File {
+		if file.FileInfo().IsDir() {
+			if err := fsysDir(dst, file.Name); err != nil {
+				return true, err
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return true, err
+		}
+		err = fsysWrite(dst, file.Name, file.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// fsysTar extracts the tar archive of the ra reader to the destination directory,
+// decompressing the gzip or bzip2 compressed tarballs of the sign signature.
+// The archive is read twice, first to list and check the members and then to extract them.
+// It returns false when a compressed file is not a tarball.
+func (x Extractor) fsysTar(ra io.ReaderAt, size int64, sign magicnumber.Signature) (bool, error) {
+	r, err := fsysDecompress(io.NewSectionReader(ra, 0, size), sign)
+	if err != nil {
+		return false, nil
+	}
+	l, err := tarListing(tar.NewReader(r))
+	if err != nil && len(l.names) == 0 && sign != magicnumber.TapeARchive {
+		// a compressed file that is not a tarball fails on the first header
+		return false, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("%w: %w", ErrRead, err)
+	}
+	if err := x.check(l); err != nil {
+		return true, err
+	}
+	r, err = fsysDecompress(io.NewSectionReader(ra, 0, size), sign)
+	if err != nil {
+		return true, err
+	}
+	dst := x.Destination
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := fsysDir(dst, hdr.Name); err != nil {
+				return true, err
+			}
+		case tar.TypeReg:
+			if err := fsysWrite(dst, hdr.Name, hdr.ModTime, tr); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// fsysDecompress returns a reader of the r tar archive that decompresses
+// the gzip or bzip2 compressed tarballs of the sign signature.
+func fsysDecompress(r io.Reader, sign magicnumber.Signature) (io.Reader, error) {
+	switch sign {
+	case magicnumber.GzipCompressArchive:
+		return gzip.NewReader(r)
+	case magicnumber.Bzip2CompressArchive:
+		return bzip2.NewReader(r), nil
+	}
+	return r, nil
+}
+
+// fsysLocal returns the path of the named entry within the dst directory,
+// or an empty string if the name is absolute or escapes the destination.
+func fsysLocal(dst, name string) string {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return ""
+	}
+	return filepath.Join(dst, name)
+}
+
+// fsysDir creates the named directory entry within the dst directory.
+func fsysDir(dst, name string) error {
+	p := fsysLocal(dst, name)
+	if p == "" {
+		return nil
+	}
+	return os.MkdirAll(p, 0o755)
+}
+
+// fsysWrite writes the r content of the named file entry within the dst directory
+// using the mod modification time.
+func fsysWrite(dst, name string, mod time.Time, r io.Reader) error {
+	p := fsysLocal(dst, name)
+	if p == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if !mod.IsZero() {
+		_ = os.Chtimes(p, mod, mod)
+	}
+	return nil
+}
+
+// fsysSpool copies the r archive to a temporary file using the base filename
+// and extracts it to the dst directory using the archiver programs.
+func fsysSpool(r io.Reader, base, dst string) error {
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-fs-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, base)
+	f, err := os.Create(src)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	x := Extractor{Source: src, Destination: dst}
+	return x.Extract()
+}
@@ -6,6 +6,7 @@ require (
 	github.com/Defacto2/helper v1.1.5
 	github.com/Defacto2/magicnumber v1.0.5
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/text v0.19.0
 )
 
 require (
@@ -15,6 +16,5 @@ require (
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/exp v0.0.0-20241009180824-f66d83c29e7c // indirect
-	golang.org/x/text v0.19.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
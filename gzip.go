@@ -0,0 +1,94 @@
+package archive
+
+// Package file archive/gzip.go contains the native gzip compressed file reading functions.
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const gzx = ".gz" // gzip compressed file
+
+// Gzip returns the content of the src gzip compressed file using the Go standard library.
+// Unlike the other container formats, gzip only compresses a single file,
+// so this is used for the gzip files that are not tarballs.
+//
+// The modification time and the operating system of the file are read from the gzip header
+// when they are set.
+//
+// The name of the file is the original name stored in the gzip header, which is also
+// reported by the file program as "was", as it remains correct when the gzip file is renamed.
+// Otherwise the name is the src filename without the ".gz" extension.
+func (c *Content) Gzip(src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("archive gzip reader %w", err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("archive gzip reader %w", err)
+	}
+	defer r.Close()
+	e := Entry{Name: gzipName(r.Header.Name, src), SourceOS: gzipOS(r.Header.OS)}
+	// a zero mtime in the header means the time is not set, which is not the Unix epoch
+	if !r.Header.ModTime.IsZero() && r.Header.ModTime.Unix() > 0 {
+		e.Modified = r.Header.ModTime.UTC()
+	}
+	if st, err := f.Stat(); err == nil {
+		e.CompressedSize = st.Size()
+		e.Size = gzipSize(f, st.Size())
+	}
+	c.Files = []string{e.Name}
+	c.Entries = []Entry{e}
+	c.Ext = gzx
+	c.Tool = "compress/gzip"
+	return nil
+}
+
+// gzipName returns the base name of the original file stored in the gzip header,
+// or the src filename without the ".gz" extension when the header has no name.
+func gzipName(original, src string) string {
+	// the name is stored by the creating system, which could use MS-DOS path separators
+	name := filepath.Base(strings.ReplaceAll(original, "\\", "/"))
+	if original != "" && name != "." && name != "/" {
+		return name
+	}
+	name = filepath.Base(src)
+	if strings.EqualFold(filepath.Ext(name), gzx) {
+		return name[:len(name)-len(gzx)]
+	}
+	return name
+}
+
+// gzipSize returns the uncompressed size of the gzip file stored in the trailer,
+// which is the size modulo 4 GiB. Zero is returned when the trailer cannot be read.
+func gzipSize(r io.ReaderAt, size int64) int64 {
+	const trailer = 4
+	if size < trailer {
+		return 0
+	}
+	p := make([]byte, trailer)
+	if _, err := r.ReadAt(p, size-trailer); err != nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint32(p))
+}
+
+// gzipOS returns the name of the operating system of the b value in a gzip header,
+// as listed in RFC 1952, or an empty string for an unknown system.
+func gzipOS(b byte) string {
+	names := [...]string{
+		"FAT", "Amiga", "VMS", "Unix", "VM/CMS", "Atari TOS", "HPFS", "Macintosh",
+		"Z-System", "CP/M", "TOPS-20", "NTFS", "QDOS", "Acorn RISCOS",
+	}
+	if int(b) >= len(names) {
+		return ""
+	}
+	return names[b]
+}
@@ -52,3 +52,26 @@ func MagicLHA(magic string) bool {
 	}
 	return false
 }
+
+// Fields splits the first n whitespace separated fields from the string s.
+// The remainder of the string following the n-th field and a single separator
+// is returned as the rest, which allows filenames containing spaces to be kept intact.
+// If s contains less than n fields then the returned fields will be shorter than n.
+func Fields(s string, n int) ([]string, string) {
+	fields := make([]string, 0, n)
+	rest := s
+	for len(fields) < n {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			return fields, ""
+		}
+		i := strings.IndexAny(rest, " \t")
+		if i < 0 {
+			fields = append(fields, rest)
+			return fields, ""
+		}
+		fields = append(fields, rest[:i])
+		rest = rest[i+1:]
+	}
+	return fields, rest
+}
@@ -0,0 +1,142 @@
+package archive
+
+// Package file archive/join.go contains the reassembly of split files within an archive.
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Defacto2/helper"
+)
+
+// ExtractJoined extracts the files within the source archive that match the pattern,
+// such as "FILE.0*" for the split files "FILE.001", "FILE.002" and "FILE.003",
+// and returns their content joined in the order of their numeric extensions.
+// The pattern uses the syntax of [path.Match] and is matched regardless of case.
+// The files are extracted to a temporary directory that is removed, so the destination is not used.
+//
+// Matched files without a numeric extension are ignored. If no files match then ErrRead is returned,
+// and if the numbers do not start at 0 or 1, or have a gap or a duplicate, then ErrSequence is returned.
+// The total size of the files must not exceed MaxMapSize, otherwise ErrTooMany is returned,
+// which is checked against the listed sizes of the files before any are extracted.
+func (x Extractor) ExtractJoined(pattern string) ([]byte, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	parts, err := splitParts(pattern, c.Files...)
+	if err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	if err := joinedSize(parts, c.Entries); err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-joined-")
+	if err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	x.Destination = tmp
+	names := make([]string, len(parts))
+	for i, p := range parts {
+		names[i] = p.name
+	}
+	if err := x.Extract(names...); err != nil {
+		return nil, fmt.Errorf("extract joined %w", err)
+	}
+	extracted := x.nameMap(names)
+	var b bytes.Buffer
+	for _, name := range names {
+		rel, found := extracted[strings.ToLower(filepath.ToSlash(name))]
+		if !found {
+			// some archiver programs do not keep the directory paths
+			rel, found = extracted[strings.ToLower(path.Base(filepath.ToSlash(name)))]
+		}
+		if !found {
+			return nil, fmt.Errorf("extract joined %w: %s", ErrMissing, name)
+		}
+		p, err := os.ReadFile(filepath.Join(tmp, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, fmt.Errorf("extract joined %w", err)
+		}
+		if int64(b.Len()+len(p)) > MaxMapSize {
+			return nil, fmt.Errorf("extract joined %w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+		}
+		b.Write(p)
+	}
+	return b.Bytes(), nil
+}
+
+// splitPart is a file of a split file set and the number of its extension.
+type splitPart struct {
+	name string
+	num  int
+}
+
+// joinedSize returns ErrTooMany if the total size of the parts listed in the entries exceeds MaxMapSize.
+// The parts without an entry are not counted, as their size is checked once they are extracted.
+func joinedSize(parts []splitPart, entries []Entry) error {
+	sizes := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		sizes[e.Name] = e.Size
+	}
+	total := int64(0)
+	for _, p := range parts {
+		total += sizes[p.name]
+	}
+	if total > MaxMapSize {
+		return fmt.Errorf("%w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+	}
+	return nil
+}
+
+// splitParts returns the files that match the pattern and have a numeric extension,
+// sorted by their number, which must start at 0 or 1 and be in sequence without any gaps or duplicates.
+func splitParts(pattern string, files ...string) ([]splitPart, error) {
+	pattern = strings.ToLower(pattern)
+	parts := []splitPart{}
+	for _, name := range files {
+		if !regular(name) {
+			continue
+		}
+		match, err := path.Match(pattern, strings.ToLower(filepath.ToSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		ext := strings.TrimPrefix(path.Ext(name), ".")
+		num, err := strconv.Atoi(ext)
+		if err != nil || num < 0 || strings.ContainsAny(ext, "+-") {
+			continue
+		}
+		parts = append(parts, splitPart{name: name, num: num})
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no split files match %q", ErrRead, pattern)
+	}
+	slices.SortFunc(parts, func(a, b splitPart) int {
+		return cmp.Compare(a.num, b.num)
+	})
+	if first := parts[0]; first.num > 1 {
+		return nil, fmt.Errorf("%w: %s is not the first file", ErrSequence, first.name)
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i].num != parts[i-1].num+1 {
+			return nil, fmt.Errorf("%w: %s follows %s", ErrSequence, parts[i].name, parts[i-1].name)
+		}
+	}
+	return parts, nil
+}
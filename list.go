@@ -1,6 +1,8 @@
 package archive
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +12,8 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/Defacto2/archive/internal"
+	"github.com/Defacto2/archive/pkzip"
 	"github.com/Defacto2/helper"
 	"github.com/Defacto2/magicnumber"
 )
@@ -22,9 +26,20 @@ var (
 // ExtractSource extracts the source file into a temporary directory.
 // The named file is used as part of the extracted directory path.
 // The src is the source file to extract.
+//
+// A previous extraction of the source is reused when the size and modification time
+// of the source file are unchanged. Otherwise, the stale files are removed and the
+// source is extracted again, so a modified source never returns an old extraction.
 func ExtractSource(src, name string) (string, error) {
+	return extractSource(context.Background(), src, name)
+}
+
+// extractSource extracts the source file into a temporary directory, the same as ExtractSource,
+// where the archiver programs are stopped when the ctx is canceled.
+func extractSource(ctx context.Context, src, name string) (string, error) {
 	const mb150 = 150 * 1024 * 1024
-	if st, err := os.Stat(src); err != nil {
+	st, err := os.Stat(src)
+	if err != nil {
 		return "", fmt.Errorf("cannot stat file: %w", err)
 	} else if st.IsDir() {
 		return "", errIsDir
@@ -35,11 +50,20 @@ func ExtractSource(src, name string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("cannot create content directory: %w", err)
 	}
+	marker := dst + ".stamp"
 	entries, _ := os.ReadDir(dst)
 	const extracted = 2
-	if len(entries) >= extracted {
+	if len(entries) >= extracted && sourceStamp(marker) == stamp(st) {
 		return dst, nil
 	}
+	if len(entries) > 0 {
+		if err := os.RemoveAll(dst); err != nil {
+			return "", fmt.Errorf("cannot remove stale content directory: %w", err)
+		}
+		if dst, err = helper.MkContent(src); err != nil {
+			return "", fmt.Errorf("cannot create content directory: %w", err)
+		}
+	}
 	switch filearchive(src) {
 	case false:
 		newpath := filepath.Join(dst, name)
@@ -48,29 +72,61 @@ func ExtractSource(src, name string) (string, error) {
 			return "", fmt.Errorf("cannot duplicate file: %w", err)
 		}
 	case true:
-		if err := ExtractAll(src, dst); err != nil {
+		x := Extractor{Source: src, Destination: dst}
+		if err := x.ExtractContext(ctx); err != nil {
 			defer os.RemoveAll(dst)
 			return "", fmt.Errorf("cannot read extracted archive: %w", err)
 		}
 	}
+	// the marker is kept outside of the content directory so it is never listed
+	_ = os.WriteFile(marker, []byte(stamp(st)), internal.WriteWriteRead)
 	return dst, nil
 }
 
-func filearchive(src string) bool {
-	r, err := os.Open(src)
+// stamp returns the size and modification time of the source file,
+// which are used to identify the source of an extracted content directory.
+func stamp(st fs.FileInfo) string {
+	return fmt.Sprintf("%d %d", st.Size(), st.ModTime().UnixNano())
+}
+
+// sourceStamp returns the stamp stored in the named marker file or an empty string.
+func sourceStamp(marker string) string {
+	b, err := os.ReadFile(marker)
 	if err != nil {
-		return false
+		return ""
 	}
-	sign, err := magicnumber.Archive(r)
+	return string(b)
+}
+
+func filearchive(src string) bool {
+	sign, err := signature(src)
 	if err != nil {
 		return false
 	}
-	return sign != magicnumber.Unknown
+	if sign == magicnumber.Unknown {
+		// self-extracting programs are archives that are not matched by the magic number
+		ext, _ := SFXFormat(src)
+		return ext != ""
+	}
+	return true
 }
 
 // List returns the files within an rar, tar, lha, or zip archive.
 // This filename extension is used to determine the archive format.
+// Any macOS AppleDouble files are listed, as List has no options and returns the names
+// that can be used as extraction targets, use [AppleDouble] or Content.SkipAppleDouble to filter them.
 func List(src, filename string) ([]string, error) {
+	return ListContext(context.Background(), src, filename)
+}
+
+// ListContext returns the files within the src archive, the same as List,
+// but the archiver programs are stopped when the ctx is canceled.
+// When the ctx has a deadline, it replaces the fixed TimeoutExtract and TimeoutLookup durations,
+// otherwise those timeouts still apply.
+func ListContext(ctx context.Context, src, filename string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("archive list %w", err)
+	}
 	st, err := os.Stat(src)
 	if errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("archive list %w: %s", ErrMissing, filepath.Base(src))
@@ -78,9 +134,12 @@ func List(src, filename string) ([]string, error) {
 	if st.IsDir() {
 		return nil, fmt.Errorf("archive list %w: %s", ErrFile, filepath.Base(src))
 	}
-	path, err := ExtractSource(src, filename)
+	path, err := extractSource(ctx, src, filename)
 	if err != nil {
-		return commander(src, filename)
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, fmt.Errorf("archive list %w: %w", cerr, err)
+		}
+		return commander(ctx, src, filename)
 	}
 	var files []string
 	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
@@ -101,19 +160,356 @@ func List(src, filename string) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("archive list %w", err)
 	}
-	return files, nil
+	c := Content{Files: files}
+	c.Clean()
+	return c.Files, nil
+}
+
+// ListFast returns the files within the src archive using only the native Go readers,
+// without running any external programs, which is much quicker than List when reading many small archives.
+// The archive format is determined using the file type signature rather than the filename extension.
+//
+// The native readers support the zip archives of all compression methods, tar archives
+// including tarballs compressed with gzip or bzip2, and gzip compressed files.
+// Other formats and archives that the native readers cannot read fall back to List.
+func ListFast(src string) ([]string, error) {
+	sign, err := signature(src)
+	if err != nil {
+		return nil, fmt.Errorf("archive list fast %w", err)
+	}
+	var c Content
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.TapeARchive:
+		err = c.Tar(src)
+	case magicnumber.GzipCompressArchive:
+		if err = c.Tar(src); err != nil {
+			err = c.Gzip(src)
+		}
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		err = c.zipNative(src)
+	default:
+		return List(src, filepath.Base(src))
+	}
+	if err != nil {
+		return List(src, filepath.Base(src))
+	}
+	return c.Files, nil
+}
+
+// ListSignature returns the files within the src archive using the reader of the sign archive
+// file type signature, such as the result of an earlier call to [magicnumber.Archive].
+// Unlike List, the archive is not extracted and the file program is not used to determine
+// the format, which is much quicker when listing many archives of a known type.
+//
+// The sign is trusted, so an archive that does not match the signature returns the error of the reader.
+// An unknown signature returns ErrNotArchive and a format without a reader returns ErrNotImplemented.
+func ListSignature(src string, sign magicnumber.Signature) ([]string, error) {
+	var c Content
+	if err := c.readSign(src, sign); err != nil {
+		return nil, fmt.Errorf("archive list signature %w", err)
+	}
+	return c.Files, nil
+}
+
+// ListPage returns a page of the files within the src archive, starting at the offset
+// and containing at most limit names, together with the total number of files,
+// which allows the browsing of archives with hundreds of thousands of files page by page.
+// An offset beyond the total returns an empty page, and a negative offset or limit returns ErrPage.
+//
+// Tar archives, including tarballs compressed with gzip or bzip2, are streamed and zip archives
+// use the central directory, where only the names of the page are kept and the names are in the
+// order stored in the archive. Other formats are listed in full using List and then sliced.
+func ListPage(src, filename string, offset, limit int) ([]string, int, error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, fmt.Errorf("archive list page %w: offset %d, limit %d", ErrPage, offset, limit)
+	}
+	page := []string{}
+	total := 0
+	keep := func(name string) {
+		if total >= offset && total < offset+limit {
+			page = append(page, name)
+		}
+		total++
+	}
+	sign, err := signature(src)
+	if err != nil {
+		return nil, 0, fmt.Errorf("archive list page %w", err)
+	}
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		err := tarNames(src, func(name string) error {
+			keep(name)
+			return nil
+		})
+		if err == nil {
+			return page, total, nil
+		}
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		if headers, err := pkzip.CentralDirectory(src); err == nil {
+			seen := make(map[string]bool, len(headers))
+			for _, h := range headers {
+				if !redundant(h.Name, seen) {
+					keep(h.Name)
+				}
+			}
+			return page, total, nil
+		}
+	}
+	page, total = []string{}, 0
+	files, err := List(src, filename)
+	if err != nil {
+		return nil, 0, fmt.Errorf("archive list page %w", err)
+	}
+	for _, name := range files {
+		keep(name)
+	}
+	return page, total, nil
+}
+
+// zipNative sets the files of the src zip archive using the names in the central directory.
+func (c *Content) zipNative(src string) error {
+	headers, err := pkzip.CentralDirectory(src)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(headers))
+	for _, h := range headers {
+		files = append(files, h.Name)
+	}
+	c.Files = files
+	c.Clean()
+	c.Ext = zipx
+	c.Tool = "pkzip"
+	return nil
+}
+
+// CountEntries returns the number of entries within the src archive without listing the names.
+// The archive format is determined using the file type signature.
+//
+// Tar archives, including tarballs compressed with gzip or bzip2, are counted by streaming the headers,
+// and zip archives use the total entries field of the end of central directory record.
+// Both counts include any directory entries.
+// Other formats fall back to a full listing of the files, using the filename extension to
+// determine the archive format.
+func CountEntries(src, filename string) (int, error) {
+	sign, err := signature(src)
+	if err != nil {
+		return 0, fmt.Errorf("archive count %w", err)
+	}
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		// gzip and bzip2 compressed files that are not tarballs fall back to the listing
+		if n, err := tarCount(src); err == nil {
+			return n, nil
+		}
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		if n, err := pkzip.Count(src); err == nil {
+			return int(n), nil
+		}
+	}
+	files, err := commander(context.Background(), src, filename)
+	if err != nil {
+		return 0, fmt.Errorf("archive count %w", err)
+	}
+	return len(files), nil
 }
 
 // commander uses system archiver and decompression programs to read the src archive file.
-func commander(src, filename string) ([]string, error) {
-	c := Content{}
+func commander(ctx context.Context, src, filename string) ([]string, error) {
+	c := Content{ctx: ctx}
 	if err := c.Read(src); err != nil {
 		return nil, fmt.Errorf("commander failed with %s (%q): %w", filename, c.Ext, err)
 	}
-	// remove empty entries
-	files := c.Files
-	files = slices.DeleteFunc(files, func(s string) bool {
-		return strings.TrimSpace(s) == ""
+	c.Clean()
+	return c.Files, nil
+}
+
+// Merged is a file listed by MergeSources with the source archives that contain it.
+type Merged struct {
+	Name    string   // Name of the file within the archives.
+	Sources []string // Sources are the archive files that contain the named file.
+}
+
+// MergeList returns the combined list of files within the source archives,
+// which is useful for presenting a release spread across multiple archives as one.
+// The files are deduplicated case-insensitively and sorted by name.
+//
+// If some of the sources cannot be listed, the files of the remaining sources
+// are returned together with a joined error of the failures.
+func MergeList(sources ...string) ([]string, error) {
+	merged, err := MergeSources(sources...)
+	files := make([]string, len(merged))
+	for i, m := range merged {
+		files[i] = m.Name
+	}
+	return files, err
+}
+
+// MergeSources returns the combined list of files within the source archives,
+// with each file annotated by the sources that contain it.
+// The files are deduplicated case-insensitively and sorted by name,
+// using the name of the first listed occurrence.
+//
+// If some of the sources cannot be listed, the files of the remaining sources
+// are returned together with a joined error of the failures.
+func MergeSources(sources ...string) ([]Merged, error) {
+	var errs error
+	merged := []Merged{}
+	index := make(map[string]int)
+	for _, src := range sources {
+		files, err := List(src, filepath.Base(src))
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("merge list %w", err))
+			continue
+		}
+		for _, name := range files {
+			key := strings.ToLower(name)
+			if i, exists := index[key]; exists {
+				if !slices.Contains(merged[i].Sources, src) {
+					merged[i].Sources = append(merged[i].Sources, src)
+				}
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, Merged{Name: name, Sources: []string{src}})
+		}
+	}
+	slices.SortFunc(merged, func(a, b Merged) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)),
+			cmp.Compare(a.Name, b.Name))
 	})
-	return files, nil
+	return merged, errs
+}
+
+// Diff returns the differences between the files within the srcA and srcB archives,
+// for example to find if an archive is a re-release of another with extra files.
+// The onlyA files are only found in srcA, the onlyB files are only found in srcB,
+// and both are the files found in both archives, using the names from srcA.
+// The files are compared case-insensitively and each list is sorted by name.
+func Diff(srcA, srcB string) ([]string, []string, []string, error) {
+	filesA, err := List(srcA, filepath.Base(srcA))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("diff %w", err)
+	}
+	filesB, err := List(srcB, filepath.Base(srcB))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("diff %w", err)
+	}
+	inB := make(map[string]bool, len(filesB))
+	for _, name := range filesB {
+		inB[strings.ToLower(name)] = true
+	}
+	inA := make(map[string]bool, len(filesA))
+	onlyA, onlyB, both := []string{}, []string{}, []string{}
+	for _, name := range filesA {
+		key := strings.ToLower(name)
+		inA[key] = true
+		if inB[key] {
+			both = append(both, name)
+			continue
+		}
+		onlyA = append(onlyA, name)
+	}
+	for _, name := range filesB {
+		if !inA[strings.ToLower(name)] {
+			onlyB = append(onlyB, name)
+		}
+	}
+	for _, files := range [][]string{onlyA, onlyB, both} {
+		slices.SortFunc(files, func(a, b string) int {
+			return cmp.Or(
+				cmp.Compare(strings.ToLower(a), strings.ToLower(b)),
+				cmp.Compare(a, b))
+		})
+	}
+	return onlyA, onlyB, both, nil
+}
+
+// SameContents returns true if the srcA and srcB archives contain the same set of files,
+// regardless of the order of the files or the archive format, for example to find
+// a release that was repackaged from a zip archive into a rar archive.
+// The files are compared case-insensitively by name only, see [SameContentsStrict]
+// to also compare the sizes and checksums of the files.
+func SameContents(srcA, srcB string) (bool, error) {
+	onlyA, onlyB, _, err := Diff(srcA, srcB)
+	if err != nil {
+		return false, fmt.Errorf("same contents %w", err)
+	}
+	return len(onlyA) == 0 && len(onlyB) == 0, nil
+}
+
+// SameContentsStrict returns true if the srcA and srcB archives contain the same set of files
+// with the same sizes and CRC-32 checksums, regardless of the order of the files or the archive format.
+//
+// The sizes are compared when the archive listings of both archives report them,
+// and the checksums are compared when both archives store them, which are the ZIP, RAR and 7z formats.
+// Otherwise the files are compared by name, the same as [SameContents].
+func SameContentsStrict(srcA, srcB string) (bool, error) {
+	same, err := SameContents(srcA, srcB)
+	if err != nil || !same {
+		return false, err
+	}
+	sizesA, sizesB := entrySizes(srcA), entrySizes(srcB)
+	// the checksums of each archive are read from a single listing
+	sumsA, _ := Extractor{Source: srcA}.entryCRCs()
+	sumsB, _ := Extractor{Source: srcB}.entryCRCs()
+	for key, e := range sizesA {
+		nameB := e.Name
+		if b, ok := sizesB[key]; ok {
+			if e.Size != b.Size {
+				return false, nil
+			}
+			nameB = b.Name
+		}
+		crcA, okA := lookupCRC(sumsA, e.Name)
+		crcB, okB := lookupCRC(sumsB, nameB)
+		if !okA || !okB {
+			continue
+		}
+		if crcA != crcB {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// entrySizes returns the file entries of the src archive keyed by the lowercase name,
+// which is empty when the archive listing does not report the entries.
+func entrySizes(src string) map[string]Entry {
+	var c Content
+	if sign, err := signature(src); err == nil {
+		_ = c.readSign(src, sign)
+	}
+	sizes := make(map[string]Entry, len(c.Entries))
+	for _, e := range c.Entries {
+		if e.Name == "" || strings.HasSuffix(e.Name, "/") {
+			continue
+		}
+		sizes[strings.ToLower(e.Name)] = e
+	}
+	return sizes
 }
@@ -0,0 +1,190 @@
+package archive
+
+// Package file archive/manifest.go contains the extraction manifest functions.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Manifest is the record of the files extracted from an archive, written by ExtractWithManifest.
+//
+// The JSON format is stable and any future fields will only be added, never renamed or removed.
+//
+//	{
+//	  "source": "PKZ204EX.ZIP",
+//	  "files": [
+//	    {
+//	      "name": "TEST.ANS",
+//	      "path": "TEST.ANS",
+//	      "size": 68,
+//	      "sha256": "a3c4..."
+//	    }
+//	  ]
+//	}
+type Manifest struct {
+	Source string         `json:"source"` // Source is the base name of the archive file.
+	Files  []ManifestFile `json:"files"`  // Files are the extracted files in lexical order of the path.
+}
+
+// ManifestFile is an extracted file recorded in a Manifest.
+type ManifestFile struct {
+	Name   string `json:"name"`   // Name is the base name of the file.
+	Path   string `json:"path"`   // Path is the archive-relative path of the file, using forward slashes.
+	Size   int64  `json:"size"`   // Size is the size of the file in bytes.
+	SHA256 string `json:"sha256"` // SHA256 is the hexadecimal SHA-256 checksum of the file content.
+}
+
+// ExtractWithManifest extracts the targets from the source archive to the destination
+// directory and then writes a JSON [Manifest] of the extracted files to the named path.
+// If no targets are given then all files are extracted.
+//
+// The manifest lists every regular file found in the destination directory after the extraction,
+// so the destination should be empty beforehand. The path of each file is relative to
+// the destination directory, which is the archive-relative path for archiver programs
+// that keep directories. When the manifest path is within the destination directory,
+// it is excluded from the listing.
+func (x Extractor) ExtractWithManifest(path string, targets ...string) error {
+	if path == "" {
+		return ErrManifest
+	}
+	if err := x.Extract(targets...); err != nil {
+		return fmt.Errorf("archive manifest %w", err)
+	}
+	m, err := x.manifest(path)
+	if err != nil {
+		return fmt.Errorf("archive manifest %w", err)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("archive manifest %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("archive manifest %w", err)
+	}
+	return nil
+}
+
+// manifest returns the manifest of the regular files in the destination directory,
+// excluding the manifest file at the named path.
+func (x Extractor) manifest(path string) (Manifest, error) {
+	m := Manifest{Source: filepath.Base(x.Source), Files: []ManifestFile{}}
+	skip, _ := filepath.Abs(path)
+	err := filepath.WalkDir(x.Destination, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(name); abs == skip {
+			return nil
+		}
+		rel, err := filepath.Rel(x.Destination, name)
+		if err != nil {
+			return err
+		}
+		size, sum, err := checksum(name)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, ManifestFile{
+			Name:   d.Name(),
+			Path:   filepath.ToSlash(rel),
+			Size:   size,
+			SHA256: sum,
+		})
+		return nil
+	})
+	return m, err
+}
+
+// checksum returns the size and the hexadecimal SHA-256 checksum of the named file.
+func checksum(name string) (int64, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ManifestEntry is an expected file within an archive, used by MatchesManifest.
+type ManifestEntry struct {
+	Name  string // Name is the path of the file within the archive, using forward slashes.
+	Size  int64  // Size is the uncompressed size of the file in bytes.
+	CRC32 uint32 // CRC32 is the IEEE checksum of the file, or zero to skip the checksum comparison.
+}
+
+// MatchesManifest returns true if the files within the source archive match the expected entries,
+// for example to confirm that a re-downloaded release is identical to a known record.
+// The discrepancies are returned in the order of the expected entries followed by the unexpected files,
+// such as "missing: FILE_ID.DIZ", "size: README.TXT is 120 bytes, expected 118" or "unexpected: EXTRA.TXT".
+//
+// The names are compared case-insensitively. The sizes are compared when the archive listing reports them,
+// and the checksums are compared when an expected CRC32 is set and the archive stores checksums,
+// which are the ZIP, RAR and 7z formats. Nothing is extracted.
+func (x Extractor) MatchesManifest(expected []ManifestEntry) (bool, []string, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return false, nil, fmt.Errorf("matches manifest %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return false, nil, fmt.Errorf("matches manifest %w", err)
+	}
+	entries := c.Entries
+	sized := len(entries) > 0
+	if !sized {
+		for _, name := range c.Files {
+			entries = append(entries, Entry{Name: name})
+		}
+	}
+	found := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		found[strings.ToLower(e.Name)] = e
+	}
+	var sums map[string]uint32
+	if slices.ContainsFunc(expected, func(m ManifestEntry) bool { return m.CRC32 != 0 }) {
+		sums, _ = x.entryCRCs()
+	}
+	diffs := []string{}
+	want := make(map[string]bool, len(expected))
+	for _, m := range expected {
+		key := strings.ToLower(m.Name)
+		want[key] = true
+		e, ok := found[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, "missing: "+m.Name)
+			continue
+		case sized && e.Size != m.Size:
+			diffs = append(diffs, fmt.Sprintf("size: %s is %d bytes, expected %d", m.Name, e.Size, m.Size))
+			continue
+		case m.CRC32 == 0:
+			continue
+		}
+		if sum, ok := lookupCRC(sums, e.Name); ok && sum != m.CRC32 {
+			diffs = append(diffs, fmt.Sprintf("crc: %s is %08x, expected %08x", m.Name, sum, m.CRC32))
+		}
+	}
+	for _, e := range entries {
+		if !want[strings.ToLower(e.Name)] {
+			diffs = append(diffs, "unexpected: "+e.Name)
+		}
+	}
+	return len(diffs) == 0, diffs, nil
+}
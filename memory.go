@@ -0,0 +1,193 @@
+package archive
+
+// Package file archive/memory.go contains the in-memory extraction functions.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/helper"
+	"github.com/Defacto2/magicnumber"
+)
+
+// MaxMapSize is the maximum total uncompressed size in bytes of the files that ExtractMap
+// will hold in memory.
+var MaxMapSize int64 = 16 * 1024 * 1024
+
+// ExtractMap extracts all the files in the source archive into memory and returns
+// a map of their content keyed by the name of the file within the archive.
+// It is intended for small archives, as the total size of the files must not exceed MaxMapSize,
+// otherwise ErrTooMany is returned. The destination directory is not used.
+//
+// The archive is listed before any file is read or extracted, so the listed sizes are checked
+// against MaxMapSize, and MaxEntries and the UnsafePaths, MaxTotalSize and MaxRatio options
+// are applied the same as Extract. ErrRead is returned when the archive cannot be listed.
+//
+// Zip archives that only use the Deflate or Stored methods and tar archives are read
+// using the Go standard library, while other formats are extracted to a temporary directory
+// that is then removed.
+func (x Extractor) ExtractMap() (map[string][]byte, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extract map %w", err)
+	}
+	l, err := x.members(sign)
+	if err != nil {
+		return nil, fmt.Errorf("extract map %w: %w", ErrRead, err)
+	}
+	if err := x.check(l); err != nil {
+		return nil, fmt.Errorf("extract map %w", err)
+	}
+	if l.size > MaxMapSize {
+		return nil, fmt.Errorf("extract map %w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+	}
+	x.checked = true
+	var files map[string][]byte
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		files, err = tarMap(x.Source)
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		if ok, _ := pkzip.Zip(x.Source); ok {
+			files, err = zipMap(x.Source)
+			break
+		}
+		files, err = x.dirMap()
+	default:
+		files, err = x.dirMap()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extract map %w", err)
+	}
+	return files, nil
+}
+
+// mapFile reads the r content of the named file into the files map,
+// returning ErrTooMany when the total size would exceed MaxMapSize.
+func mapFile(files map[string][]byte, total *int64, name string, r io.Reader) error {
+	b, err := io.ReadAll(io.LimitReader(r, MaxMapSize-*total+1))
+	if err != nil {
+		return err
+	}
+	*total += int64(len(b))
+	if *total > MaxMapSize {
+		return fmt.Errorf("%w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+	}
+	files[name] = b
+	return nil
+}
+
+// zipMap reads the files of the src zip archive into memory.
+func zipMap(src string) (map[string][]byte, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	files := make(map[string][]byte)
+	total := int64(0)
+	for _, file := range r.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if total+int64(file.UncompressedSize64) > MaxMapSize {
+			return nil, fmt.Errorf("%w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = mapFile(files, &total, file.Name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// tarMap reads the regular files of the src tar archive into memory.
+func tarMap(src string) (map[string][]byte, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	files := make(map[string][]byte)
+	total := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if total+hdr.Size > MaxMapSize {
+			return nil, fmt.Errorf("%w: files exceed %d bytes", ErrTooMany, MaxMapSize)
+		}
+		if err := mapFile(files, &total, hdr.Name, tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// dirMap extracts the source archive to a temporary directory and reads the files into memory.
+// The names of the files use forward slashes.
+func (x Extractor) dirMap() (map[string][]byte, error) {
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-map-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	x.Destination = tmp
+	if err := x.Extract(); err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	total := int64(0)
+	err = filepath.WalkDir(tmp, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return mapFile(files, &total, filepath.ToSlash(rel), f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
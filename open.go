@@ -0,0 +1,177 @@
+package archive
+
+// Package file archive/open.go contains the navigable archive handle.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Defacto2/helper"
+	"github.com/Defacto2/magicnumber"
+)
+
+// Archive is a handle to an opened file archive that caches the format and the listing,
+// so it can be queried repeatedly without rereading the archive.
+// The Close method must be called to remove any temporary files.
+//
+//	func Open() {
+//	    a, err := archive.Open("archive.zip")
+//	    if err != nil {
+//	        fmt.Fprintf(os.Stderr, "error: %v\n", err)
+//	        return
+//	    }
+//	    defer a.Close()
+//	    for _, name := range a.Names() {
+//	        fmt.Println(name)
+//	    }
+//	    b, err := a.ReadFile("FILE_ID.DIZ")
+//	}
+type Archive struct {
+	src     string                // src is the path to the archive file.
+	sign    magicnumber.Signature // sign is the file type signature of the archive.
+	content Content               // content is the cached listing of the archive.
+	tmp     string                // tmp is the temporary directory used by ReadFile.
+	nested  string                // nested is the temporary directory of an archive opened by OpenNested.
+}
+
+// Open reads the format and the listing of the src file archive and returns a handle to it.
+// The archive format is determined using the file type signature.
+func Open(src string) (*Archive, error) {
+	sign, err := signature(src)
+	if err != nil {
+		return nil, fmt.Errorf("archive open %w", err)
+	}
+	a := Archive{src: src, sign: sign}
+	if err := a.content.readSign(src, sign); err != nil {
+		return nil, fmt.Errorf("archive open %w", err)
+	}
+	if len(a.content.Entries) == 0 {
+		for _, name := range a.content.Files {
+			a.content.Entries = append(a.content.Entries, Entry{Name: name})
+		}
+	}
+	return &a, nil
+}
+
+// OpenNested extracts the single named archive from within the source archive to a temporary
+// directory and returns a handle to it, without extracting any of the other files.
+// The temporary directory is removed by the Close method of the returned handle.
+func (x Extractor) OpenNested(name string) (*Archive, error) {
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-nested-")
+	if err != nil {
+		return nil, fmt.Errorf("archive open nested %w", err)
+	}
+	x.Destination = tmp
+	path, err := x.extractNamed(name)
+	if err != nil {
+		defer os.RemoveAll(tmp)
+		return nil, fmt.Errorf("archive open nested %w", err)
+	}
+	a, err := Open(path)
+	if err != nil {
+		defer os.RemoveAll(tmp)
+		return nil, fmt.Errorf("archive open nested %w", err)
+	}
+	a.nested = tmp
+	return a, nil
+}
+
+// Close removes any temporary files created by the handle.
+func (a *Archive) Close() error {
+	for _, dir := range []*string{&a.tmp, &a.nested} {
+		if *dir == "" {
+			continue
+		}
+		if err := os.RemoveAll(*dir); err != nil {
+			return fmt.Errorf("archive close %w", err)
+		}
+		*dir = ""
+	}
+	return nil
+}
+
+// Ext returns the file extension of the archive format, for example ".zip".
+func (a *Archive) Ext() string {
+	return a.content.Ext
+}
+
+// Names returns the names of the files within the archive.
+func (a *Archive) Names() []string {
+	return slices.Clone(a.content.Files)
+}
+
+// Entry returns the metadata of the named file within the archive.
+// The name is matched case-insensitively when there is no exact match.
+// The boolean is false if the file is not found.
+func (a *Archive) Entry(name string) (Entry, bool) {
+	for _, e := range a.content.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	for _, e := range a.content.Entries {
+		if strings.EqualFold(e.Name, name) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// ExtractTo extracts the named files from the archive to the dst directory.
+// If no names are given then all files are extracted.
+func (a *Archive) ExtractTo(dst string, names ...string) error {
+	x := Extractor{Source: a.src, Destination: dst}
+	if err := x.Extract(names...); err != nil {
+		return fmt.Errorf("archive extract to %w", err)
+	}
+	return nil
+}
+
+// ReadFile extracts the named file from the archive and returns its content.
+// The file is extracted to a temporary directory that is removed by Close.
+// The cached listing is used to find the file, so the archive is not listed again.
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	e, found := a.Entry(name)
+	if !found {
+		return nil, fmt.Errorf("archive read file %w: %s", ErrMissing, name)
+	}
+	if a.tmp == "" {
+		tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-open-")
+		if err != nil {
+			return nil, fmt.Errorf("archive read file %w", err)
+		}
+		a.tmp = tmp
+	}
+	dst, err := os.MkdirTemp(a.tmp, "file-")
+	if err != nil {
+		return nil, fmt.Errorf("archive read file %w", err)
+	}
+	defer os.RemoveAll(dst)
+	// the listing was read by Open and the entry is known, so the extraction is not checked again
+	x := Extractor{Source: a.src, Destination: dst, checked: true}
+	if err := x.extract(a.sign, e.Name); err != nil {
+		return nil, fmt.Errorf("archive read file %w", err)
+	}
+	names := x.nameMap([]string{e.Name})
+	path, found := names[strings.ToLower(e.Name)]
+	if !found {
+		// some archiver programs do not keep the directory paths
+		path, found = names[strings.ToLower(filepath.Base(e.Name))]
+	}
+	if !found {
+		return nil, fmt.Errorf("archive read file %w: %s", ErrMissing, name)
+	}
+	path = filepath.Join(dst, path)
+	if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+		// a symbolic link is never followed
+		return nil, fmt.Errorf("archive read file %w: %s", ErrMissing, name)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("archive read file %w", err)
+	}
+	return b, nil
+}
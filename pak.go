@@ -0,0 +1,99 @@
+package archive
+
+// Package file archive/pak.go contains the PAK archive functions,
+// which use the native ARC header parsing and decompression functions of arc.go.
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	pakx       = ".pak" // PAK by NoGate Consulting
+	pakCrush   = 10     // method of a file using the PAK crushing
+	pakDistill = 11     // method of a file using the PAK distilling
+)
+
+// PAK returns true if the src file is a PAK archive by NoGate Consulting.
+// PAK is an extension of the ARC format that shares its file type signature,
+// so an archive is only identified as PAK when a file uses the crushed or distilled methods.
+// Other PAK archives are valid ARC archives.
+func PAK(src string) bool {
+	headers, err := arcEntries(src)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(headers, func(h arcHeader) bool {
+		return h.Method == pakCrush || h.Method == pakDistill
+	})
+}
+
+// Pak returns the content of the src PAK archive, credited to NoGate Consulting,
+// by reading the archive headers. No external program is required,
+// and the information items of the archive, such as comments, are skipped.
+func (c *Content) Pak(src string) error {
+	headers, err := arcEntries(src)
+	if err != nil {
+		return fmt.Errorf("archive pak reader %w", err)
+	}
+	files := []string{}
+	entries := []Entry{}
+	for _, h := range headers {
+		files = append(files, h.Name)
+		entries = append(entries, Entry{
+			Name:           h.Name,
+			Size:           h.Size,
+			CompressedSize: h.Packed,
+			Modified:       h.Modified,
+		})
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = pakx
+	c.Tool = "pak"
+	return nil
+}
+
+// Pak extracts the targets from the source PAK archive to the destination directory.
+// If the targets are empty then all files are extracted.
+//
+// The stored, packed and squeezed methods are decompressed natively, and the crunched and
+// squashed methods of ARC are delegated to the [arc program]. The crushed and distilled methods
+// that are unique to PAK are not supported, and ErrMethod is returned after all the other
+// files are extracted. As every archive identified by PAK uses one of these methods,
+// Extract returns ErrNotImplemented for them, and Pak is only used directly to salvage
+// the files of the other methods.
+//
+// [arc program]: https://linux.die.net/man/1/arc
+func (x Extractor) Pak(targets ...string) error {
+	if err := destDir(x.Destination); err != nil {
+		return err
+	}
+	headers, err := arcEntries(x.Source)
+	if err != nil {
+		return fmt.Errorf("archive pak extract %w", err)
+	}
+	var errs error
+	found := make(map[string]bool, len(targets))
+	for _, h := range headers {
+		if len(targets) > 0 && !slices.Contains(targets, h.Name) {
+			continue
+		}
+		found[h.Name] = true
+		_, err := x.arcNative(h)
+		if errors.Is(err, ErrMethod) && h.Method < pakCrush {
+			err = x.ARC(h.Name)
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("archive pak %s %w", h.Name, err))
+		}
+	}
+	for _, target := range targets {
+		if !found[target] {
+			errs = errors.Join(errs, fmt.Errorf("archive pak %w: %s", ErrMissing, target))
+		}
+	}
+	return errs
+}
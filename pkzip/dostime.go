@@ -0,0 +1,42 @@
+package pkzip
+
+import "time"
+
+// DosTime returns the MS-DOS date and time, as stored in the FAT file system and in
+// the headers of ZIP, ARJ and other DOS era archives, as a time in UTC.
+//
+// MS-DOS timestamps have no time zone, so the returned time holds the wall clock values
+// that were stored and should not be converted to local time. The seconds have a 2-second
+// resolution. A zero date, which is used by archivers for a missing timestamp, returns
+// the zero time.
+func DosTime(dosDate, dosTime uint16) time.Time {
+	if dosDate == 0 {
+		return time.Time{}
+	}
+	return time.Date(
+		int(dosDate>>9)+dosEpoch,
+		time.Month(dosDate>>5&0xf),
+		int(dosDate&0x1f),
+		int(dosTime>>11),
+		int(dosTime>>5&0x3f),
+		int(dosTime&0x1f)*2,
+		0, time.UTC)
+}
+
+// DosDateTime returns the MS-DOS date and time of the wall clock values of t, which is the inverse of DosTime.
+// The odd seconds are rounded down and times outside of the years 1980 to 2107 are clamped to that range.
+func DosDateTime(t time.Time) (uint16, uint16) {
+	const last = dosEpoch + 0x7f
+	switch {
+	case t.Year() < dosEpoch:
+		t = time.Date(dosEpoch, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case t.Year() > last:
+		t = time.Date(last, time.December, 31, 23, 59, 58, 0, time.UTC)
+	}
+	dosDate := uint16(t.Year()-dosEpoch)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	dosTime := uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return dosDate, dosTime
+}
+
+// dosEpoch is the first year of an MS-DOS date.
+const dosEpoch = 1980
@@ -0,0 +1,469 @@
+package pkzip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	ErrCentral = errors.New("zip central directory is not found")
+	ErrLocal   = errors.New("zip local file header is not found")
+)
+
+const (
+	localSig   = 0x04034b50 // localSig is the signature of a local file header.
+	centralSig = 0x02014b50 // centralSig is the signature of a central directory file header.
+	endSig     = 0x06054b50 // endSig is the signature of the end of central directory record.
+	end64Sig   = 0x06064b50 // end64Sig is the signature of the zip64 end of central directory record.
+	locSig     = 0x07064b50 // locSig is the signature of the zip64 end of central directory locator.
+	spanSig    = 0x30304b50 // spanSig is the signature of the "PK00" temporary spanning marker.
+
+	localLen   = 30 // localLen is the fixed length of a local file header.
+	centralLen = 46 // centralLen is the fixed length of a central directory file header.
+	endLen     = 22 // endLen is the fixed length of the end of central directory record.
+	locLen     = 20 // locLen is the fixed length of the zip64 end of central directory locator.
+	end64Len   = 56 // end64Len is the fixed length of the zip64 end of central directory record.
+	maxComment = 0xffff
+
+	dataDescriptor = 0x8   // dataDescriptor is the flag for sizes and CRC stored after the file data.
+	languageEFS    = 0x800 // languageEFS is the flag for a filename and comment encoded as UTF-8.
+	zip64Extra     = 0x1   // zip64Extra is the header ID of the zip64 extended information extra field.
+)
+
+// Entry is a file header read from a ZIP archive.
+type Entry struct {
+	Name           string      // Name of the file within the archive.
+	Version        uint16      // Version is the version needed to extract, for example 20 for PKZIP 2.0.
+	Flags          uint16      // Flags are the general purpose bit flags.
+	Method         Compression // Method is the compression method.
+	CRC32          uint32      // CRC32 is the checksum of the uncompressed file.
+	CompressedSize int64       // CompressedSize is the packed size of the file in bytes.
+	Size           int64       // Size is the uncompressed size of the file in bytes.
+	Offset         int64       // Offset is the position of the local file header in the archive.
+	Modified       time.Time   // Modified is the MS-DOS last modification time, see DosTime.
+}
+
+// UTF8 returns true if the language encoding flag, general purpose bit 11, is set,
+// which means the name is encoded as UTF-8 rather than the IBM PC codepage 437.
+func (e Entry) UTF8() bool {
+	return e.Flags&languageEFS != 0
+}
+
+// Streamed returns true if the data descriptor flag, general purpose bit 3, is set,
+// which means the checksum and sizes are stored after the file data rather than in the
+// local file header, as the archive was written to a stream that could not be rewound.
+func (e Entry) Streamed() bool {
+	return e.Flags&dataDescriptor != 0
+}
+
+// Streamed returns true if any file within the named ZIP archive uses a data descriptor,
+// which is read from the central directory. Some extractors that read the local file headers,
+// rather than the central directory, fail to extract the individual files of these archives.
+func Streamed(name string) (bool, error) {
+	entries, err := CentralDirectory(name)
+	if err != nil {
+		return false, fmt.Errorf("pkzip streamed: %w", err)
+	}
+	for _, e := range entries {
+		if e.Streamed() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CentralDirectory returns the file headers from the central directory of the named ZIP archive.
+// Only the end of central directory record and the central directory are read,
+// so the local file headers and the compressed data of the archive are ignored.
+// Zip64 archives are supported.
+func CentralDirectory(name string) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("pkzip central directory: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("pkzip central directory: %w", err)
+	}
+	count, offset, base, err := directoryEnd(f, st.Size())
+	if err != nil {
+		return nil, fmt.Errorf("pkzip central directory: %w", err)
+	}
+	// the offsets of self-extracting archives and archives with a spanning marker
+	// do not include the data that precedes the archive
+	offset += base
+	r := bufio.NewReader(io.NewSectionReader(f, offset, st.Size()-offset))
+	entries := make([]Entry, 0, min(count, maxComment))
+	for range count {
+		e, err := centralHeader(r)
+		if err != nil {
+			return entries, fmt.Errorf("pkzip central directory: %w", err)
+		}
+		e.Offset += base
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Spanned returns true if the named ZIP archive begins with the "PK00" temporary spanning marker,
+// which some versions of PKZIP write to archives that were intended to be split across multiple disks,
+// but fit on a single disk. The marker is followed by the first local file header, but the offsets
+// stored in the archive do not include the marker, so the zip readers must skip the first 4 bytes.
+func Spanned(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return spanned(f) > 0
+}
+
+// spanned returns the length of the "PK00" spanning marker at the start of the archive, or 0.
+func spanned(r io.ReaderAt) int64 {
+	const marker = 4
+	p := make([]byte, marker+4)
+	if _, err := r.ReadAt(p, 0); err != nil {
+		return 0
+	}
+	if binary.LittleEndian.Uint32(p) != spanSig || binary.LittleEndian.Uint32(p[marker:]) != localSig {
+		return 0
+	}
+	return marker
+}
+
+// Count returns the total number of entries in the named ZIP archive, which includes any directories.
+// Only the end of central directory record is read, so the file headers are not parsed.
+func Count(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, fmt.Errorf("pkzip count: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("pkzip count: %w", err)
+	}
+	count, _, _, err := directoryEnd(f, st.Size())
+	if err != nil {
+		return 0, fmt.Errorf("pkzip count: %w", err)
+	}
+	return count, nil
+}
+
+// directoryEnd returns the number of entries and the offset of the central directory,
+// read from the end of central directory record found at the end of the file.
+// The base is the length of any data that precedes the archive, such as the program
+// of a self-extracting archive or the "PK00" spanning marker, which is not included
+// in the stored offsets and is found by subtracting the size and the offset of
+// the central directory from the position of the end record.
+func directoryEnd(r io.ReaderAt, size int64) (count, offset, base int64, err error) {
+	start := max(0, size-(endLen+maxComment))
+	p := make([]byte, size-start)
+	if _, err := r.ReadAt(p, start); err != nil && !errors.Is(err, io.EOF) {
+		return 0, 0, 0, err
+	}
+	i := bytes.LastIndex(p, le32(endSig))
+	if i < 0 || len(p)-i < endLen {
+		return 0, 0, 0, ErrCentral
+	}
+	end := p[i:]
+	pos := start + int64(i)
+	count = int64(binary.LittleEndian.Uint16(end[10:12]))
+	length := int64(binary.LittleEndian.Uint32(end[12:16]))
+	offset = int64(binary.LittleEndian.Uint32(end[16:20]))
+	const max16, max32 = 0xffff, 0xffffffff
+	if count == max16 || length == max32 || offset == max32 {
+		// zip64 archives store the values in the zip64 end of central directory record,
+		// but an archive with exactly 65535 entries uses the maximum value without the locator
+		if n, size, off, at, ok := directoryEnd64(r, pos); ok {
+			count, length, offset, pos = n, size, off, at
+		}
+	}
+	base = max(0, pos-length-offset)
+	return count, offset, base, nil
+}
+
+// directoryEnd64 returns the number of entries, the size and the offset of the central directory
+// and the position of the zip64 end of central directory record, which is found using the locator
+// that precedes the end of central directory record at pos.
+// False is returned when the locator or the record is missing.
+func directoryEnd64(r io.ReaderAt, pos int64) (count, length, offset, at int64, ok bool) {
+	if pos < locLen {
+		return 0, 0, 0, 0, false
+	}
+	loc := make([]byte, locLen)
+	if _, err := r.ReadAt(loc, pos-locLen); err != nil {
+		return 0, 0, 0, 0, false
+	}
+	if binary.LittleEndian.Uint32(loc) != locSig {
+		return 0, 0, 0, 0, false
+	}
+	// the stored position of the record does not include any data that precedes the archive,
+	// while the record is always written immediately before the locator
+	at = pos - locLen - end64Len
+	end64 := make([]byte, end64Len)
+	if _, err := r.ReadAt(end64, at); err != nil || binary.LittleEndian.Uint32(end64) != end64Sig {
+		at = int64(binary.LittleEndian.Uint64(loc[8:16]))
+		if _, err := r.ReadAt(end64, at); err != nil || binary.LittleEndian.Uint32(end64) != end64Sig {
+			return 0, 0, 0, 0, false
+		}
+	}
+	count = int64(binary.LittleEndian.Uint64(end64[32:40]))
+	length = int64(binary.LittleEndian.Uint64(end64[40:48]))
+	offset = int64(binary.LittleEndian.Uint64(end64[48:56]))
+	return count, length, offset, at, true
+}
+
+// archiveStart returns the offset of the first local file header of the archive,
+// which follows any data that precedes the archive, such as the program of a self-extracting archive.
+func archiveStart(r io.ReaderAt, size int64) int64 {
+	_, _, base, err := directoryEnd(r, size)
+	if err != nil || base == 0 {
+		return spanned(r)
+	}
+	p := make([]byte, 4)
+	if _, err := r.ReadAt(p, base); err != nil || binary.LittleEndian.Uint32(p) != localSig {
+		return spanned(r)
+	}
+	return base
+}
+
+// centralHeader reads and returns the next central directory file header.
+func centralHeader(r io.Reader) (Entry, error) {
+	p := make([]byte, centralLen)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return Entry{}, err
+	}
+	if binary.LittleEndian.Uint32(p) != centralSig {
+		return Entry{}, ErrCentral
+	}
+	e := Entry{
+		Version:        binary.LittleEndian.Uint16(p[6:8]),
+		Flags:          binary.LittleEndian.Uint16(p[8:10]),
+		Method:         Compression(binary.LittleEndian.Uint16(p[10:12])),
+		CRC32:          binary.LittleEndian.Uint32(p[16:20]),
+		CompressedSize: int64(binary.LittleEndian.Uint32(p[20:24])),
+		Size:           int64(binary.LittleEndian.Uint32(p[24:28])),
+		Offset:         int64(binary.LittleEndian.Uint32(p[42:46])),
+		Modified:       DosTime(binary.LittleEndian.Uint16(p[14:16]), binary.LittleEndian.Uint16(p[12:14])),
+	}
+	nameLen := int(binary.LittleEndian.Uint16(p[28:30]))
+	extraLen := int(binary.LittleEndian.Uint16(p[30:32]))
+	commentLen := int(binary.LittleEndian.Uint16(p[32:34]))
+	v := make([]byte, nameLen+extraLen+commentLen)
+	if _, err := io.ReadFull(r, v); err != nil {
+		return Entry{}, err
+	}
+	e.Name = string(v[:nameLen])
+	e.zip64(v[nameLen : nameLen+extraLen])
+	return e, nil
+}
+
+// zip64 replaces the sizes and offset of the entry that overflow 32-bits with
+// the values stored in the zip64 extended information extra field.
+func (e *Entry) zip64(extra []byte) {
+	const header, max32 = 4, 0xffffffff
+	for len(extra) >= header {
+		tag := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < header+size {
+			return
+		}
+		field := extra[header : header+size]
+		extra = extra[header+size:]
+		if tag != zip64Extra {
+			continue
+		}
+		for _, v := range []*int64{&e.Size, &e.CompressedSize, &e.Offset} {
+			const size64 = 8
+			if *v != max32 || len(field) < size64 {
+				continue
+			}
+			*v = int64(binary.LittleEndian.Uint64(field))
+			field = field[size64:]
+		}
+		return
+	}
+}
+
+// LocalHeaders returns the file headers read from the local file headers of the named ZIP archive,
+// starting from the beginning of the archive and ignoring the central directory.
+// Files using a data descriptor do not store their sizes in the local file header,
+// so the file data is scanned to find the next header.
+//
+// The headers found before any damaged data are returned together with the error.
+func LocalHeaders(name string) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("pkzip local headers: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("pkzip local headers: %w", err)
+	}
+	entries := []Entry{}
+	offset := archiveStart(f, st.Size())
+	for offset+localLen <= st.Size() {
+		e, next, err := localHeader(f, offset, st.Size())
+		if errors.Is(err, ErrLocal) {
+			break
+		}
+		if err != nil {
+			return entries, fmt.Errorf("pkzip local headers: %w", err)
+		}
+		entries = append(entries, e)
+		offset = next
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("pkzip local headers: %w", ErrLocal)
+	}
+	return entries, nil
+}
+
+// localHeader reads the local file header at the offset and returns the entry
+// and the offset of the data that follows the file.
+func localHeader(r io.ReaderAt, offset, size int64) (Entry, int64, error) {
+	p := make([]byte, localLen)
+	if _, err := r.ReadAt(p, offset); err != nil {
+		return Entry{}, 0, err
+	}
+	if binary.LittleEndian.Uint32(p) != localSig {
+		return Entry{}, 0, ErrLocal
+	}
+	e := Entry{
+		Version:        binary.LittleEndian.Uint16(p[4:6]),
+		Flags:          binary.LittleEndian.Uint16(p[6:8]),
+		Method:         Compression(binary.LittleEndian.Uint16(p[8:10])),
+		CRC32:          binary.LittleEndian.Uint32(p[14:18]),
+		CompressedSize: int64(binary.LittleEndian.Uint32(p[18:22])),
+		Size:           int64(binary.LittleEndian.Uint32(p[22:26])),
+		Offset:         offset,
+		Modified:       DosTime(binary.LittleEndian.Uint16(p[12:14]), binary.LittleEndian.Uint16(p[10:12])),
+	}
+	nameLen := int64(binary.LittleEndian.Uint16(p[26:28]))
+	extraLen := int64(binary.LittleEndian.Uint16(p[28:30]))
+	v := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(v, offset+localLen); err != nil {
+		return Entry{}, 0, err
+	}
+	e.Name = string(v[:nameLen])
+	e.zip64(v[nameLen:])
+	data := offset + localLen + nameLen + extraLen
+	if e.Flags&dataDescriptor == 0 || e.CompressedSize > 0 {
+		next := data + e.CompressedSize
+		if next > size {
+			return Entry{}, 0, io.ErrUnexpectedEOF
+		}
+		return e, next, nil
+	}
+	next, err := scanHeader(r, data, size)
+	if err != nil {
+		return Entry{}, 0, err
+	}
+	return e, next, nil
+}
+
+// scanHeader returns the offset of the next local or central directory file header
+// that is found after the offset.
+func scanHeader(r io.ReaderAt, offset, size int64) (int64, error) {
+	const chunk = 32 * 1024
+	local, central := le32(localSig), le32(centralSig)
+	p := make([]byte, chunk+len(local))
+	for pos := offset; pos < size; pos += chunk {
+		n, err := r.ReadAt(p, pos)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		b := p[:n]
+		i, j := bytes.Index(b, local), bytes.Index(b, central)
+		switch {
+		case i >= 0 && (j < 0 || i < j):
+			return pos + int64(i), nil
+		case j >= 0:
+			return pos + int64(j), nil
+		}
+	}
+	return size, nil
+}
+
+// VersionNeeded returns the highest "version needed to extract" of the files in the named ZIP archive,
+// which is the minimum PKZIP version required to extract the whole archive.
+// The version is encoded as the major and minor numbers, for example 20 for PKZIP 2.0
+// or 45 for the zip64 extensions of PKZIP 4.5.
+//
+// The central directory is read, but the local file headers are used instead when it is damaged.
+func VersionNeeded(name string) (int, error) {
+	entries, err := CentralDirectory(name)
+	if err != nil {
+		entries, err = LocalHeaders(name)
+	}
+	if err != nil && len(entries) == 0 {
+		return 0, fmt.Errorf("pkzip version needed: %w", err)
+	}
+	version := 0
+	for _, e := range entries {
+		// the upper byte is the host system of the creator and is ignored
+		version = max(version, int(e.Version&0xff))
+	}
+	return version, nil
+}
+
+// HasLegacyCompression returns true if any file in the named ZIP archive uses an obsolete
+// compression method, such as Shrunk, Reduced or Imploded.
+// It is a cheaper alternative to Methods for the bulk triage of archives,
+// as the local file headers are read in order and the first legacy method found is returned
+// without parsing the rest of the archive.
+//
+// The central directory is used instead when the archive does not begin with a local file header,
+// such as a self-extracting program.
+func HasLegacyCompression(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, fmt.Errorf("pkzip legacy compression: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("pkzip legacy compression: %w", err)
+	}
+	offset := int64(0)
+	for offset+localLen <= st.Size() {
+		e, next, err := localHeader(f, offset, st.Size())
+		if errors.Is(err, ErrLocal) {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("pkzip legacy compression: %w", err)
+		}
+		if e.Method.Legacy() {
+			return true, nil
+		}
+		offset = next
+	}
+	if offset > 0 {
+		return false, nil
+	}
+	entries, err := CentralDirectory(name)
+	if err != nil {
+		return false, fmt.Errorf("pkzip legacy compression: %w", err)
+	}
+	for _, e := range entries {
+		if e.Method.Legacy() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// le32 returns the little-endian bytes of the signature.
+func le32(sig uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, sig)
+}
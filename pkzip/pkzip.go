@@ -13,6 +13,7 @@ package pkzip
 
 import (
 	"archive/zip"
+	"encoding/binary"
 	"fmt"
 	"slices"
 	"strconv"
@@ -88,6 +89,16 @@ func (c Compression) Zip() bool {
 	return false
 }
 
+// Legacy returns true if the compression method is an obsolete method from the
+// early PKZip releases, which are Shrunk, Reduced and Imploded.
+func (c Compression) Legacy() bool {
+	switch c {
+	case Shrunk, ReducedFactor1, ReducedFactor2, ReducedFactor3, ReducedFactor4, Imploded:
+		return true
+	}
+	return false
+}
+
 // Diagnostic is a diagnostic code returned by the PKZip command-line utilities.
 type Diagnostic uint16
 
@@ -188,6 +199,72 @@ func Methods(name string) ([]Compression, error) {
 	return slices.Compact(methods), nil
 }
 
+// Encryption is the type of encryption used by the files in a ZIP archive.
+type Encryption uint8
+
+const (
+	None        Encryption = iota // None is an unencrypted archive.
+	Traditional                   // Traditional is the weak PKWARE encryption, also known as ZipCrypto.
+	AES                           // AES is the WinZip AES encryption.
+)
+
+func (e Encryption) String() string {
+	switch e {
+	case None:
+		return "None"
+	case Traditional:
+		return "Traditional PKWARE"
+	case AES:
+		return "WinZip AES"
+	}
+	return "Unknown"
+}
+
+const (
+	aesMethod = 99     // aesMethod is the compression method used by WinZip AES encrypted files.
+	aesExtra  = 0x9901 // aesExtra is the header ID of the WinZip AES extra field.
+)
+
+// EncryptionType returns the strongest type of encryption used by the files in the named ZIP archive.
+// WinZip AES encrypted files are identified by the AES extra field or compression method 99,
+// which are not supported by the unzip program.
+func EncryptionType(name string) (Encryption, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return None, fmt.Errorf("pkzip encryption type: %w", err)
+	}
+	defer r.Close()
+	enc := None
+	for _, file := range r.File {
+		fh := file.FileHeader
+		if encrypted := fh.Flags&0x1 != 0; !encrypted {
+			continue
+		}
+		if fh.Method == aesMethod || extraField(fh.Extra, aesExtra) {
+			return AES, nil
+		}
+		enc = Traditional
+	}
+	return enc, nil
+}
+
+// extraField returns true if the extra field data of a file header contains the header id.
+func extraField(extra []byte, id uint16) bool {
+	const header = 4
+	for len(extra) >= header {
+		tag := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if tag == id {
+			return true
+		}
+		if len(extra) < header+size {
+			return false
+		}
+		extra = extra[header+size:]
+	}
+	return false
+}
+
 // Zip returns true if the named file is a PKZip file that exclusively
 // uses the Deflated or Stored compression methods. These are the methods
 // supported by the Go standard library's archive/zip package.
@@ -1,11 +1,18 @@
 package pkzip_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/Defacto2/archive/command"
 	"github.com/Defacto2/archive/pkzip"
@@ -77,3 +84,327 @@ func TestExitStatus(t *testing.T) {
 	assert.Equal(t, pkzip.ZipNotFound, diag)
 	assert.Equal(t, "Zip file not found", diag.String())
 }
+
+func TestEncryptionType(t *testing.T) {
+	t.Parallel()
+
+	enc, err := pkzip.EncryptionType(td("PKZ204EX.TXT"))
+	require.Error(t, err)
+	assert.Equal(t, pkzip.None, enc)
+
+	enc, err = pkzip.EncryptionType(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	assert.Equal(t, pkzip.None, enc)
+
+	enc, err = pkzip.EncryptionType(td("AES.ZIP"))
+	require.NoError(t, err)
+	assert.Equal(t, pkzip.AES, enc)
+	assert.Equal(t, "WinZip AES", enc.String())
+}
+
+func TestHeaders(t *testing.T) {
+	t.Parallel()
+
+	central, err := pkzip.CentralDirectory(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	require.Len(t, central, 15)
+	assert.Equal(t, "TEST.ANS", central[0].Name)
+	assert.Equal(t, pkzip.Deflated, central[0].Method)
+	assert.Equal(t, uint32(0x5ce2f707), central[0].CRC32)
+	assert.Equal(t, int64(62), central[0].CompressedSize)
+	assert.Equal(t, int64(68), central[0].Size)
+
+	local, err := pkzip.LocalHeaders(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	require.Len(t, local, 15)
+	for i := range local {
+		assert.Equal(t, central[i].Name, local[i].Name)
+		assert.Equal(t, central[i].Offset, local[i].Offset)
+	}
+
+	_, err = pkzip.CentralDirectory(td("TEST.EXE"))
+	require.ErrorIs(t, err, pkzip.ErrCentral)
+	_, err = pkzip.LocalHeaders(td("TEST.EXE"))
+	require.ErrorIs(t, err, pkzip.ErrLocal)
+}
+
+func TestHasLegacyCompression(t *testing.T) {
+	t.Parallel()
+
+	legacy, err := pkzip.HasLegacyCompression(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	assert.False(t, legacy)
+
+	legacy, err = pkzip.HasLegacyCompression(td("PKZ80A1.ZIP"))
+	require.NoError(t, err)
+	assert.True(t, legacy)
+
+	legacy, err = pkzip.HasLegacyCompression(td("PKZ110EI.ZIP"))
+	require.NoError(t, err)
+	assert.True(t, legacy)
+
+	legacy, err = pkzip.HasLegacyCompression(td("TEST.EXE"))
+	require.Error(t, err)
+	assert.False(t, legacy)
+
+	assert.True(t, pkzip.Imploded.Legacy())
+	assert.False(t, pkzip.Deflated.Legacy())
+	assert.False(t, pkzip.BZIP2.Legacy())
+}
+
+func TestVersionNeeded(t *testing.T) {
+	t.Parallel()
+
+	v, err := pkzip.VersionNeeded(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	assert.Equal(t, 20, v)
+
+	v, err = pkzip.VersionNeeded(td("PKZ80A1.ZIP"))
+	require.NoError(t, err)
+	assert.Equal(t, 10, v)
+
+	v, err = pkzip.VersionNeeded(td("TEST.EXE"))
+	require.Error(t, err)
+	assert.Zero(t, v)
+}
+
+func TestDosTime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		dosDate, dosTime uint16
+		want             time.Time
+	}{
+		{0x0021, 0x0000, time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{0x2821, 0x0000, time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{0x1cef, 0x6daf, time.Date(1994, time.July, 15, 13, 45, 30, 0, time.UTC)},
+		{0xff9f, 0xbf7d, time.Date(2107, time.December, 31, 23, 59, 58, 0, time.UTC)},
+		{0x0000, 0x6daf, time.Time{}},
+	}
+	for _, tt := range tests {
+		got := pkzip.DosTime(tt.dosDate, tt.dosTime)
+		assert.Equal(t, tt.want, got, "%04x %04x", tt.dosDate, tt.dosTime)
+		if got.IsZero() {
+			continue
+		}
+		d, tm := pkzip.DosDateTime(got)
+		assert.Equal(t, tt.dosDate, d)
+		assert.Equal(t, tt.dosTime, tm)
+	}
+
+	d, tm := pkzip.DosDateTime(time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, uint16(0x0021), d)
+	assert.Equal(t, uint16(0), tm)
+	d, tm = pkzip.DosDateTime(time.Date(1994, time.July, 15, 13, 45, 31, 0, time.UTC))
+	assert.Equal(t, uint16(0x1cef), d)
+	assert.Equal(t, uint16(0x6daf), tm)
+
+	entries, err := pkzip.CentralDirectory(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	for _, e := range entries {
+		assert.False(t, e.Modified.IsZero(), e.Name)
+	}
+}
+
+func TestSpanned(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, pkzip.Spanned(td("PK00.ZIP")))
+	assert.False(t, pkzip.Spanned(td("PKZ204EX.ZIP")))
+	assert.False(t, pkzip.Spanned(td("missing.zip")))
+
+	central, err := pkzip.CentralDirectory(td("PK00.ZIP"))
+	require.NoError(t, err)
+	require.Len(t, central, 2)
+	assert.Equal(t, "FILE_ID.DIZ", central[0].Name)
+	assert.Equal(t, int64(4), central[0].Offset)
+
+	local, err := pkzip.LocalHeaders(td("PK00.ZIP"))
+	require.NoError(t, err)
+	require.Len(t, local, 2)
+	assert.Equal(t, central[1].Name, local[1].Name)
+	assert.Equal(t, central[1].Offset, local[1].Offset)
+}
+
+func TestSelfExtracting(t *testing.T) {
+	t.Parallel()
+
+	// the offsets of a zip archive appended to a program are not adjusted for the program
+	var buf bytes.Buffer
+	buf.WriteString("MZ self-extracting program stub")
+	stub := int64(buf.Len())
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"FILE_ID.DIZ", "README.TXT"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	name := filepath.Join(t.TempDir(), "sfx.exe")
+	require.NoError(t, os.WriteFile(name, buf.Bytes(), 0o644))
+
+	central, err := pkzip.CentralDirectory(name)
+	require.NoError(t, err)
+	require.Len(t, central, 2)
+	assert.Equal(t, "FILE_ID.DIZ", central[0].Name)
+	assert.Equal(t, stub, central[0].Offset)
+
+	local, err := pkzip.LocalHeaders(name)
+	require.NoError(t, err)
+	require.Len(t, local, 2)
+	for i := range local {
+		assert.Equal(t, central[i].Name, local[i].Name)
+		assert.Equal(t, central[i].Offset, local[i].Offset)
+	}
+	assert.False(t, pkzip.Spanned(name))
+}
+
+func TestCountMaximum(t *testing.T) {
+	t.Parallel()
+
+	// an archive of exactly 65535 entries stores the maximum 16-bit count without any zip64 records
+	const entries = 0xffff
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := range entries {
+		_, err := w.CreateRaw(&zip.FileHeader{Name: fmt.Sprintf("%05d", i), Method: zip.Store})
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	const end64Len, locLen, endLen = 56, 20, 22
+	p := buf.Bytes()
+	end64 := p[len(p)-endLen-locLen-end64Len:]
+	end := slices.Clone(p[len(p)-endLen:])
+	binary.LittleEndian.PutUint32(end[12:16], uint32(binary.LittleEndian.Uint64(end64[40:48])))
+	binary.LittleEndian.PutUint32(end[16:20], uint32(binary.LittleEndian.Uint64(end64[48:56])))
+	p = append(p[:len(p)-endLen-locLen-end64Len], end...)
+	name := filepath.Join(t.TempDir(), "max.zip")
+	require.NoError(t, os.WriteFile(name, p, 0o644))
+
+	n, err := pkzip.Count(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(entries), n)
+	central, err := pkzip.CentralDirectory(name)
+	require.NoError(t, err)
+	require.Len(t, central, entries)
+	assert.Equal(t, "65534", central[entries-1].Name)
+}
+
+func TestEntryUTF8(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "utf8.zip")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, fh := range []*zip.FileHeader{
+		{Name: "CAFÉ.TXT"},
+		{Name: "M\x81LLER.TXT", NonUTF8: true},
+	} {
+		_, err := w.CreateHeader(fh)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	central, err := pkzip.CentralDirectory(name)
+	require.NoError(t, err)
+	require.Len(t, central, 2)
+	assert.True(t, central[0].UTF8())
+	assert.False(t, central[1].UTF8())
+}
+
+func TestStreamed(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "streamed.zip")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	// the raw header is written with its sizes, while the other header uses a data descriptor
+	_, err = w.CreateRaw(&zip.FileHeader{Name: "RAW.TXT", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = w.Create("STREAM.TXT")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	central, err := pkzip.CentralDirectory(name)
+	require.NoError(t, err)
+	require.Len(t, central, 2)
+	assert.False(t, central[0].Streamed())
+	assert.True(t, central[1].Streamed())
+	streamed, err := pkzip.Streamed(name)
+	require.NoError(t, err)
+	assert.True(t, streamed)
+	streamed, err = pkzip.Streamed("../testdata/PKZ204EX.ZIP")
+	require.NoError(t, err)
+	assert.False(t, streamed)
+}
+
+func TestRebuildCentralDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	central, err := pkzip.CentralDirectory(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+	require.Len(t, central, 15)
+	b, err := os.ReadFile(td("PKZ204EX.ZIP"))
+	require.NoError(t, err)
+
+	// truncate the archive within the data of the last file
+	src := filepath.Join(dir, "TRUNCATED.ZIP")
+	require.NoError(t, os.WriteFile(src, b[:central[14].Offset+40], 0o600))
+	dest := filepath.Join(dir, "REBUILT.ZIP")
+	require.NoError(t, pkzip.RebuildCentralDirectory(src, dest))
+	require.Error(t, pkzip.RebuildCentralDirectory(src, dest))
+
+	r, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Len(t, r.File, 14)
+	for i, file := range r.File {
+		assert.Equal(t, central[i].Name, file.Name)
+		assert.Equal(t, central[i].CRC32, file.CRC32)
+		rc, err := file.Open()
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err, file.Name)
+		require.NoError(t, rc.Close())
+	}
+
+	// files written with data descriptors and without a central directory
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"FILE_ID.DIZ", "DOCS/", "DOCS/README.TXT"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		if name != "DOCS/" {
+			_, err = fw.Write(bytes.Repeat([]byte(name), 100))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+	cut := bytes.Index(buf.Bytes(), []byte("PK\x01\x02"))
+	require.Positive(t, cut)
+	src = filepath.Join(dir, "NOCENTRAL.ZIP")
+	require.NoError(t, os.WriteFile(src, buf.Bytes()[:cut], 0o600))
+	dest = filepath.Join(dir, "REBUILT2.ZIP")
+	require.NoError(t, pkzip.RebuildCentralDirectory(src, dest))
+	r2, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer r2.Close()
+	require.Len(t, r2.File, 3)
+	assert.True(t, r2.File[1].FileInfo().IsDir())
+	rc, err := r2.File[2].Open()
+	require.NoError(t, err)
+	p, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, bytes.Repeat([]byte("DOCS/README.TXT"), 100), p)
+
+	err = pkzip.RebuildCentralDirectory(td("TEST.EXE"), filepath.Join(dir, "EXE.ZIP"))
+	require.ErrorIs(t, err, pkzip.ErrLocal)
+}
@@ -0,0 +1,199 @@
+package pkzip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// descSig is the optional signature of the data descriptor that follows the file data.
+const descSig = 0x08074b50
+
+// ErrZip64 is returned when an archive needs the zip64 extensions that are not supported.
+var ErrZip64 = errors.New("zip64 archive is not supported")
+
+// RebuildCentralDirectory writes a new ZIP archive to dest using the local file headers
+// and the file data of the src ZIP archive, with a central directory that is reconstructed
+// from the local file headers. It salvages archives with a damaged or missing central directory,
+// such as those from a truncated upload, which the zipinfo and unzip programs refuse.
+//
+// The local file headers and the compressed data are copied unchanged, but a truncated file
+// at the end of the archive is dropped. The file modes and comments stored in the original central directory
+// are lost. If no local file headers are found then ErrLocal is returned,
+// and if the dest file already exists then an error is returned.
+func RebuildCentralDirectory(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	records, err := salvage(f, st.Size())
+	if err != nil {
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	if err := rebuild(out, f, records); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("pkzip rebuild: %w", err)
+	}
+	return nil
+}
+
+// record is a file salvaged from the local file headers of an archive.
+type record struct {
+	header []byte // header is the local file header including the name, but excluding the extra field.
+	offset int64  // offset is the position of the local file header in the source archive.
+	length int64  // length is the size of the header, the extra field, the file data and any data descriptor.
+	crc    uint32 // crc is the checksum of the uncompressed file.
+	packed uint32 // packed is the compressed size of the file.
+	size   uint32 // size is the uncompressed size of the file.
+}
+
+// salvage returns the records of the complete files found using the local file headers of the archive.
+func salvage(r io.ReaderAt, size int64) ([]record, error) {
+	records := []record{}
+	offset := archiveStart(r, size)
+	for offset+localLen <= size {
+		e, next, err := localHeader(r, offset, size)
+		if err != nil {
+			// a missing header is the end of the files, while a read error is a truncated file
+			break
+		}
+		if e.CompressedSize > math.MaxUint32 || e.Size > math.MaxUint32 {
+			return nil, ErrZip64
+		}
+		p := make([]byte, localLen+len(e.Name))
+		if _, err := r.ReadAt(p, offset); err != nil {
+			return nil, err
+		}
+		rec := record{
+			header: p,
+			offset: offset,
+			length: next - offset,
+			crc:    e.CRC32,
+			packed: uint32(e.CompressedSize),
+			size:   uint32(e.Size),
+		}
+		if e.Flags&dataDescriptor != 0 && e.CompressedSize == 0 {
+			if !rec.descriptor(r, next) {
+				break
+			}
+		}
+		records = append(records, rec)
+		offset = next
+	}
+	if len(records) == 0 {
+		return nil, ErrLocal
+	}
+	return records, nil
+}
+
+// descriptor sets the checksum and sizes of the record using the data descriptor that ends at the next offset,
+// which is used when the values are not stored in the local file header.
+// It returns false if the data descriptor does not match the size of the file data.
+func (rec *record) descriptor(r io.ReaderAt, next int64) bool {
+	const withSig, withoutSig = 16, 12
+	p := make([]byte, withSig)
+	if next-rec.offset < int64(len(rec.header))+withSig {
+		return false
+	}
+	if _, err := r.ReadAt(p, next-withSig); err != nil {
+		return false
+	}
+	extraLen := int64(binary.LittleEndian.Uint16(rec.header[28:30]))
+	data := int64(len(rec.header)) + extraLen
+	for _, n := range []int{withSig, withoutSig} {
+		d := p[withSig-n:]
+		if n == withSig && binary.LittleEndian.Uint32(d) != descSig {
+			continue
+		}
+		d = d[n-withoutSig:]
+		packed := binary.LittleEndian.Uint32(d[4:8])
+		if int64(packed) != rec.length-data-int64(n) {
+			continue
+		}
+		rec.crc = binary.LittleEndian.Uint32(d[0:4])
+		rec.packed = packed
+		rec.size = binary.LittleEndian.Uint32(d[8:12])
+		return true
+	}
+	return false
+}
+
+// rebuild writes the records copied from the src archive to w,
+// followed by the reconstructed central directory and the end of central directory record.
+func rebuild(w io.Writer, src io.ReaderAt, records []record) error {
+	if len(records) > math.MaxUint16 {
+		return ErrZip64
+	}
+	bw := bufio.NewWriter(w)
+	pos := int64(0)
+	offsets := make([]int64, len(records))
+	for i, rec := range records {
+		offsets[i] = pos
+		n, err := io.Copy(bw, io.NewSectionReader(src, rec.offset, rec.length))
+		if err != nil {
+			return err
+		}
+		pos += n
+	}
+	if pos > math.MaxUint32 {
+		return ErrZip64
+	}
+	start := pos
+	for i, rec := range records {
+		const dir = 0x10 // MS-DOS directory attribute
+		name := rec.header[localLen:]
+		attrs := uint32(0)
+		if len(name) > 0 && name[len(name)-1] == '/' {
+			attrs = dir
+		}
+		h := make([]byte, 0, centralLen+len(name))
+		h = binary.LittleEndian.AppendUint32(h, centralSig)
+		h = append(h, rec.header[4:6]...)  // version made by is the version needed to extract
+		h = append(h, rec.header[4:14]...) // version, flags, method, time and date
+		h = binary.LittleEndian.AppendUint32(h, rec.crc)
+		h = binary.LittleEndian.AppendUint32(h, rec.packed)
+		h = binary.LittleEndian.AppendUint32(h, rec.size)
+		h = binary.LittleEndian.AppendUint16(h, uint16(len(name)))
+		h = append(h, 0, 0, 0, 0, 0, 0, 0, 0) // extra field and comment lengths, disk number and internal attributes
+		h = binary.LittleEndian.AppendUint32(h, attrs)
+		h = binary.LittleEndian.AppendUint32(h, uint32(offsets[i]))
+		h = append(h, name...)
+		if _, err := bw.Write(h); err != nil {
+			return err
+		}
+		pos += int64(len(h))
+	}
+	if pos > math.MaxUint32 {
+		return ErrZip64
+	}
+	end := make([]byte, 0, endLen)
+	end = binary.LittleEndian.AppendUint32(end, endSig)
+	end = append(end, 0, 0, 0, 0) // disk numbers
+	end = binary.LittleEndian.AppendUint16(end, uint16(len(records)))
+	end = binary.LittleEndian.AppendUint16(end, uint16(len(records)))
+	end = binary.LittleEndian.AppendUint32(end, uint32(pos-start))
+	end = binary.LittleEndian.AppendUint32(end, uint32(start))
+	end = append(end, 0, 0) // comment length
+	if _, err := bw.Write(end); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
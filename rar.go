@@ -0,0 +1,148 @@
+package archive
+
+// Package file archive/rar.go contains the RAR archive version functions.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Defacto2/archive/command"
+)
+
+// ErrRarV5 is returned when a RAR v5 archive is read with an unrar program that predates v5 support.
+var ErrRarV5 = errors.New("rar v5 archive requires unrar v5 or newer")
+
+var (
+	rar4Sign = []byte("Rar!\x1a\x07\x00")     // RAR 1.5 to 4.x archive signature
+	rar5Sign = []byte("Rar!\x1a\x07\x01\x00") // RAR 5.0 and newer archive signature
+)
+
+// RarVersion returns the RAR archive format version of the src file using the signature bytes,
+// which is either 4 for archives created by RAR 1.5 to 4.x, or 5 for RAR 5.0 and newer archives.
+func RarVersion(src string) (int, error) {
+	p, err := HeaderBytes(src, len(rar5Sign))
+	if err != nil {
+		return 0, fmt.Errorf("rar version %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(p, rar5Sign):
+		return 5, nil
+	case bytes.HasPrefix(p, rar4Sign):
+		return 4, nil
+	}
+	return 0, fmt.Errorf("rar version %w: %s", ErrNotArchive, src)
+}
+
+// unrarVersion matches the major version in the banner of the unrar program,
+// for example "UNRAR 6.24 freeware".
+var unrarVersion = regexp.MustCompile(`(?i)unrar\s+(\d+)\.\d+`)
+
+// rarSupport returns ErrRarV5 if the src archive is RAR v5 and the unrar prog is older than v5.
+// Any failure to determine the versions is ignored, so the unrar program reports the problem.
+// The unrar program is stopped when the parent context is canceled.
+func rarSupport(parent context.Context, prog, src string) error {
+	if v, err := RarVersion(src); err != nil || v < 5 {
+		return nil
+	}
+	ctx, cancel := withTimeout(parent, TimeoutLookup)
+	defer cancel()
+	// unrar without any arguments prints the banner and usage
+	out, _ := exec.CommandContext(ctx, prog).Output()
+	m := unrarVersion.FindSubmatch(out)
+	if m == nil {
+		return nil
+	}
+	if major, err := strconv.Atoi(string(m[1])); err == nil && major < 5 {
+		return fmt.Errorf("%w: %s %s", ErrRarV5, prog, bytes.TrimSpace(m[0]))
+	}
+	return nil
+}
+
+// rarTechnical returns the entries of the src RAR archive using the technical list command
+// of the [unrar program], which reports the sizes and checksums that the brief list command omits.
+// The directories and any duplicate names are included.
+//
+// [unrar program]: https://www.rarlab.com/rar_add.htm
+func rarTechnical(parent context.Context, src string) ([]Entry, error) {
+	prog, err := exec.LookPath(command.Unrar)
+	if err != nil {
+		return nil, fmt.Errorf("archive unrar technical %w", err)
+	}
+	if err := rarSupport(parent, prog, src); err != nil {
+		return nil, fmt.Errorf("archive unrar technical %w", err)
+	}
+	const (
+		listTechnical = "lt"
+		noComments    = "-c-"
+	)
+	var b bytes.Buffer
+	ctx, cancel := withTimeout(parent, TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, listTechnical, noComments, src)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		if b.String() != "" {
+			return nil, fmt.Errorf("archive unrar technical %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return nil, fmt.Errorf("archive unrar technical %w: %s", err, src)
+	}
+	if len(out) == 0 {
+		return nil, ErrRead
+	}
+	return rarEntries(string(out)), nil
+}
+
+// rarEntries returns the entries of the [unrar program] technical list command,
+// which lists the details of each file as "key: value" lines that begin with the name.
+//
+//	       Name: README.TXT
+//	       Type: File
+//	       Size: 23
+//	Packed size: 23
+//	      mtime: 2023-11-14 22:13:00,000000000
+//	      CRC32: 6A1D1B2F
+//
+// [unrar program]: https://www.rarlab.com/rar_add.htm
+func rarEntries(out string) []Entry {
+	entries := []Entry{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ": ")
+		if !found {
+			continue
+		}
+		if key == "Name" {
+			entries = append(entries, Entry{Name: value})
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		e := &entries[len(entries)-1]
+		switch key {
+		case "Size":
+			e.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "Packed size":
+			e.CompressedSize, _ = strconv.ParseInt(value, 10, 64)
+		case "CRC32":
+			if sum, err := strconv.ParseUint(value, 16, 32); err == nil {
+				e.CRC32 = uint32(sum)
+			}
+		case "mtime":
+			const datetime = len(time.DateTime)
+			if t, err := time.Parse(time.DateTime, value[:min(datetime, len(value))]); err == nil {
+				e.Modified = t
+			}
+		case "Attributes":
+			e.Attributes = value
+		}
+	}
+	return entries
+}
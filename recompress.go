@@ -0,0 +1,176 @@
+package archive
+
+// Package file archive/recompress.go contains the conversion of archives to other formats.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/archive/rezip"
+	"github.com/Defacto2/helper"
+)
+
+// Recompress extracts the src archive to a temporary directory and then repacks the files
+// into the dest archive using the chosen format, which is one of the following:
+//
+//   - "7z" uses the [7z program]
+//   - "tar", "tar.gz" and "tar.zst" use the [bsdtar program]
+//   - "zip" uses the Deflate method of the rezip package
+//
+// An unsupported format returns ErrNotImplemented.
+// If the dest file already exists, an error is returned.
+// The temporary directory is always removed.
+//
+// [7z program]: https://www.7-zip.org/
+// [bsdtar program]: https://man.freebsd.org/cgi/man.cgi?query=bsdtar&sektion=1&format=html
+func Recompress(src, dest, format string) error {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	switch format {
+	case "7z", tarx[1:], "tar.gz", "tar.zst", zipx[1:]:
+	default:
+		return fmt.Errorf("recompress %w: %q", ErrNotImplemented, format)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("recompress %w: %s", fs.ErrExist, dest)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("recompress %w", err)
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("recompress %w", err)
+	}
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-recompress-")
+	if err != nil {
+		return fmt.Errorf("recompress %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	x := Extractor{Source: src, Destination: tmp}
+	if err := x.Extract(); err != nil {
+		return fmt.Errorf("recompress %w", err)
+	}
+	if format == zipx[1:] {
+		if _, err := rezip.CompressDir(tmp, abs); err != nil {
+			return fmt.Errorf("recompress %w", err)
+		}
+		return nil
+	}
+	if err := repack(tmp, abs, format); err != nil {
+		return fmt.Errorf("recompress %w", err)
+	}
+	return nil
+}
+
+// TranscodeOptions are the options of the extraction used by Transcode.
+type TranscodeOptions struct {
+	// PreserveModes restores the Unix file permissions stored in zip and tar source archives,
+	// which are then stored in the destination zip archive.
+	PreserveModes bool
+
+	// AutoCharset renames the files with names that are not valid UTF-8 using the likely codepage
+	// of the source archive, see the Extractor AutoCharset option.
+	AutoCharset bool
+
+	// Password is the passphrase used to extract an encrypted ZIP, RAR or 7z source archive.
+	Password string
+}
+
+// Transcode converts the src archive into the destZip zip archive, while keeping the directory
+// structure and the modification times of the files. It is a high fidelity alternative to
+// the zip format of Recompress, as the source is extracted with the Extractor KeepPaths and
+// PreserveTimes options, and the files are packed with [rezip.CompressTree], which stores
+// the directories, the MS-DOS modification times and the Unix modes of the files.
+//
+// The modification times of the directories are not kept, as they are changed by the extraction.
+// If the destZip file already exists, an error is returned.
+// The temporary directory is always removed.
+func Transcode(src, destZip string, opts TranscodeOptions) error {
+	if _, err := os.Stat(destZip); err == nil {
+		return fmt.Errorf("transcode %w: %s", fs.ErrExist, destZip)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("transcode %w", err)
+	}
+	abs, err := filepath.Abs(destZip)
+	if err != nil {
+		return fmt.Errorf("transcode %w", err)
+	}
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-transcode-")
+	if err != nil {
+		return fmt.Errorf("transcode %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	x := Extractor{
+		Source:        src,
+		Destination:   tmp,
+		KeepPaths:     true,
+		PreserveTimes: true,
+		PreserveModes: opts.PreserveModes,
+		AutoCharset:   opts.AutoCharset,
+		Password:      opts.Password,
+	}
+	if err := x.Extract(); err != nil {
+		return fmt.Errorf("transcode %w", err)
+	}
+	if _, err := rezip.CompressTree(tmp, abs); err != nil {
+		defer os.Remove(abs)
+		return fmt.Errorf("transcode %w", err)
+	}
+	return nil
+}
+
+// repack creates the dest archive of the chosen format from the files in the root directory
+// using the system archiver programs.
+func repack(root, dest, format string) error {
+	var prog string
+	var args []string
+	switch format {
+	case "7z":
+		const (
+			add   = "a"    // a add files to archive
+			quiet = "-bb0" // -bb0 quiet
+			yes   = "-y"   // -y assume yes to all queries
+			all   = "*"    // all files, expanded by the 7z program
+		)
+		prog, args = command.Zip7, []string{add, quiet, yes, dest, all}
+	default:
+		const (
+			create  = "-c"     // -c create a new archive
+			output  = "--file" // -f file path of the archive
+			workDir = "--cd"   // -C change to the directory
+			all     = "."      // all files of the directory
+		)
+		args = []string{create, output, dest}
+		switch format {
+		case "tar.gz":
+			args = append(args, "--gzip")
+		case "tar.zst":
+			args = append(args, "--zstd")
+		}
+		prog, args = "bsdtar", append(args, workDir, root, all)
+	}
+	path, err := exec.LookPath(prog)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutMax)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = root
+	cmd.Stderr = &b
+	if err := cmd.Run(); err != nil {
+		defer os.Remove(dest)
+		if b.String() != "" {
+			return fmt.Errorf("%w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return fmt.Errorf("%w: %s", err, prog)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package rezip
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/Defacto2/archive/pkzip"
+)
+
+// Builder incrementally writes a zip archive to a stream using the Deflate method,
+// for example to send a zip download to a client while the files become available,
+// without first buffering the archive to disk.
+type Builder struct {
+	w *zip.Writer
+}
+
+// NewBuilder returns a Builder that writes a zip archive to w.
+// Close must be called to write the central directory that completes the archive.
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{w: zip.NewWriter(w)}
+}
+
+// Add compresses the content of r into the zip archive using the name,
+// which should use forward slashes for any directories.
+// The current time is used as the modification time of the file.
+func (b *Builder) Add(name string, r io.Reader) error {
+	fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	fh.ModifiedDate, fh.ModifiedTime = pkzip.DosDateTime(time.Now())
+	zipWr, err := b.w.CreateHeader(fh)
+	if err != nil {
+		return fmt.Errorf("rezip builder failed to create writer: %w", err)
+	}
+	if _, err := io.Copy(zipWr, r); err != nil {
+		return fmt.Errorf("rezip builder failed to write bytes: %w", err)
+	}
+	return nil
+}
+
+// AddFile compresses the file at path into the zip archive using the base name of the file
+// and the modification time of the file.
+func (b *Builder) AddFile(path string) error {
+	if _, err := add(b.w, filepath.Base(path), path); err != nil {
+		return fmt.Errorf("rezip builder failed to add file: %w", err)
+	}
+	return nil
+}
+
+// Close writes the central directory and finishes the zip archive.
+// It does not close the underlying writer.
+func (b *Builder) Close() error {
+	if err := b.w.Close(); err != nil {
+		return fmt.Errorf("rezip builder failed to close: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ import (
 	"archive/zip"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -60,16 +63,48 @@ func Compress(name, dest string) (int, error) {
 // The dest must be a valid file path and should include the .zip extension.
 // If the dest file already exists, an error is returned.
 func CompressDir(root, dest string) (int64, error) {
+	results, err := compressDir(root, dest)
+	if err != nil {
+		return 0, err
+	}
+	var written int64
+	for _, result := range results {
+		written += result.Size
+	}
+	return written, nil
+}
+
+// FileResult is the result of a file that was compressed into a zip archive.
+type FileResult struct {
+	Name  string // Name of the file within the zip archive.
+	Size  int64  // Size is the number of uncompressed bytes written.
+	CRC32 uint32 // CRC32 is the IEEE checksum of the uncompressed file.
+}
+
+// CompressDirCRC compresses the named root directory into the dest zip file
+// using the Deflate method. The name, size and CRC32 checksum of each
+// compressed file is returned in the order the files were added.
+//
+// The checksum is calculated while the file is being compressed,
+// so it does not require a second read of the file.
+//
+// The dest must be a valid file path and should include the .zip extension.
+// If the dest file already exists, an error is returned.
+func CompressDirCRC(root, dest string) ([]FileResult, error) {
+	return compressDir(root, dest)
+}
+
+func compressDir(root, dest string) ([]FileResult, error) {
 	zipfile, err := os.OpenFile(dest, createUnique, helper.WriteWriteRead)
 	if err != nil {
-		return 0, fmt.Errorf("rezip compress dir failed to open file: %w", err)
+		return nil, fmt.Errorf("rezip compress dir failed to open file: %w", err)
 	}
 	defer zipfile.Close()
 
 	w := zip.NewWriter(zipfile)
 	defer w.Close()
 
-	var written int64
+	results := []FileResult{}
 	addFile := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("add file: %w", err)
@@ -84,28 +119,121 @@ func CompressDir(root, dest string) (int64, error) {
 		if err != nil {
 			return fmt.Errorf("add file: %w", err)
 		}
-		zipWr, err := w.Create(rel)
+		result, err := add(w, rel, path)
 		if err != nil {
 			return fmt.Errorf("add file: %w", err)
 		}
-		b, err := os.ReadFile(path)
+		results = append(results, result)
+		return nil
+	}
+
+	err = filepath.Walk(root, addFile)
+	if err != nil {
+		return nil, fmt.Errorf("rezip compress dir failed to add file: %w", err)
+	}
+
+	return results, nil
+}
+
+// CompressTree compresses the named root directory into the dest zip file
+// using the Deflate method, which keeps the structure, the modification times
+// and the Unix modes of the files and directories, including any empty directories.
+// The name, size and CRC32 checksum of each compressed file is returned in the order
+// the files were added, and other file types such as symbolic links are skipped.
+//
+// The dest must be a valid file path and should include the .zip extension.
+// If the dest file already exists, an error is returned.
+func CompressTree(root, dest string) ([]FileResult, error) {
+	zipfile, err := os.OpenFile(dest, createUnique, helper.WriteWriteRead)
+	if err != nil {
+		return nil, fmt.Errorf("rezip compress tree failed to open file: %w", err)
+	}
+	defer zipfile.Close()
+
+	w := zip.NewWriter(zipfile)
+	defer w.Close()
+
+	results := []FileResult{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		info, err := d.Info()
 		if err != nil {
-			return fmt.Errorf("add file: %w", err)
+			return err
 		}
-		n, err := zipWr.Write(b)
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
-			return fmt.Errorf("add file: %w", err)
+			return err
+		}
+		fh := &zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Deflate}
+		fh.ModifiedDate, fh.ModifiedTime = pkzip.DosDateTime(info.ModTime())
+		fh.SetMode(info.Mode())
+		if info.IsDir() {
+			fh.Name += "/"
+			fh.Method = zip.Store
+			_, err := w.CreateHeader(fh)
+			return err
+		}
+		result, err := write(w, fh, path)
+		if err != nil {
+			return err
 		}
-		written += int64(n)
+		results = append(results, result)
 		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rezip compress tree failed to add file: %w", err)
 	}
+	return results, nil
+}
 
-	err = filepath.Walk(root, addFile)
+// add compresses the file at path into the zip writer using the name.
+// The CRC32 checksum is calculated from the file bytes as they are copied.
+func add(w *zip.Writer, name, path string) (FileResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileResult{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
 	if err != nil {
-		return 0, fmt.Errorf("rezip compress dir failed to add file: %w", err)
+		return FileResult{}, err
 	}
+	// The MS-DOS timestamp is used in place of the Modified field, as the Modified field
+	// also writes an extended timestamp that is unknown to the DOS era zip programs.
+	fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	fh.ModifiedDate, fh.ModifiedTime = pkzip.DosDateTime(st.ModTime())
+	return copyFile(w, fh, f)
+}
 
-	return written, nil
+// write compresses the file at path into the zip writer using the fh header.
+func write(w *zip.Writer, fh *zip.FileHeader, path string) (FileResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileResult{}, err
+	}
+	defer f.Close()
+	return copyFile(w, fh, f)
+}
+
+// copyFile compresses the content of r into the zip writer using the fh header.
+// The CRC32 checksum is calculated from the file bytes as they are copied.
+func copyFile(w *zip.Writer, fh *zip.FileHeader, r io.Reader) (FileResult, error) {
+	name := fh.Name
+	zipWr, err := w.CreateHeader(fh)
+	if err != nil {
+		return FileResult{}, err
+	}
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(zipWr, io.TeeReader(r, hash))
+	if err != nil {
+		return FileResult{}, err
+	}
+	return FileResult{Name: name, Size: n, CRC32: hash.Sum32()}, nil
 }
 
 // Test runs the rezip test command on the named file. If the file is a directory
@@ -1,10 +1,14 @@
 package rezip_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Defacto2/archive/rezip"
 	"github.com/Defacto2/helper"
@@ -87,3 +91,79 @@ func TestUnzip(t *testing.T) {
 	err = rezip.Test(src)
 	require.Error(t, err)
 }
+
+func TestCompressDirCRC(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp(helper.TmpDir(), "unzip_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "unzip_test.zip")
+
+	results, err := rezip.CompressDirCRC(td(""), dest)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+
+	r, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Len(t, r.File, len(results))
+	for i, file := range r.File {
+		assert.Equal(t, file.Name, results[i].Name)
+		assert.Equal(t, file.CRC32, results[i].CRC32)
+		assert.Equal(t, int64(file.UncompressedSize64), results[i].Size)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	b := rezip.NewBuilder(&buf)
+	require.NoError(t, b.Add("DOCS/README.TXT", strings.NewReader("hello")))
+	require.NoError(t, b.AddFile(td("PK00.ZIP")))
+	require.Error(t, b.AddFile(td("missing.file")))
+	require.NoError(t, b.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, 2)
+	assert.Equal(t, "DOCS/README.TXT", r.File[0].Name)
+	assert.Equal(t, "PK00.ZIP", r.File[1].Name)
+	st, err := os.Stat(td("PK00.ZIP"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(st.Size()), r.File[1].UncompressedSize64)
+}
+
+func TestCompressTree(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "DOCS", "EMPTY"), 0o755))
+	name := filepath.Join(root, "DOCS", "RUN.SH")
+	require.NoError(t, os.WriteFile(name, []byte("#!/bin/sh\n"), 0o755))
+	mod := time.Date(1994, time.July, 15, 13, 45, 30, 0, time.Local)
+	require.NoError(t, os.Chtimes(name, mod, mod))
+
+	dest := filepath.Join(t.TempDir(), "tree.zip")
+	results, err := rezip.CompressTree(root, dest)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "DOCS/RUN.SH", results[0].Name)
+
+	r, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer r.Close()
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"DOCS/", "DOCS/EMPTY/", "DOCS/RUN.SH"}, names)
+	file := r.File[2]
+	assert.Equal(t, os.FileMode(0o755), file.Mode().Perm())
+	// the MS-DOS timestamp is the local wall clock time without a location
+	assert.Equal(t, mod.Format(time.DateTime), file.Modified.Format(time.DateTime))
+
+	_, err = rezip.CompressTree(root, dest)
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package archive
+
+// Package file archive/sevenzip.go contains the 7z archive property functions.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Defacto2/archive/command"
+)
+
+// SevenZipProps are the properties of a 7z archive, as reported by the technical list command
+// of the [7z program].
+//
+// [7z program]: https://www.7-zip.org/
+type SevenZipProps struct {
+	Method          string // Method are the compression methods and filters, for example "LZMA2:24 BCJ" or "PPMd:o6".
+	Solid           bool   // Solid is true when the files are compressed together in blocks.
+	Blocks          int    // Blocks is the number of compressed blocks.
+	HeadersSize     int64  // HeadersSize is the size of the archive headers in bytes.
+	PhysicalSize    int64  // PhysicalSize is the size of the archive file in bytes.
+	Encrypted       bool   // Encrypted is true when the data of any file is encrypted.
+	HeaderEncrypted bool   // HeaderEncrypted is true when the headers are encrypted, so a password is needed to list the files.
+}
+
+// SevenZipInfo returns the properties of the src 7z archive using the technical list command
+// of the [7z program]. The properties can be used to choose an extraction strategy,
+// for example an archive with encrypted headers needs a password even to list the files,
+// in which case only HeaderEncrypted is set and no error is returned.
+//
+// [7z program]: https://www.7-zip.org/
+func SevenZipInfo(src string) (SevenZipProps, error) {
+	prog, err := exec.LookPath(command.Zip7)
+	if err != nil {
+		return SevenZipProps{}, fmt.Errorf("seven zip info %w", err)
+	}
+	const (
+		list      = "l"    // l list contents of archive
+		technical = "-slt" // -slt show technical information
+	)
+	var b bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, list, technical, src)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if zip7Encrypted(string(out) + b.String()) {
+		return SevenZipProps{HeaderEncrypted: true}, nil
+	}
+	if err != nil {
+		if b.String() != "" {
+			return SevenZipProps{}, fmt.Errorf("seven zip info %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return SevenZipProps{}, fmt.Errorf("seven zip info %w: %s", err, prog)
+	}
+	return zip7Info(string(out)), nil
+}
+
+// zip7Encrypted returns true if the output of the 7z program reports an archive with encrypted headers,
+// which the program is unable to open without a password.
+func zip7Encrypted(out string) bool {
+	for _, s := range []string{"Can not open encrypted archive", "Cannot open encrypted archive", "Enter password"} {
+		if strings.Contains(out, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// zip7Info returns the archive properties from the output of the 7z technical list command.
+// The archive properties are the block that follows the "--" line,
+// while the properties of each file follow the "----------" line.
+//
+//	--
+//	Path = ARCHIVE.7Z
+//	Type = 7z
+//	Physical Size = 758598
+//	Headers Size = 250
+//	Method = LZMA2:24 BCJ
+//	Solid = +
+//	Blocks = 1
+func zip7Info(out string) SevenZipProps {
+	out = strings.ReplaceAll(out, "\r\n", "\n")
+	head, list, _ := strings.Cut(out, "\n----------\n")
+	if _, archive, found := strings.Cut(head, "\n--\n"); found {
+		head = archive
+	}
+	props := zip7Props(head)
+	var p SevenZipProps
+	p.Method = props["Method"]
+	p.Solid = props["Solid"] == "+"
+	p.Blocks, _ = strconv.Atoi(props["Blocks"])
+	p.HeadersSize, _ = strconv.ParseInt(props["Headers Size"], 10, 64)
+	p.PhysicalSize, _ = strconv.ParseInt(props["Physical Size"], 10, 64)
+	p.Encrypted = strings.Contains(p.Method, "7zAES")
+	for _, block := range strings.Split(list, "\n\n") {
+		if zip7Props(block)["Encrypted"] == "+" {
+			p.Encrypted = true
+			break
+		}
+	}
+	return p
+}
+
+// ErrPattern is returned when a wildcard pattern is empty, absolute or escapes the destination.
+var ErrPattern = errors.New("invalid wildcard pattern")
+
+// Zip7Match extracts the files of the source archive that match any of the wildcard patterns,
+// such as "*.nfo", to the destination directory using the recursive include switch of the [7z program].
+// The patterns match the names of the files within any directory of the archive, so all the matches
+// are extracted with their paths in a single run of the program, rather than listing the archive
+// to find the targets. At least one pattern is required, and ErrMissing is returned when
+// no files match the patterns.
+//
+// As with Extract, the archive listing is checked against the limits of the Extractor before
+// the program is run, the Password is given to the program, and the AllowLinks, RemoveLinks
+// and AutoCharset options are applied to the extracted files. The CaseInsensitive, SkipAppleDouble,
+// StripComponents and Rename options are not used, as the patterns are matched by the program.
+//
+// [7z program]: https://www.7-zip.org/
+func (x Extractor) Zip7Match(patterns ...string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("archive 7z match %w: no patterns", ErrPattern)
+	}
+	for _, pattern := range patterns {
+		name := filepath.FromSlash(pattern)
+		if strings.TrimSpace(pattern) == "" || !filepath.IsLocal(name) {
+			return fmt.Errorf("archive 7z match %w: %q", ErrPattern, pattern)
+		}
+	}
+	src, dst := x.Source, x.Destination
+	if err := destDir(dst); err != nil {
+		return err
+	}
+	prog, err := exec.LookPath(command.Zip7)
+	if err != nil {
+		return fmt.Errorf("archive 7z match %w", err)
+	}
+	sign, err := signature(src)
+	if err != nil {
+		return fmt.Errorf("archive 7z match %w", err)
+	}
+	if err := x.inspect(sign); err != nil {
+		return fmt.Errorf("archive 7z match %w", err)
+	}
+	existing := x.existingLinks()
+	var b, out bytes.Buffer
+	ctx, cancel := x.context(TimeoutExtract)
+	defer cancel()
+	const (
+		extract   = "x"    // x extract files with full paths
+		overwrite = "-aoa" // -aoa overwrite all
+		include   = "-ir!" // -ir! include the recursive wildcard
+		targetDir = "-o"   // -o output directory
+		yes       = "-y"   // -y assume yes to all queries
+		password  = "-p"   // -p set the password
+	)
+	args := []string{extract, overwrite, yes, targetDir + dst}
+	if x.Password != "" {
+		args = append(args, password+x.Password)
+	}
+	args = append(args, src)
+	for _, pattern := range patterns {
+		args = append(args, include+pattern)
+	}
+	cmd := exec.CommandContext(ctx, prog, args...)
+	x.output(cmd, &b)
+	if cmd.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(&out, cmd.Stdout)
+	} else {
+		cmd.Stdout = &out
+	}
+	if err = cmd.Run(); err != nil {
+		if wrongPassword(&b) {
+			err = fmt.Errorf("archive 7z match %w: %s", ErrWrongPassword, src)
+		} else if b.String() != "" {
+			err = fmt.Errorf("archive 7z match %w: %s: %s", ErrProg, prog, stderr(&b))
+		} else {
+			err = fmt.Errorf("archive 7z match %w: %s", err, prog)
+		}
+	} else if strings.Contains(out.String(), "No files to process") {
+		return fmt.Errorf("archive 7z match %w: no files match %s", ErrMissing, strings.Join(patterns, " "))
+	}
+	if ferr := x.finish(existing); ferr != nil {
+		if err == nil {
+			return fmt.Errorf("archive 7z match %w", ferr)
+		}
+		return errors.Join(err, ferr)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package archive
+
+// Package file archive/sfx.go contains the self-extracting archive detection functions.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+)
+
+var (
+	exeSign = []byte("MZ")           // MS-DOS and Windows executable signature
+	arjSign = []byte{0x60, 0xea}     // ARJ header signature
+	lhaSign = []byte("-lh")          // LHA compression method prefix
+	rarSign = []byte("Rar!\x1a\x07") // RAR signature of all versions
+)
+
+const (
+	sfxScan = 32 * 1024       // sfxScan is the size of the chunks read while scanning.
+	sfxMax  = 4 * 1024 * 1024 // sfxMax is the maximum offset scanned for an embedded archive.
+)
+
+// SFXFormat returns the file extension of the archive that is embedded in the src self-extracting
+// MS-DOS or Windows program, which is one of ".arj", ".lha", ".rar" or ".zip".
+// An empty string is returned for an ordinary program or a file that is not a program.
+//
+// Zip archives are found using the end of central directory record at the end of the file,
+// while the other formats are found by scanning the start of the file for their headers,
+// where the first header found is used.
+func SFXFormat(src string) (string, error) {
+	p, err := HeaderBytes(src, len(exeSign))
+	if err != nil {
+		return "", fmt.Errorf("sfx format %w", err)
+	}
+	if !bytes.Equal(p, exeSign) {
+		return "", nil
+	}
+	if entries, err := pkzip.CentralDirectory(src); err == nil && len(entries) > 0 {
+		return zipx, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("sfx format %w", err)
+	}
+	defer f.Close()
+	const overlap = 32
+	buf := make([]byte, sfxScan+overlap)
+	for pos := int64(0); pos < sfxMax; pos += sfxScan {
+		n, err := f.ReadAt(buf, pos)
+		if ext := sfxMatch(buf[:n]); ext != "" {
+			return ext, nil
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("sfx format %w", err)
+		}
+	}
+	return "", nil
+}
+
+// sfxMatch returns the file extension of the first archive header found in the p bytes.
+func sfxMatch(p []byte) string {
+	for i := range p {
+		b := p[i:]
+		switch {
+		case bytes.HasPrefix(b, rarSign):
+			return rarx
+		case bytes.HasPrefix(b, arjSign) && arjMain(b):
+			return arjx
+		case i >= 2 && bytes.HasPrefix(b, lhaSign) && lhaMethod(p[i-2:]):
+			return lhax
+		}
+	}
+	return ""
+}
+
+// arjMain returns true if the p bytes begin with an ARJ main header,
+// which has a basic header size of at most 2600 bytes and a file type of 2.
+func arjMain(p []byte) bool {
+	const fileType, mainHeader, maxSize = 10, 2, 2600
+	if len(p) <= fileType {
+		return false
+	}
+	size := int(p[2]) | int(p[3])<<8
+	return size > 0 && size <= maxSize && p[fileType] == mainHeader
+}
+
+// lhaMethod returns true if the p bytes begin with an LHA file header,
+// which has a compression method such as "-lh5-" and a header level of 0 to 2.
+func lhaMethod(p []byte) bool {
+	const method, level, maxLevel = 2, 20, 2
+	if len(p) <= level {
+		return false
+	}
+	m := p[method : method+5]
+	return m[4] == '-' && p[level] <= maxLevel
+}
+
+// extractSFX extracts the targets from the archive embedded in the source self-extracting program,
+// using the extractor of the embedded archive format.
+func (x Extractor) extractSFX(sign magicnumber.Signature, targets ...string) error {
+	ext, err := SFXFormat(x.Source)
+	if err != nil {
+		return fmt.Errorf("extract sfx %w", err)
+	}
+	switch ext {
+	case zipx:
+		return x.extractZip(targets...)
+	case rarx:
+		return x.Rar(targets...)
+	case arjx:
+		return x.ARJ(targets...)
+	case lhax:
+		return x.LHA(targets...)
+	}
+	return fmt.Errorf("extract sfx %w, %s", ErrNotImplemented, sign)
+}
@@ -0,0 +1,246 @@
+package archive
+
+// Package file archive/stream.go contains the streamed extraction of a single file and the tar stream of an archive.
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/helper"
+	"github.com/Defacto2/magicnumber"
+)
+
+// OpenFile returns a reader of the named file within the source archive,
+// which is streamed from the standard output of the archiver program.
+// Unlike extraction, the file is never written to the destination directory
+// and is not buffered in memory, so the caller reads the content at their own pace.
+// There is no timeout, as the program runs until its output is read or the reader is closed.
+//
+// The returned reader must be closed, which stops the archiver program if it is still running.
+// Any failure of the archiver program, such as the named file not being found in the archive,
+// is returned by Close after the content has been read.
+//
+// The supported formats are 7z, LHA, RAR, TAR, and ZIP including gzip and bzip2 compressed tarballs.
+func (x Extractor) OpenFile(name string) (io.ReadCloser, error) {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return nil, fmt.Errorf("extractor open file %w", err)
+	}
+	var prog string
+	var args []string
+	switch sign {
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		const pipe = "-p" // extract files to pipe, no messages
+		prog, args = command.Unzip, []string{pipe, x.Source, name}
+	case magicnumber.X7zCompressArchive:
+		const (
+			extract = "e"   // e extract files without paths
+			stdout  = "-so" // -so write data to stdout
+		)
+		prog, args = command.Zip7, []string{extract, stdout, x.Source, name}
+	case magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		const (
+			pipe  = "p"     // p print file to stdout
+			quiet = "-inul" // -inul disable all messages
+		)
+		prog, args = command.Unrar, []string{pipe, quiet, x.Source, name}
+	case magicnumber.YoshiLHA:
+		const pipe = "pq" // p print to stdout, q quiet mode
+		prog, args = command.Lha, []string{pipe, x.Source, name}
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		const (
+			extract = "-x"     // -x extract files
+			stdout  = "-O"     // -O write the files to stdout
+			source  = "--file" // -f file path to extract
+		)
+		prog, args = "bsdtar", []string{extract, stdout, source, x.Source, name}
+	default:
+		return nil, fmt.Errorf("extractor open file %w, %s", ErrNotImplemented, sign)
+	}
+	path, err := exec.LookPath(prog)
+	if err != nil {
+		return nil, fmt.Errorf("extractor open file %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, path, args...)
+	p := &pipeFile{cmd: cmd, cancel: cancel}
+	cmd.Stderr = &p.stderr
+	if p.stdout, err = cmd.StdoutPipe(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("extractor open file %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("extractor open file %w", err)
+	}
+	return p, nil
+}
+
+// ExtractToWriter writes the content of the target file within the source archive to w,
+// which is streamed from the archiver program without writing to the destination directory,
+// so the Destination is not required. The supported formats are the same as OpenFile.
+//
+// The source archive is listed beforehand, so ErrMissing is returned when the target is not
+// within the archive, which is distinct from the ErrProg of a failed archiver program.
+// When CaseInsensitive is set, the target is matched regardless of case.
+func (x Extractor) ExtractToWriter(w io.Writer, target string) error {
+	sign, err := signature(x.Source)
+	if err != nil {
+		return fmt.Errorf("extract to writer %w", err)
+	}
+	c := Content{ctx: x.ctx}
+	if err := c.readSign(x.Source, sign); err != nil {
+		return fmt.Errorf("extract to writer %w", err)
+	}
+	i := slices.Index(c.Files, target)
+	if i < 0 && x.CaseInsensitive {
+		i = slices.IndexFunc(c.Files, func(name string) bool {
+			return strings.EqualFold(name, target)
+		})
+	}
+	if i < 0 {
+		return fmt.Errorf("extract to writer %w: %s", ErrMissing, target)
+	}
+	r, err := x.OpenFile(c.Files[i])
+	if err != nil {
+		return fmt.Errorf("extract to writer %w", err)
+	}
+	_, err = io.Copy(w, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("extract to writer %w", err)
+	}
+	return nil
+}
+
+// pipeFile is the standard output of an archiver program that is streaming a file.
+type pipeFile struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	eof    bool // eof is true when the whole output of the program has been read.
+}
+
+// Read reads the output of the archiver program.
+func (p *pipeFile) Read(b []byte) (int, error) {
+	n, err := p.stdout.Read(b)
+	if errors.Is(err, io.EOF) {
+		p.eof = true
+	}
+	return n, err
+}
+
+// Close stops the archiver program when the output has not been fully read,
+// and waits for the program to exit.
+// An error is only returned when the program fails after the whole output was read.
+func (p *pipeFile) Close() error {
+	if !p.eof {
+		p.cancel()
+	}
+	err := p.cmd.Wait()
+	p.cancel()
+	if err == nil || !p.eof {
+		return nil
+	}
+	prog := p.cmd.Path
+	if s := stderr(&p.stderr); s != "" {
+		return fmt.Errorf("extractor open file %w: %s: %s", ErrProg, prog, s)
+	}
+	return fmt.Errorf("extractor open file %w: %s", err, prog)
+}
+
+// StreamTar writes all the files of the source archive to w as an uncompressed tar stream,
+// which gives a single uniform format to pipe into another process regardless of the source format.
+// The archive is extracted to a temporary directory, which is then removed,
+// so the Extractor options such as AllowLinks, RemoveLinks and AutoCharset apply to the stream.
+// The Destination directory is not used.
+//
+// The tar entries use forward slash paths relative to the root of the archive,
+// with the directories and any kept symbolic links included.
+func (x Extractor) StreamTar(w io.Writer) error {
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-stream-")
+	if err != nil {
+		return fmt.Errorf("stream tar %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	x.Destination = tmp
+	if err := x.Extract(); err != nil {
+		return fmt.Errorf("stream tar %w", err)
+	}
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(tmp, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == tmp {
+			return err
+		}
+		return tarEntry(tw, tmp, path, d)
+	})
+	if err != nil {
+		return fmt.Errorf("stream tar %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("stream tar %w", err)
+	}
+	return nil
+}
+
+// tarEntry writes the file, directory or symbolic link at path within the root directory to tw.
+func tarEntry(tw *tar.Writer, root, path string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
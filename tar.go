@@ -0,0 +1,198 @@
+package archive
+
+// Package file archive/tar.go contains the native tape archive reading functions.
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Defacto2/magicnumber"
+)
+
+const tarx = ".tar" // Tape ARchive
+
+// Tar returns the content of the src tar archive using the Go standard library,
+// which includes tarballs compressed with gzip or bzip2.
+// Names longer than 100 characters that are stored using the PAX extended headers
+// or the GNU ././@LongLink entries are reported in full.
+// Symbolic link entries report their target in the LinkTarget of the entry,
+// while directory entries are skipped.
+func (c *Content) Tar(src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("archive tar reader %w", err)
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return fmt.Errorf("archive tar reader %w", err)
+	}
+	tr := tar.NewReader(r)
+	files := []string{}
+	entries := []Entry{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive tar reader %w: %s", err, src)
+		}
+		e := Entry{
+			Name: hdr.Name, Size: hdr.Size, Modified: hdr.ModTime.UTC(),
+			Attributes: hdr.FileInfo().Mode().String(),
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeSymlink:
+			e.LinkTarget = hdr.Linkname
+		}
+		files = append(files, e.Name)
+		entries = append(entries, e)
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = tarx
+	c.Tool = "archive/tar"
+	return nil
+}
+
+// tarCount returns the number of entries in the src tar archive, which includes any directories.
+// The headers are read in order without keeping the names, so it is cheaper than a listing.
+func tarCount(src string) (int, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("archive tar count %w", err)
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("archive tar count %w", err)
+	}
+	tr := tar.NewReader(r)
+	count := 0
+	for {
+		_, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("archive tar count %w: %s", err, src)
+		}
+		count++
+	}
+}
+
+// tarMembers returns the listing of the src tar archive using the names and sizes of the headers,
+// which includes any directories.
+func tarMembers(src string) (listing, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return listing{}, err
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return listing{}, err
+	}
+	l, err := tarListing(tar.NewReader(r))
+	if err != nil {
+		return listing{}, err
+	}
+	return l, nil
+}
+
+// tarListing returns the listing of the members read by the tr tar reader,
+// which is returned with the members read before any error.
+func tarListing(tr *tar.Reader) (listing, error) {
+	l := listing{sized: true}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return l, nil
+		}
+		if err != nil {
+			return l, err
+		}
+		l.names = append(l.names, hdr.Name)
+		l.size += hdr.Size
+	}
+}
+
+// tarNames calls keep with the name of each file in the src tar archive, skipping the directories
+// and any duplicate names, so the names are read in order without building a listing.
+// The reading stops when keep returns an error, which is returned.
+func tarNames(src string, keep func(name string) error) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir || redundant(hdr.Name, seen) {
+			continue
+		}
+		if err := keep(hdr.Name); err != nil {
+			return err
+		}
+	}
+}
+
+// tarSpecial returns ErrSpecialFile with the name of the first character device, block device
+// or FIFO entry in the src tar archive. Nil is returned for a src file that cannot be read as a tar
+// archive, such as the other formats extracted by bsdtar, which are left for the program to handle.
+func tarSpecial(src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	r, err := tarReader(f)
+	if err != nil {
+		return nil
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil
+		}
+		switch hdr.Typeflag {
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			return fmt.Errorf("%w: %s", ErrSpecialFile, hdr.Name)
+		}
+	}
+}
+
+// tarReader returns a reader of the tar archive, which decompresses the file
+// when it is a gzip or bzip2 compressed tarball.
+// The magic number matchers read at an offset, so the file is still read from the start.
+func tarReader(f *os.File) (io.Reader, error) {
+	switch {
+	case magicnumber.Gzip(f):
+		return gzip.NewReader(f)
+	case magicnumber.Bzip2(f):
+		return bzip2.NewReader(f), nil
+	}
+	return f, nil
+}
@@ -0,0 +1,201 @@
+package archive
+
+// Package file archive/walk.go contains the functions that walk the files within an archive.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/archive/pkzip"
+	"github.com/Defacto2/magicnumber"
+)
+
+// Walk calls fn with the name of each file within the src archive, in the order the files are stored,
+// without building the complete listing in memory. The directories and any duplicate names are skipped.
+// If fn returns [fs.SkipAll], the walk stops and Walk returns nil, which allows a search for
+// a single file, such as the first README, to stop without reading the rest of the archive.
+// Any other error returned by fn stops the walk and is returned.
+//
+// Tar archives, including tarballs compressed with gzip or bzip2, are streamed, zip archives use the
+// central directory, and the names of RAR archives are read line by line as the unrar program
+// lists them. Other formats, and zip archives with names in a legacy codepage such as CP437,
+// are listed in full using the reader of the archive signature before fn is called,
+// so the names are decoded the same as the listing.
+func (c *Content) Walk(src string, fn func(name string) error) error {
+	err := c.walk(src, fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// walk calls fn with the name of each file within the src archive using the reader of its signature.
+func (c *Content) walk(src string, fn func(name string) error) error {
+	sign, err := signature(src)
+	if err != nil {
+		return fmt.Errorf("archive walk %w", err)
+	}
+	switch sign {
+	case
+		magicnumber.Bzip2CompressArchive,
+		magicnumber.GzipCompressArchive,
+		magicnumber.TapeARchive:
+		called := false
+		err := tarNames(src, func(name string) error {
+			called = true
+			return fn(name)
+		})
+		// gzip compressed files that are not tarballs are read by the signature reader
+		if err == nil || called {
+			return err
+		}
+	case
+		magicnumber.PKWAREZip,
+		magicnumber.PKWAREZip64,
+		magicnumber.PKWAREZipShrink,
+		magicnumber.PKWAREZipReduce,
+		magicnumber.PKWAREZipImplode:
+		// the names that are neither ASCII nor flagged as UTF-8 are decoded by the zip reader,
+		// so the walk returns the same names as the listing
+		if headers, err := pkzip.CentralDirectory(src); err == nil && !slices.ContainsFunc(headers, zipLegacy) {
+			seen := make(map[string]bool, len(headers))
+			for _, h := range headers {
+				if redundant(h.Name, seen) {
+					continue
+				}
+				if err := fn(h.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case
+		magicnumber.RoshalARchive,
+		magicnumber.RoshalARchivev5:
+		return c.walkRar(src, fn)
+	}
+	if err := c.readSign(src, sign); err != nil {
+		return fmt.Errorf("archive walk %w", err)
+	}
+	for _, name := range c.Files {
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipLegacy returns true if the name of the zip file header h uses a legacy codepage,
+// as it is not ASCII and the UTF-8 language encoding flag is not set.
+func zipLegacy(h pkzip.Entry) bool {
+	if h.UTF8() {
+		return false
+	}
+	return strings.ContainsFunc(h.Name, func(r rune) bool {
+		return r >= utf8.RuneSelf
+	})
+}
+
+// walkRar calls fn with each name of the technical list command of the [unrar program]
+// as the lines are output, and stops the program when fn returns an error.
+// The names are called once the details of the entry are read, so the directories are skipped,
+// as the program lists the names of directories without a trailing slash.
+//
+// [unrar program]: https://www.rarlab.com/rar_add.htm
+func (c *Content) walkRar(src string, fn func(name string) error) error {
+	prog, err := exec.LookPath(command.Unrar)
+	if err != nil {
+		return fmt.Errorf("archive unrar walk %w", err)
+	}
+	if err := rarSupport(c.ctx, prog, src); err != nil {
+		return fmt.Errorf("archive unrar walk %w", err)
+	}
+	const (
+		listTechnical = "lt"
+		noComments    = "-c-"
+	)
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, listTechnical, "-ep", noComments, src)
+	cmd.Stderr = &b
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("archive unrar walk %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("archive unrar walk %w", err)
+	}
+	seen := make(map[string]bool)
+	name, dir := "", false
+	// call fn with the name of the previous entry, unless it is a directory
+	call := func() error {
+		if name == "" || dir || redundant(name, seen) {
+			return nil
+		}
+		return fn(name)
+	}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), ": ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Name":
+			if err := call(); err != nil {
+				cancel()
+				_ = cmd.Wait()
+				return err
+			}
+			name, dir = value, false
+		case "Type":
+			dir = dir || value == "Directory"
+		case "Attributes":
+			dir = dir || rarDir(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// the program is stopped, as it would otherwise block on writing to the unread output
+		cancel()
+		_ = cmd.Wait()
+		return fmt.Errorf("archive unrar walk %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		if b.String() != "" {
+			return fmt.Errorf("archive unrar walk %w: %s: %s", ErrProg, prog, stderr(&b))
+		}
+		return fmt.Errorf("archive unrar walk %w: %s", err, src)
+	}
+	return call()
+}
+
+// rarDir returns true if the attributes of a RAR entry are those of a directory,
+// which are either the Unix permissions, such as "drwxr-xr-x", or the Windows attributes, such as "...D...".
+func rarDir(attributes string) bool {
+	if strings.HasPrefix(attributes, "d") {
+		return true
+	}
+	return !strings.HasPrefix(attributes, "-") && !strings.HasPrefix(attributes, "l") &&
+		strings.Contains(attributes, "D")
+}
+
+// Walk calls fn with the name of each file within the source archive, the same as Content.Walk,
+// where the AppleDouble files are skipped when SkipAppleDouble is set. No files are extracted.
+func (x Extractor) Walk(fn func(name string) error) error {
+	c := Content{ctx: x.ctx}
+	return c.Walk(x.Source, func(name string) error {
+		if x.SkipAppleDouble && AppleDouble(name) {
+			return nil
+		}
+		return fn(name)
+	})
+}
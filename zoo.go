@@ -0,0 +1,163 @@
+package archive
+
+// Package file archive/zoo.go contains the Zoo archive functions.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Defacto2/archive/command"
+	"github.com/Defacto2/helper"
+)
+
+const zoox = ".zoo" // Zoo by Rahul Dhesi
+
+// Zoo returns the content of the src Zoo archive,
+// credited to Rahul Dhesi, using the [zoo program].
+//
+// [zoo program]: https://launchpad.net/ubuntu/+source/zoo
+func (c *Content) Zoo(src string) error {
+	prog, err := exec.LookPath(command.Zoo)
+	if err != nil {
+		return fmt.Errorf("archive zoo reader %w", err)
+	}
+	tmp, err := os.MkdirTemp(helper.TmpDir(), "archive-zoo-")
+	if err != nil {
+		return fmt.Errorf("archive zoo reader %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	name, err := zooCopy(src, tmp)
+	if err != nil {
+		return fmt.Errorf("archive zoo reader %w", err)
+	}
+	const list = "l"
+	var b bytes.Buffer
+	ctx, cancel := c.context(TimeoutLookup)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, list, name)
+	cmd.Stderr = &b
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("archive zoo output %w", err)
+	}
+	if len(out) == 0 {
+		return ErrRead
+	}
+	files := []string{}
+	entries := []Entry{}
+	for _, s := range strings.Split(string(out), "\n") {
+		e, ok := zooEntry(s)
+		if !ok {
+			continue
+		}
+		files = append(files, e.Name)
+		entries = append(entries, e)
+	}
+	c.Files = files
+	c.Entries = entries
+	c.Clean()
+	c.Ext = zoox
+	c.Tool = command.Zoo
+	return nil
+}
+
+// Zoo extracts the targets from the source Zoo archive
+// to the destination directory using the [zoo program].
+// If the targets are empty then all files are extracted.
+//
+// The zoo program only extracts to the working directory,
+// and the files are extracted without their directory paths.
+//
+// [zoo program]: https://launchpad.net/ubuntu/+source/zoo
+func (x Extractor) Zoo(targets ...string) error {
+	src, dst := x.Source, x.Destination
+	if err := destDir(dst); err != nil {
+		return err
+	}
+	prog, err := exec.LookPath(command.Zoo)
+	if err != nil {
+		return fmt.Errorf("archive zoo extract %w", err)
+	}
+	srcInDst, err := zooCopy(src, dst)
+	if err != nil {
+		return fmt.Errorf("archive zoo duplicate %w", err)
+	}
+	defer os.Remove(srcInDst)
+
+	var b bytes.Buffer
+	ctx, cancel := x.context(TimeoutDefunct)
+	defer cancel()
+	const (
+		extract = "xO" // x extract files, O overwrite existing files without asking
+	)
+	args := []string{extract, filepath.Base(srcInDst)}
+	args = append(args, targets...)
+	cmd := exec.CommandContext(ctx, prog, args...)
+	cmd.Dir = dst
+	x.output(cmd, &b)
+	if err = cmd.Run(); err != nil {
+		if b.String() != "" {
+			return fmt.Errorf("archive zoo %w: %s: %q",
+				ErrProg, prog, stderr(&b))
+		}
+		return fmt.Errorf("archive zoo %w: %s", err, prog)
+	}
+	return nil
+}
+
+// zooCopy links the src archive into the dst directory and returns the path of the link.
+// The zoo program appends the .zoo extension to an archive name without an extension,
+// so the link of such a src archive is given the extension.
+func zooCopy(src, dst string) (string, error) {
+	ext := filepath.Ext(src)
+	if ext == "" {
+		ext = zoox
+	}
+	return workingCopy(src, dst, ext)
+}
+
+// zooEntry returns the file entry of a row from the [zoo program] list command,
+// which lists the uncompressed size, the compression factor, the compressed size,
+// the date with a two-digit year and the time with an optional time zone, followed by the name.
+//
+//	Length    CF  Size Now  Date      Time
+//	--------  --- --------  --------- --------
+//	    2680  56%     1189  20 May 92 16:57:26+1   24mhzhck.txt
+//	--------  --- --------  --------- --------
+//	    2680  56%     1189     1 file
+//
+// [zoo program]: https://launchpad.net/ubuntu/+source/zoo
+func zooEntry(s string) (Entry, bool) {
+	fields := strings.Fields(s)
+	const size, factor, packed, day, month, year, clock, name = 0, 1, 2, 3, 4, 5, 6, 7
+	if len(fields) <= name || !strings.HasSuffix(fields[factor], "%") {
+		return Entry{}, false
+	}
+	n, err := strconv.ParseInt(fields[size], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	cn, err := strconv.ParseInt(fields[packed], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	const hhmmss = len("15:04:05")
+	hms := fields[clock][:min(hhmmss, len(fields[clock]))]
+	t, err := time.Parse("2 Jan 06 15:04:05", strings.Join(fields[day:year+1], " ")+" "+hms)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{
+		Name:           strings.Join(fields[name:], " "),
+		Size:           n,
+		CompressedSize: cn,
+		Modified: time.Date(dosYear(t.Year()%100), t.Month(), t.Day(),
+			t.Hour(), t.Minute(), t.Second(), 0, time.UTC),
+	}, true
+}